@@ -18,8 +18,10 @@ package apigateway
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"math/rand"
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -41,13 +43,24 @@ type APIInfo struct {
 	Title   string `json:"title"`
 }
 
-// APIPath provides is a part of th API Gateway swagger
+// APIPath provides is a part of th API Gateway swagger. With per-route resources (see SwaggerConfig.Routes), paths
+// have methods for each handled HTTP method, otherwise they only have the ANY method.
 type APIPath struct {
-	XAmazonAPIGatwayAnyMethod ANYMethod `json:"x-amazon-apigateway-any-method"`
+	XAmazonAPIGatwayAnyMethod *ANYMethod `json:"x-amazon-apigateway-any-method,omitempty"`
+	Get                       *APIMethod `json:"get,omitempty"`
+	Head                      *APIMethod `json:"head,omitempty"`
+	Post                      *APIMethod `json:"post,omitempty"`
+	Put                       *APIMethod `json:"put,omitempty"`
+	Patch                     *APIMethod `json:"patch,omitempty"`
+	Delete                    *APIMethod `json:"delete,omitempty"`
+	Options                   *APIMethod `json:"options,omitempty"`
 }
 
 // ANYMethod provides is a part of th API Gateway swagger, it instructs the API to handle any HTTP method on an APIPath
-type ANYMethod struct {
+type ANYMethod = APIMethod
+
+// APIMethod provides is a part of th API Gateway swagger, it's an HTTP method on an APIPath
+type APIMethod struct {
 	Produces                     []string                 `json:"produces"`
 	Parameters                   []map[string]interface{} `json:"parameters"`
 	Responses                    map[string]string        `json:"responses"`
@@ -75,9 +88,17 @@ type SwaggerConfig struct {
 	CacheNamespace    string
 	Version           string
 	ResourceTimeoutMs int
+	// Routes, if set, are given their own API Gateway resources and methods instead of only using a {proxy+} resource
+	Routes []SwaggerRoute
 	// BinaryMediaTypes []string
 }
 
+// SwaggerRoute is a route handled by the Lambda function, the path uses the Aegis Router syntax (ie. /posts/:id)
+type SwaggerRoute struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
 // NewSwagger creates a new Swagger struct with some default values
 func NewSwagger(cfg *SwaggerConfig) (Swagger, error) {
 	if cfg.LambdaURI == "" {
@@ -115,35 +136,42 @@ func NewSwagger(cfg *SwaggerConfig) (Swagger, error) {
 	}
 
 	// Set the ANY method
-	params := []map[string]interface{}{}
-	params = append(params, map[string]interface{}{
-		"name":     "proxy",
-		"in":       "path",
-		"required": true,
-		"type":     "string",
-	})
+	params := []map[string]interface{}{pathParam("proxy")}
+	proxyAnyMethod := newMethod(cfg, params)
+	proxyAnyMethod.XAmazonAPIGatewayIntegration.CacheNamespace = cfg.CacheNamespace
+	proxyAnyMethod.XAmazonAPIGatewayIntegration.CacheKeyParameters = []string{"method.request.path.proxy"}
 
-	proxyAnyMethod := ANYMethod{
-		Produces:   []string{"application/json"},
-		Parameters: params,
-		Responses:  map[string]string{},
-		XAmazonAPIGatewayIntegration: APIIntegration{
-			URI: cfg.LambdaURI,
-			Responses: map[string]map[string]string{
-				"default": map[string]string{
-					"statusCode": "200",
-				},
-			},
-			PassthroughBehavior: "when_no_match",
-			HTTPMethod:          "POST",
-			CacheNamespace:      cfg.CacheNamespace,
-			CacheKeyParameters:  []string{"method.request.path.proxy"},
-			Type:                "aws_proxy",
-			TimeoutMs:           cfg.ResourceTimeoutMs,
+	rootAnyMethod := newMethod(cfg, params)
+
+	paths := map[string]APIPath{
+		"/": APIPath{
+			XAmazonAPIGatwayAnyMethod: &rootAnyMethod,
+		},
+		"/{proxy+}": APIPath{
+			XAmazonAPIGatwayAnyMethod: &proxyAnyMethod,
 		},
 	}
+	if len(cfg.Routes) > 0 {
+		if err := addRoutePaths(cfg, paths); err != nil {
+			return Swagger{}, err
+		}
+	}
+
+	return Swagger{
+		Swagger: "2.0",
+		Info:    apiInfo,
+		// Omit Host?
+		BasePath: "/prod",
+		Schemes:  []string{"https"},
+		Paths:    paths,
+		// This does not work.
+		// XAmazonAPIGatewayBinaryMediaTypes: cfg.BinaryMediaTypes,
+	}, nil
+}
 
-	rootAnyMethod := ANYMethod{
+// newMethod returns a method with the Lambda proxy integration
+func newMethod(cfg *SwaggerConfig, params []map[string]interface{}) APIMethod {
+	return APIMethod{
 		Produces:   []string{"application/json"},
 		Parameters: params,
 		Responses:  map[string]string{},
@@ -160,24 +188,115 @@ func NewSwagger(cfg *SwaggerConfig) (Swagger, error) {
 			TimeoutMs:           cfg.ResourceTimeoutMs,
 		},
 	}
+}
 
-	return Swagger{
-		Swagger: "2.0",
-		Info:    apiInfo,
-		// Omit Host?
-		BasePath: "/prod",
-		Schemes:  []string{"https"},
-		Paths: map[string]APIPath{
-			"/": APIPath{
-				XAmazonAPIGatwayAnyMethod: rootAnyMethod,
-			},
-			"/{proxy+}": APIPath{
-				XAmazonAPIGatwayAnyMethod: proxyAnyMethod,
-			},
-		},
-		// This does not work.
-		// XAmazonAPIGatewayBinaryMediaTypes: cfg.BinaryMediaTypes,
-	}, nil
+// pathParam returns a required path parameter
+func pathParam(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":     name,
+		"in":       "path",
+		"required": true,
+		"type":     "string",
+	}
+}
+
+// proxyParam is the greedy param of the path every request goes to when there are no routes for it
+const proxyParam = "{proxy+}"
+
+// addRoutePaths adds a path (resource) for each route, with a method for each handled HTTP method. The path params
+// are declared and used as cache keys. Each path also keeps an ANY method, so the Router can still respond to methods
+// that aren't handled (405 Method Not Allowed, OPTIONS and HEAD requests). The {proxy+} path remains for not found paths,
+// unless a route has a param right under the root (ie. /:slug), which API Gateway won't allow next to {proxy+}. Then
+// requests for not found paths with more than one part (ie. /a/b) never reach the Router.
+func addRoutePaths(cfg *SwaggerConfig, paths map[string]APIPath) error {
+	// API Gateway doesn't allow different path params in the same place, ie. /{id} and /{slug}/comments
+	params := map[string]string{"/": proxyParam}
+	for _, route := range cfg.Routes {
+		path, names, err := swaggerPath(route.Path, params)
+		if err != nil {
+			return err
+		}
+		// A root param replaces the {proxy+} path, which would conflict with it
+		if params["/"] != proxyParam {
+			delete(paths, "/"+proxyParam)
+		}
+
+		methodParams := []map[string]interface{}{}
+		cacheKeys := []string{}
+		for _, name := range names {
+			methodParams = append(methodParams, pathParam(name))
+			cacheKeys = append(cacheKeys, "method.request.path."+name)
+		}
+		// The cache namespace is left to API Gateway, which uses the resource's ID, so /posts/{id} and /users/{id}
+		// don't share cached responses
+		method := newMethod(cfg, methodParams)
+		if len(cacheKeys) > 0 {
+			method.XAmazonAPIGatewayIntegration.CacheKeyParameters = cacheKeys
+		}
+
+		apiPath := paths[path]
+		if apiPath.XAmazonAPIGatwayAnyMethod == nil {
+			anyMethod := method
+			apiPath.XAmazonAPIGatwayAnyMethod = &anyMethod
+		}
+		switch strings.ToUpper(route.Method) {
+		case "GET":
+			apiPath.Get = &method
+		case "HEAD":
+			apiPath.Head = &method
+		case "POST":
+			apiPath.Post = &method
+		case "PUT":
+			apiPath.Put = &method
+		case "PATCH":
+			apiPath.Patch = &method
+		case "DELETE":
+			apiPath.Delete = &method
+		case "OPTIONS":
+			apiPath.Options = &method
+		default:
+			return fmt.Errorf("unsupported method %s for route %s", route.Method, route.Path)
+		}
+		paths[path] = apiPath
+	}
+	return nil
+}
+
+// swaggerPath converts an Aegis Router path to an API Gateway path and returns the names of its path params.
+// Named params (:id and :id{pattern}) become {id} and catch-alls (*path) become greedy {path+} params.
+// params holds the param (ie. {id} or {path+}) used under each parent path, to catch params API Gateway would reject.
+// API Gateway requires params in the same place to have the same name and to all be greedy or not.
+func swaggerPath(routePath string, params map[string]string) (string, []string, error) {
+	names := []string{}
+	components := strings.Split(routePath, "/")
+	parent := ""
+	for i, component := range components {
+		if i == 0 {
+			continue
+		}
+		name := ""
+		switch {
+		case strings.HasPrefix(component, ":"):
+			name = component[1:]
+			if j := strings.Index(name, "{"); j >= 0 {
+				name = name[:j]
+			}
+			components[i] = "{" + name + "}"
+		case strings.HasPrefix(component, "*"):
+			name = component[1:]
+			components[i] = "{" + name + "+}"
+		}
+		if name != "" {
+			key := parent + "/"
+			if existing, ok := params[key]; ok && existing != components[i] && !(key == "/" && existing == proxyParam) {
+				return "", nil, fmt.Errorf("the path %s has the param %s where others have %s, API Gateway requires the same param", routePath, components[i], existing)
+			}
+			params[key] = components[i]
+			names = append(names, name)
+		}
+		parent += "/" + components[i]
+	}
+	return strings.Join(components, "/"), names, nil
 }
 
 // GetLambdaURI returns the Lambda URI
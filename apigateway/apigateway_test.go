@@ -32,6 +32,93 @@ func TestNewSwagger(t *testing.T) {
 	})
 }
 
+func TestNewSwaggerRoutes(t *testing.T) {
+	lambdaURI := "arn:aws:apigateway:us-east-1:lambda:path/2015-03-31/functions/arn:aws:lambda:us-east-1:12345:function:aegistest/invocation"
+
+	Convey("A new API Swagger struct with per-route resources should be returned", t, func() {
+		apiSwagger, err := NewSwagger(&SwaggerConfig{
+			LambdaURI: lambdaURI,
+			Routes: []SwaggerRoute{
+				{Method: "GET", Path: "/"},
+				{Method: "GET", Path: "/v1/posts/:id{[0-9]+}"},
+				{Method: "delete", Path: "/v1/posts/:id{[0-9]+}"},
+				{Method: "GET", Path: "/v1/files/*path"},
+			},
+		})
+		So(err, ShouldBeNil)
+		So(apiSwagger.Paths, ShouldContainKey, "/{proxy+}")
+		So(apiSwagger.Paths["/"].Get, ShouldNotBeNil)
+		So(apiSwagger.Paths["/"].XAmazonAPIGatwayAnyMethod, ShouldNotBeNil)
+
+		posts := apiSwagger.Paths["/v1/posts/{id}"]
+		So(posts.Get, ShouldNotBeNil)
+		So(posts.Delete, ShouldNotBeNil)
+		So(posts.Post, ShouldBeNil)
+		So(posts.XAmazonAPIGatwayAnyMethod, ShouldNotBeNil)
+		So(posts.Get.Parameters, ShouldHaveLength, 1)
+		So(posts.Get.Parameters[0]["name"], ShouldEqual, "id")
+		So(posts.Get.XAmazonAPIGatewayIntegration.CacheKeyParameters, ShouldResemble, []string{"method.request.path.id"})
+
+		files := apiSwagger.Paths["/v1/files/{path+}"]
+		So(files.Get, ShouldNotBeNil)
+		So(files.Get.Parameters[0]["name"], ShouldEqual, "path")
+	})
+
+	Convey("A root path param should replace the {proxy+} path", t, func() {
+		apiSwagger, err := NewSwagger(&SwaggerConfig{
+			LambdaURI: lambdaURI,
+			Routes:    []SwaggerRoute{{Method: "GET", Path: "/:slug"}},
+		})
+		So(err, ShouldBeNil)
+		So(apiSwagger.Paths, ShouldNotContainKey, "/{proxy+}")
+		So(apiSwagger.Paths, ShouldContainKey, "/{slug}")
+
+		apiSwagger, err = NewSwagger(&SwaggerConfig{
+			LambdaURI: lambdaURI,
+			Routes:    []SwaggerRoute{{Method: "GET", Path: "/*path"}},
+		})
+		So(err, ShouldBeNil)
+		So(apiSwagger.Paths, ShouldNotContainKey, "/{proxy+}")
+		So(apiSwagger.Paths["/{path+}"].Get, ShouldNotBeNil)
+
+		_, err = NewSwagger(&SwaggerConfig{
+			LambdaURI: lambdaURI,
+			Routes: []SwaggerRoute{
+				{Method: "GET", Path: "/:slug"},
+				{Method: "GET", Path: "/*path"},
+			},
+		})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Routes API Gateway can't have should return an error", t, func() {
+		_, err := NewSwagger(&SwaggerConfig{
+			LambdaURI: lambdaURI,
+			Routes: []SwaggerRoute{
+				{Method: "GET", Path: "/posts/:id{[0-9]+}"},
+				{Method: "GET", Path: "/posts/:slug/comments"},
+			},
+		})
+		So(err, ShouldNotBeNil)
+
+		// A greedy param can't be next to another param, even one with the same name
+		_, err = NewSwagger(&SwaggerConfig{
+			LambdaURI: lambdaURI,
+			Routes: []SwaggerRoute{
+				{Method: "GET", Path: "/files/:p"},
+				{Method: "GET", Path: "/files/*p"},
+			},
+		})
+		So(err, ShouldNotBeNil)
+
+		_, err = NewSwagger(&SwaggerConfig{
+			LambdaURI: lambdaURI,
+			Routes:    []SwaggerRoute{{Method: "TRACE", Path: "/posts"}},
+		})
+		So(err, ShouldNotBeNil)
+	})
+}
+
 func TestGetLambdaURI(t *testing.T) {
 	testLambdaARN := "arn:aws:lambda:us-east-1:12345:function:aegis_example:6"
 	expectedLambdaURI := "arn:aws:apigateway:us-east-1:lambda:path/2015-03-31/functions/arn:aws:lambda:us-east-1:12345:function:aegis_example:6/invocations"
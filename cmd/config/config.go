@@ -63,6 +63,7 @@ type DeploymentConfig struct {
 		Stages            map[string]DeploymentStage
 		ResourceTimeoutMs int
 		BinaryMediaTypes  []*string
+		PerRouteResources bool
 	}
 	BucketTriggers []BucketTrigger
 	SESRules       []SESRule
@@ -36,6 +36,7 @@ import (
 	"github.com/spf13/cobra"
 	swagger "github.com/tmaiaroto/aegis/apigateway"
 	"github.com/tmaiaroto/aegis/cmd/deploy"
+	aegis "github.com/tmaiaroto/aegis/framework"
 	// TODO: Make it pretty :)
 	// https://github.com/gernest/wow?utm_source=golangweekly&utm_medium=email
 )
@@ -74,6 +75,11 @@ func Deploy(cmd *cobra.Command, args []string) {
 	// This helps break up many of the functions/steps for deployment
 	deployer := deploy.NewDeployer(&cfg, getAWSSession())
 
+	// Find the Router's routes to give each one its own API Gateway resource
+	if cfg.API.PerRouteResources {
+		deployer.Routes = getRoutes()
+	}
+
 	// It is possible to pass a specific zip file from the config instead of building a new one (why would one? who knows, but I liked the pattern of using cfg)
 	if cfg.Lambda.SourceZip == "" {
 		// Build the Go app in the current directory (for AWS architecture).
@@ -194,6 +200,21 @@ func Deploy(cmd *cobra.Command, args []string) {
 
 }
 
+// getRoutes runs the Go app in the current directory to get the routes handled by its Router
+func getRoutes() []swagger.SwaggerRoute {
+	routes := []swagger.SwaggerRoute{}
+	b, err := runApp(aegis.RoutesFileEnvVar)
+	if err == nil {
+		err = json.Unmarshal(b, &routes)
+	}
+	if err != nil {
+		fmt.Println("There was a problem getting the routes handled by the app.")
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	return routes
+}
+
 // build runs `go build` in the current directory and returns the binary file path to include in the Lambda function zip file.
 func build(buildEnvVars *map[string]string) (string, error) {
 	_ = os.Setenv("GOOS", "linux")
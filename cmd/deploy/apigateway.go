@@ -52,6 +52,10 @@ func (d *Deployer) ImportAPI(lambdaArn string) string {
 			// multiple commands/steps, it's nice just running `up` and nothing else...But it's not
 			// perfect because the user doesn't set the unique identifier for the API.
 			fmt.Println("API already exists.")
+			// Routes change, so their resources are updated with each deploy
+			if len(d.Routes) > 0 {
+				d.UpdateAPI(*apisResp.Items[key].Id, lambdaArn)
+			}
 			return *apisResp.Items[key].Id
 		}
 	}
@@ -61,6 +65,7 @@ func (d *Deployer) ImportAPI(lambdaArn string) string {
 		Title:             d.Cfg.API.Name,
 		LambdaURI:         swagger.GetLambdaURI(lambdaArn),
 		ResourceTimeoutMs: d.Cfg.API.ResourceTimeoutMs,
+		Routes:            d.Routes,
 		// BinaryMediaTypes: d.Cfg.API.BinaryMediaTypes,
 	})
 	if swaggerErr != nil {
@@ -152,7 +157,14 @@ func (d *Deployer) AddAPIPermission(apiID string, lambdaArn string) {
 	buffer.WriteString(":")
 	buffer.WriteString(apiID)
 	// What if ENDPOINT is / ?  ¯\_(ツ)_/¯ will * work?
-	buffer.WriteString("/*/ANY/*")
+	statementID := "aegis-api-gateway-invoke-lambda"
+	if len(d.Routes) > 0 {
+		// Per-route resources have methods other than ANY
+		buffer.WriteString("/*/*/*")
+		statementID = "aegis-api-gateway-invoke-lambda-routes"
+	} else {
+		buffer.WriteString("/*/ANY/*")
+	}
 	sourceArn := buffer.String()
 	buffer.Reset()
 
@@ -166,10 +178,10 @@ func (d *Deployer) AddAPIPermission(apiID string, lambdaArn string) {
 	// })
 
 	_, err := svc.AddPermission(&lambda.AddPermissionInput{
-		Action:       aws.String("lambda:InvokeFunction"),           // Required
-		FunctionName: aws.String(d.Cfg.Lambda.FunctionName),         // Required
-		Principal:    aws.String("apigateway.amazonaws.com"),        // Required
-		StatementId:  aws.String("aegis-api-gateway-invoke-lambda"), // Required
+		Action:       aws.String("lambda:InvokeFunction"),    // Required
+		FunctionName: aws.String(d.Cfg.Lambda.FunctionName),  // Required
+		Principal:    aws.String("apigateway.amazonaws.com"), // Required
+		StatementId:  aws.String(statementID),                // Required
 		// EventSourceToken: aws.String("EventSourceToken"),
 		// Qualifier:        aws.String("Qualifier"),
 		// SourceAccount:    aws.String("SourceOwner"),
@@ -207,9 +219,9 @@ func (d *Deployer) AddBinaryMediaTypes(apiID string) {
 }
 
 // UpdateAPI will update an API's settings that are not configured in the demployment/stage.
-// There is no real need to update the resources or integrations of course, but things like
-// the description, name, binary content types, etc. will need to be updated if changed.
-// TODO: Unused. Maybe implement this.
+// With a {proxy+} resource there is no real need to update the resources or integrations of course, but things like
+// the description, name, binary content types, etc. will need to be updated if changed. With per-route resources,
+// the resources are updated when routes change.
 func (d *Deployer) UpdateAPI(apiID string, lambdaArn string) {
 	svc := apigateway.New(d.AWSSession)
 
@@ -218,6 +230,7 @@ func (d *Deployer) UpdateAPI(apiID string, lambdaArn string) {
 		Title:             d.Cfg.API.Name,
 		LambdaURI:         swagger.GetLambdaURI(lambdaArn),
 		ResourceTimeoutMs: d.Cfg.API.ResourceTimeoutMs,
+		Routes:            d.Routes,
 	})
 	if swaggerErr != nil {
 		fmt.Println("There was a problem creating the API.")
@@ -30,6 +30,7 @@ import (
 	breaker "github.com/kamilsk/breaker"
 	retry "github.com/kamilsk/retry/v4"
 	strategy "github.com/kamilsk/retry/v4/strategy"
+	swagger "github.com/tmaiaroto/aegis/apigateway"
 	"github.com/tmaiaroto/aegis/cmd/config"
 	"github.com/tmaiaroto/aegis/cmd/util"
 )
@@ -40,6 +41,8 @@ type Deployer struct {
 	AWSSession *session.Session
 	LambdaArn  *string
 	TasksPath  string
+	// Routes, if set, are given their own API Gateway resources (see the API's PerRouteResources config)
+	Routes []swagger.SwaggerRoute
 }
 
 // NewDeployer takes a cfg argument to set the config needed for its various functions
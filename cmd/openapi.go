@@ -0,0 +1,122 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+	aegis "github.com/tmaiaroto/aegis/framework"
+)
+
+// openAPICmd is a command that will generate an OpenAPI document for the app's Router
+var openAPICmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Generate OpenAPI docs",
+	Long:  `Generates an OpenAPI 3 document from the routes handled by your application's Router`,
+	Run:   OpenAPI,
+}
+
+// openAPIOutput is the file to write the document to, stdout if empty
+var openAPIOutput string
+
+// openAPIVersion is the API version in the document
+var openAPIVersion string
+
+// init the `openapi` command
+func init() {
+	RootCmd.AddCommand(openAPICmd)
+
+	openAPICmd.Flags().StringVarP(&openAPIOutput, "output", "o", "", "file to write the OpenAPI document to (default is stdout)")
+	openAPICmd.Flags().StringVarP(&openAPIVersion, "apiVersion", "v", "1.0.0", "version of the API")
+}
+
+// OpenAPI will run the Go app in the current directory to generate an OpenAPI document for its Router.
+// The app writes the document instead of listening for events when it's started by this command.
+func OpenAPI(cmd *cobra.Command, args []string) {
+	b, err := runApp(aegis.OpenAPIFileEnvVar)
+	if err != nil {
+		fmt.Println("There was a problem running the app.")
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+
+	var doc aegis.OpenAPIDocument
+	if err := json.Unmarshal(b, &doc); err != nil || doc.OpenAPI == "" {
+		fmt.Println("The app did not generate an OpenAPI document. Make sure it calls Start() (or Listen() on its Router).")
+		os.Exit(-1)
+	}
+
+	doc.Info = aegis.OpenAPIInfo{
+		Title:       cfg.API.Name,
+		Description: cfg.API.Description,
+		Version:     openAPIVersion,
+	}
+	b, err = json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+
+	if openAPIOutput == "" {
+		fmt.Println(string(b))
+		return
+	}
+	if err := ioutil.WriteFile(openAPIOutput, b, 0644); err != nil {
+		fmt.Println("There was a problem writing the OpenAPI document.")
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	fmt.Printf("OpenAPI document written to %s\n", openAPIOutput)
+}
+
+// runApp runs the Go app in the current directory (locally, with `go run`) and returns the contents of the file it
+// writes when the given environment variable is set to the file's path. This is how the app's routes and
+// OpenAPI document are found.
+func runApp(envVar string) ([]byte, error) {
+	tmpFile, err := ioutil.TempFile("", "aegis_run")
+	if err != nil {
+		return nil, err
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	// The app runs locally, so unlike build() it is not built for AWS (build() sets GOOS and GOARCH)
+	cmd := exec.Command(getExecPath("go"), "run", ".")
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "GOOS=") && !strings.HasPrefix(kv, "GOARCH=") {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	for k, v := range cfg.App.BuildEnvVars {
+		k = strings.ToUpper(k)
+		if k != "" && k != "GOOS" && k != "GOARCH" {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+	cmd.Env = append(cmd.Env, envVar+"="+tmpFile.Name())
+	// The app's own output isn't part of the file
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(tmpFile.Name())
+}
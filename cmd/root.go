@@ -121,6 +121,8 @@ func InitConfig() {
 	viper.SetDefault("api.cacheSize", apigateway.CacheClusterSize05)
 	// All resources ({proxy+} and /) get this timeout in ms (AWS default is 29000 too)
 	viper.SetDefault("api.resourceTimeoutMs", 29000)
+	// By default a single {proxy+} resource sends every request to the Router, instead of a resource per route
+	viper.SetDefault("api.perRouteResources", false)
 
 	// Default API stage (does not use caching, that comes with an additional cost)
 	viper.SetDefault("api.stages", map[string]config.DeploymentStage{
@@ -30,6 +30,7 @@ import (
 	"time"
 	"unicode"
 
+	"github.com/aws/aws-lambda-go/cfn"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-lambda-go/lambdacontext"
@@ -55,20 +56,71 @@ type (
 	// APIGatewayProxyRequestContext alias for APIGatewayProxyRequestContext
 	APIGatewayProxyRequestContext events.APIGatewayProxyRequestContext
 
+	// APIGatewayWebsocketProxyRequest alias for incoming API Gateway WebSocket API events, additional functionality added by websocket.go
+	APIGatewayWebsocketProxyRequest events.APIGatewayWebsocketProxyRequest
+
+	// APIGatewayCustomAuthorizerResponse alias for API Gateway Lambda authorizer responses, additional functionality added by authorizer.go
+	APIGatewayCustomAuthorizerResponse events.APIGatewayCustomAuthorizerResponse
+
+	// ALBTargetGroupRequest alias for incoming Application Load Balancer target group requests, additional functionality added by alb.go
+	ALBTargetGroupRequest events.ALBTargetGroupRequest
+
+	// ALBTargetGroupResponse alias for Application Load Balancer target group responses
+	ALBTargetGroupResponse events.ALBTargetGroupResponse
+
+	// CustomResourceEvent alias for CloudFormation custom resource events, additional functionality added by custom_resource.go
+	CustomResourceEvent cfn.Event
+
 	// S3Event alias
 	S3Event events.S3Event
 
-	// CognitoEvent alias (NOT a Cognito Trigger event, this is for sync)
+	// CognitoEvent alias (NOT a Cognito Trigger event, this is for sync), additional functionality added by cognito_sync.go
 	CognitoEvent events.CognitoEvent
 
-	// CloudWatchEvent alias for CloudWatchEvent events
+	// CloudWatchEvent alias for CloudWatchEvent (EventBridge) events, additional functionality added by eventbridge.go
 	CloudWatchEvent events.CloudWatchEvent
 
+	// CloudwatchLogsEvent alias for CloudWatch Logs subscription filter events
+	CloudwatchLogsEvent events.CloudwatchLogsEvent
+
+	// CloudwatchLogsData alias for decoded CloudWatch Logs subscription filter data
+	CloudwatchLogsData events.CloudwatchLogsData
+
 	// SimpleEmailEvent alias for SES Email events (recipient rules)
 	SimpleEmailEvent events.SimpleEmailEvent
 
 	// SQSEvent alias for SQS events
 	SQSEvent events.SQSEvent
+
+	// DynamoDBEvent alias for DynamoDB Stream events
+	DynamoDBEvent events.DynamoDBEvent
+
+	// DynamoDBEventRecord alias for DynamoDB Stream event records, additional functionality added by dynamodb.go
+	DynamoDBEventRecord events.DynamoDBEventRecord
+
+	// KinesisEvent alias for Kinesis Data Streams events
+	KinesisEvent events.KinesisEvent
+
+	// KinesisEventRecord alias for Kinesis Data Streams event records, additional functionality added by kinesis.go
+	KinesisEventRecord events.KinesisEventRecord
+
+	// KinesisFirehoseEvent alias for Kinesis Data Firehose data transformation events
+	KinesisFirehoseEvent events.KinesisFirehoseEvent
+
+	// KinesisFirehoseEventRecord alias for Kinesis Data Firehose records, additional functionality added by firehose.go
+	KinesisFirehoseEventRecord events.KinesisFirehoseEventRecord
+
+	// KinesisFirehoseResponse alias for Kinesis Data Firehose data transformation responses
+	KinesisFirehoseResponse events.KinesisFirehoseResponse
+
+	// KinesisFirehoseResponseRecord alias for transformed Kinesis Data Firehose records
+	KinesisFirehoseResponseRecord events.KinesisFirehoseResponseRecord
+
+	// SNSEvent alias for SNS notification events
+	SNSEvent events.SNSEvent
+
+	// SNSEventRecord alias for SNS notification event records, additional functionality added by sns.go
+	SNSEventRecord events.SNSEventRecord
 )
 
 // Log uses Logrus for logging and will hook to CloudWatch...But could also be used to hook to other centralized logging services.
@@ -97,6 +149,7 @@ type Aegis struct {
 // Services defines core framework services such as auth
 type Services struct {
 	Cognito        *CognitoAppClient
+	WebSocket      *WebSocketConnectionManager
 	Variables      map[string]string
 	configurations map[string]func(context.Context, map[string]interface{}) interface{}
 }
@@ -128,7 +181,20 @@ func (a *Aegis) ConfigureLogger(logger *logrus.Logger) {
 
 // Start will tell all handlers to listen for events, it's designed to be similar to lambda.Start()
 func (a *Aegis) Start() {
-	lambda.Start(a.aegisHandler)
+	// The aegis CLI runs the app to find the Router's routes (`aegis openapi` and `aegis deploy`)
+	if writeCLIFiles(a.Router) {
+		return
+	}
+	lambda.Start(a.rawHandler)
+}
+
+// rawHandler decodes the raw Lambda event for aegisHandler, this allows for events that aren't JSON objects (see UnmarshalEvent)
+func (a *Aegis) rawHandler(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	evt, err := UnmarshalEvent(raw)
+	if err != nil {
+		return nil, err
+	}
+	return a.aegisHandler(ctx, evt)
 }
 
 // ConfigureService will configure an AegisService
@@ -234,6 +300,17 @@ func (a *Aegis) aegisHandler(ctx context.Context, evt map[string]interface{}) (i
 		}
 	}
 
+	// If a "websocket" configuration function was provided and the connection manager has not been configured already.
+	// Otherwise, WebSocketRouter will configure it using the endpoint of the API that sent the event.
+	if sCfg, ok := a.Services.configurations["websocket"]; ok && a.Services.WebSocket == nil {
+		svc, err := NewWebSocketConnectionManager(sCfg(ctx, evt).(*WebSocketConnectionManagerConfig))
+		if err != nil {
+			log.Println("WebSocket connection manager could not be configured")
+			log.Println(err)
+		}
+		a.Services.WebSocket = svc
+	}
+
 	// Filters to run before handling the event (but after services have been configured).
 	if a.Filters.Handler.Before != nil {
 		for _, filter := range a.Filters.Handler.Before {
@@ -438,8 +515,7 @@ func (h standAloneHandler) proxyResponseToHTTPResponse(res *APIGatewayProxyRespo
 		}
 	}
 
-	// TODO: Actually allow this to be configured.
-	// CORS. Allow everything since we are assumed to be running locally.
+	// CORS. Allow everything by default since we are assumed to be running locally.
 	allowedHeaders := []string{
 		"Accept",
 		"Content-Type",
@@ -457,9 +533,24 @@ func (h standAloneHandler) proxyResponseToHTTPResponse(res *APIGatewayProxyRespo
 		"PATCH",
 		"DELETE",
 	}
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
-	w.Header().Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
+	allowedOrigin := "*"
+	if h.cfg != nil {
+		if len(h.cfg.AllowHeaders) > 0 {
+			allowedHeaders = h.cfg.AllowHeaders
+		}
+		if len(h.cfg.AllowMethods) > 0 {
+			allowedMethods = h.cfg.AllowMethods
+		}
+		if h.cfg.AllowOrigin != "" {
+			allowedOrigin = h.cfg.AllowOrigin
+		}
+	}
+	// A Router with a CORS policy sets its own headers, which are what API Gateway would return
+	if res.GetHeader(HeaderAccessControlAllowOrigin) == "" {
+		w.Header().Set(HeaderAccessControlAllowOrigin, allowedOrigin)
+		w.Header().Set(HeaderAccessControlAllowMethods, strings.Join(allowedMethods, ", "))
+		w.Header().Set(HeaderAccessControlAllowHeaders, strings.Join(allowedHeaders, ", "))
+	}
 
 	// err is any error returned from a handler handling an event.
 	// If it isn't nil, then we can't even attempt to return the response, it might not be set.
@@ -0,0 +1,195 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func init() {
+	// Application Load Balancer target group requests are also handled by Router
+	// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html
+	// They look like API Gateway proxy requests, so they must be detected first.
+	RegisterEventType(EventType{
+		Name:     "ALBTargetGroupRequest",
+		Priority: 70,
+		Detect: func(evt map[string]interface{}) bool {
+			return keyInMap("httpMethod", evt) && isALBTargetGroupRequest(evt)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e ALBTargetGroupRequest
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.Router != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.Router.ALBLambdaHandler(ctx, d, evt.(ALBTargetGroupRequest))
+		},
+	})
+}
+
+// isALBTargetGroupRequest returns true if the event's request context came from an Application Load Balancer
+func isALBTargetGroupRequest(evt map[string]interface{}) bool {
+	requestContext, ok := evt["requestContext"].(map[string]interface{})
+	return ok && keyInMap("elb", requestContext)
+}
+
+// ALBLambdaHandler handles Application Load Balancer target group requests. The request is converted to an
+// APIGatewayProxyRequest so the same routes, middleware and handlers work behind both API Gateway and an ALB.
+// The response is then converted back to the format the ALB expects, including a status description.
+func (r *Router) ALBLambdaHandler(ctx context.Context, d *HandlerDependencies, req ALBTargetGroupRequest) (ALBTargetGroupResponse, error) {
+	if r == nil {
+		return ALBTargetGroupResponse{}, errors.New("no handlers registered for Router")
+	}
+	res, err := r.LambdaHandler(ctx, d, req.ProxyRequest())
+	return NewALBTargetGroupResponse(res, req.MultiValueHeadersEnabled()), err
+}
+
+// MultiValueHeadersEnabled returns true if the target group has multi-value headers enabled. When enabled, the ALB sends
+// (and expects to receive) multi-value headers and query string parameters instead of the single value versions.
+func (req *ALBTargetGroupRequest) MultiValueHeadersEnabled() bool {
+	return req.MultiValueHeaders != nil || req.MultiValueQueryStringParameters != nil
+}
+
+// ProxyRequest converts the ALB request into an APIGatewayProxyRequest
+func (req *ALBTargetGroupRequest) ProxyRequest() APIGatewayProxyRequest {
+	proxyReq := APIGatewayProxyRequest{
+		Path:            req.Path,
+		HTTPMethod:      req.HTTPMethod,
+		Body:            req.Body,
+		IsBase64Encoded: req.IsBase64Encoded,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			HTTPMethod: req.HTTPMethod,
+		},
+	}
+
+	// Fill in both the single and multi-value versions, API Gateway provides both
+	if req.MultiValueHeadersEnabled() {
+		proxyReq.MultiValueHeaders = req.MultiValueHeaders
+		proxyReq.Headers = make(map[string]string, len(req.MultiValueHeaders))
+		for k, v := range req.MultiValueHeaders {
+			if len(v) > 0 {
+				proxyReq.Headers[k] = v[len(v)-1]
+			}
+		}
+	} else {
+		proxyReq.Headers = req.Headers
+		proxyReq.MultiValueHeaders = make(map[string][]string, len(req.Headers))
+		for k, v := range req.Headers {
+			proxyReq.MultiValueHeaders[k] = []string{v}
+		}
+	}
+
+	// Unlike API Gateway, an ALB does not decode query string parameters
+	multiValueQuery := req.MultiValueQueryStringParameters
+	if !req.MultiValueHeadersEnabled() {
+		multiValueQuery = make(map[string][]string, len(req.QueryStringParameters))
+		for k, v := range req.QueryStringParameters {
+			multiValueQuery[k] = []string{v}
+		}
+	}
+	if len(multiValueQuery) > 0 {
+		proxyReq.QueryStringParameters = make(map[string]string, len(multiValueQuery))
+		proxyReq.MultiValueQueryStringParameters = make(map[string][]string, len(multiValueQuery))
+		for k, values := range multiValueQuery {
+			key := albQueryUnescape(k)
+			for _, v := range values {
+				v = albQueryUnescape(v)
+				proxyReq.MultiValueQueryStringParameters[key] = append(proxyReq.MultiValueQueryStringParameters[key], v)
+				proxyReq.QueryStringParameters[key] = v
+			}
+		}
+	}
+
+	// There is no identity in the request context, so use the headers the ALB adds
+	forwardedFor := proxyReq.GetHeader("X-Forwarded-For")
+	if forwardedFor != "" {
+		proxyReq.RequestContext.Identity.SourceIP = strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+	}
+	proxyReq.RequestContext.Identity.UserAgent = proxyReq.GetHeader("User-Agent")
+
+	return proxyReq
+}
+
+// albQueryUnescape decodes a query string key or value, returning it as is if it can't be decoded
+func albQueryUnescape(s string) string {
+	if u, err := url.QueryUnescape(s); err == nil {
+		return u
+	}
+	return s
+}
+
+// NewALBTargetGroupResponse converts an APIGatewayProxyResponse into the response format an ALB expects.
+// When multi-value headers are enabled on the target group, all headers are returned as multi-value headers.
+// Otherwise, multi-value headers are joined with commas, except for Set-Cookie where only the last value is kept
+// (enable multi-value headers on the target group to set more than one cookie).
+func NewALBTargetGroupResponse(res APIGatewayProxyResponse, multiValueHeaders bool) ALBTargetGroupResponse {
+	statusCode := res.StatusCode
+	if statusCode == 0 {
+		statusCode = 200
+	}
+	albRes := ALBTargetGroupResponse{
+		StatusCode:        statusCode,
+		StatusDescription: strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		Body:              res.Body,
+		IsBase64Encoded:   res.IsBase64Encoded,
+	}
+
+	if multiValueHeaders {
+		albRes.MultiValueHeaders = make(map[string][]string, len(res.Headers)+len(res.MultiValueHeaders))
+		for k, v := range res.Headers {
+			albRes.MultiValueHeaders[k] = []string{v}
+		}
+		for k, v := range res.MultiValueHeaders {
+			albRes.MultiValueHeaders[k] = v
+		}
+		return albRes
+	}
+
+	albRes.Headers = make(map[string]string, len(res.Headers)+len(res.MultiValueHeaders))
+	for k, v := range res.Headers {
+		albRes.Headers[k] = v
+	}
+	for k, v := range res.MultiValueHeaders {
+		if len(v) == 0 {
+			continue
+		}
+		if strings.EqualFold(k, "Set-Cookie") {
+			albRes.Headers[k] = v[len(v)-1]
+		} else {
+			albRes.Headers[k] = strings.Join(v, ",")
+		}
+	}
+	return albRes
+}
+
+// TargetGroupName returns the name of the target group the request came from
+// ie. arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/lambda-target/abcdef0123456789
+func (req *ALBTargetGroupRequest) TargetGroupName() string {
+	p := strings.Split(req.RequestContext.ELB.TargetGroupArn, "/")
+	if len(p) > 1 {
+		return p[1]
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	events "github.com/aws/aws-lambda-go/events"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestALB(t *testing.T) {
+	testFallThroughHandler := func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) error {
+		res.String(404, "not found")
+		return nil
+	}
+	testRouter := NewRouter(testFallThroughHandler)
+	testRouter.Tracer = NoTraceStrategy{}
+	testRouter.GET("/users/:id", func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) error {
+		res.JSON(200, map[string]interface{}{
+			"id":   params.Get("id"),
+			"q":    req.GetParam("q"),
+			"tags": req.MultiValueQueryStringParameters["tag"],
+			"ip":   req.IP(),
+		})
+		return nil
+	})
+
+	targetGroupArn := "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/lambda-target/abcdef0123456789"
+
+	Convey("ProxyRequest()", t, func() {
+		Convey("Should convert a single value ALB request and decode query string parameters", func() {
+			req := ALBTargetGroupRequest{
+				HTTPMethod:            "GET",
+				Path:                  "/users/123",
+				QueryStringParameters: map[string]string{"q": "hello%20world"},
+				Headers:               map[string]string{"x-forwarded-for": "192.0.2.1, 10.0.0.1"},
+				RequestContext:        events.ALBTargetGroupRequestContext{ELB: events.ELBContext{TargetGroupArn: targetGroupArn}},
+			}
+			So(req.MultiValueHeadersEnabled(), ShouldBeFalse)
+			proxyReq := req.ProxyRequest()
+			So(proxyReq.GetParam("q"), ShouldEqual, "hello world")
+			So(proxyReq.IP(), ShouldEqual, "192.0.2.1")
+			So(proxyReq.MultiValueHeaders["x-forwarded-for"], ShouldResemble, []string{"192.0.2.1, 10.0.0.1"})
+			So(req.TargetGroupName(), ShouldEqual, "lambda-target")
+		})
+
+		Convey("Should convert a multi-value ALB request", func() {
+			req := ALBTargetGroupRequest{
+				HTTPMethod:                      "GET",
+				Path:                            "/users/123",
+				MultiValueQueryStringParameters: map[string][]string{"tag": {"a", "b%2Fc"}},
+				MultiValueHeaders:               map[string][]string{"accept": {"text/html", "application/json"}},
+			}
+			So(req.MultiValueHeadersEnabled(), ShouldBeTrue)
+			proxyReq := req.ProxyRequest()
+			So(proxyReq.MultiValueQueryStringParameters["tag"], ShouldResemble, []string{"a", "b/c"})
+			So(proxyReq.GetHeader("Accept"), ShouldEqual, "application/json")
+		})
+	})
+
+	Convey("NewALBTargetGroupResponse()", t, func() {
+		res := APIGatewayProxyResponse{
+			StatusCode:        404,
+			Headers:           map[string]string{"Content-Type": "text/plain"},
+			MultiValueHeaders: map[string][]string{"Set-Cookie": {"a=1", "b=2"}},
+			Body:              "not found",
+		}
+
+		Convey("Should set a status description", func() {
+			albRes := NewALBTargetGroupResponse(res, false)
+			So(albRes.StatusDescription, ShouldEqual, "404 Not Found")
+			So(albRes.Headers["Content-Type"], ShouldEqual, "text/plain")
+			So(albRes.Headers["Set-Cookie"], ShouldEqual, "b=2")
+			So(albRes.MultiValueHeaders, ShouldBeNil)
+		})
+
+		Convey("Should return multi-value headers when enabled", func() {
+			albRes := NewALBTargetGroupResponse(res, true)
+			So(albRes.MultiValueHeaders["Content-Type"], ShouldResemble, []string{"text/plain"})
+			So(albRes.MultiValueHeaders["Set-Cookie"], ShouldResemble, []string{"a=1", "b=2"})
+			So(albRes.Headers, ShouldBeNil)
+		})
+	})
+
+	Convey("Handlers should detect and decode ALB events", t, func() {
+		evt := map[string]interface{}{
+			"requestContext": map[string]interface{}{
+				"elb": map[string]interface{}{"targetGroupArn": targetGroupArn},
+			},
+			"httpMethod":            "GET",
+			"path":                  "/users/456",
+			"queryStringParameters": map[string]interface{}{"q": "a%26b"},
+			"headers":               map[string]interface{}{"x-forwarded-for": "192.0.2.2"},
+			"body":                  "",
+			"isBase64Encoded":       false,
+		}
+		So(getType(evt), ShouldEqual, "ALBTargetGroupRequest")
+
+		h := Handlers{Router: testRouter}
+		res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, evt)
+		So(err, ShouldBeNil)
+		So(res, ShouldHaveSameTypeAs, ALBTargetGroupResponse{})
+		So(res.(ALBTargetGroupResponse).StatusDescription, ShouldEqual, "200 OK")
+		So(res.(ALBTargetGroupResponse).Body, ShouldEqual, `{"id":"456","ip":"192.0.2.2","q":"a\u0026b","tags":null}`)
+	})
+}
@@ -0,0 +1,275 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// The AWS Lambda events package (at the version used) has no types for AppSync direct Lambda resolvers, so they are defined here.
+// https://docs.aws.amazon.com/appsync/latest/devguide/resolver-context-reference.html
+
+// AppSyncResolverEvent is an AppSync direct Lambda resolver invocation (the resolver's context)
+type AppSyncResolverEvent struct {
+	Arguments map[string]interface{} `json:"arguments"`
+	Identity  *AppSyncIdentity       `json:"identity"`
+	Source    map[string]interface{} `json:"source"`
+	Request   struct {
+		Headers map[string]string `json:"headers"`
+	} `json:"request"`
+	Info AppSyncInfo `json:"info"`
+	Prev *struct {
+		Result interface{} `json:"result"`
+	} `json:"prev"`
+	Stash map[string]interface{} `json:"stash"`
+}
+
+// AppSyncIdentity is the caller's identity, which fields are set depends on the API's authorization type.
+// Cognito User Pools set Sub, Issuer, Username, Claims and Groups. IAM sets AccountID, UserArn and the Cognito Identity fields.
+// Lambda authorizers set ResolverContext. The identity is nil for API key authorization.
+type AppSyncIdentity struct {
+	Sub                         string                 `json:"sub,omitempty"`
+	Issuer                      string                 `json:"issuer,omitempty"`
+	Username                    string                 `json:"username,omitempty"`
+	Claims                      map[string]interface{} `json:"claims,omitempty"`
+	SourceIP                    []string               `json:"sourceIp,omitempty"`
+	DefaultAuthStrategy         string                 `json:"defaultAuthStrategy,omitempty"`
+	Groups                      []string               `json:"groups,omitempty"`
+	AccountID                   string                 `json:"accountId,omitempty"`
+	UserArn                     string                 `json:"userArn,omitempty"`
+	CognitoIdentityPoolID       string                 `json:"cognitoIdentityPoolId,omitempty"`
+	CognitoIdentityID           string                 `json:"cognitoIdentityId,omitempty"`
+	CognitoIdentityAuthType     string                 `json:"cognitoIdentityAuthType,omitempty"`
+	CognitoIdentityAuthProvider string                 `json:"cognitoIdentityAuthProvider,omitempty"`
+	ResolverContext             map[string]interface{} `json:"resolverContext,omitempty"`
+}
+
+// AppSyncInfo contains information about the GraphQL request
+type AppSyncInfo struct {
+	FieldName           string                 `json:"fieldName"`
+	ParentTypeName      string                 `json:"parentTypeName"`
+	Variables           map[string]interface{} `json:"variables"`
+	SelectionSetList    []string               `json:"selectionSetList"`
+	SelectionSetGraphQL string                 `json:"selectionSetGraphQL"`
+}
+
+// AppSyncBatchResult is the result for one item of a BatchInvoke, errors are per item
+type AppSyncBatchResult struct {
+	Data         interface{} `json:"data"`
+	ErrorMessage string      `json:"errorMessage,omitempty"`
+	ErrorType    string      `json:"errorType,omitempty"`
+}
+
+// AppSyncError is an error with a GraphQL error type, returning it from a handler sets the errorType of a batch result
+type AppSyncError struct {
+	Type    string
+	Message string
+}
+
+// Error returns the error message
+func (e AppSyncError) Error() string {
+	return e.Message
+}
+
+// AppSyncRouter struct provides an interface to handle AppSync direct Lambda resolver invocations by type and field name
+// https://docs.aws.amazon.com/appsync/latest/devguide/resolver-reference-lambda.html
+type AppSyncRouter struct {
+	handlers    map[string]AppSyncHandler
+	rootHandler AppSyncHandler
+	Tracer      TraceStrategy
+}
+
+// AppSyncHandler handles routed resolver invocations and returns the field's data
+type AppSyncHandler func(context.Context, *HandlerDependencies, *AppSyncResolverEvent) (interface{}, error)
+
+func init() {
+	// Resolver invocations have "info" with the parent type and field names. BatchInvoke sends a list of them.
+	RegisterEventType(EventType{
+		Name:     "AppSyncResolverEvent",
+		Priority: 1900,
+		Detect: func(evt map[string]interface{}) bool {
+			if batch, ok := evt[BatchEventKey].([]interface{}); ok && len(batch) > 0 {
+				item, _ := batch[0].(map[string]interface{})
+				return isAppSyncResolverEvent(item)
+			}
+			return isAppSyncResolverEvent(evt)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			if batch, ok := evt[BatchEventKey]; ok {
+				var e []AppSyncResolverEvent
+				err := remarshal(batch, &e)
+				return e, err
+			}
+			var e AppSyncResolverEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.AppSyncRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			if batch, ok := evt.([]AppSyncResolverEvent); ok {
+				return h.AppSyncRouter.BatchLambdaHandler(ctx, d, batch)
+			}
+			return h.AppSyncRouter.LambdaHandler(ctx, d, evt.(AppSyncResolverEvent))
+		},
+	})
+}
+
+// isAppSyncResolverEvent returns true if the event has the info AppSync sends to resolvers
+func isAppSyncResolverEvent(evt map[string]interface{}) bool {
+	info, ok := evt["info"].(map[string]interface{})
+	return ok && keyInMap("fieldName", info) && keyInMap("parentTypeName", info) && keyInMap("arguments", evt)
+}
+
+// LambdaHandler handles a single AppSync resolver invocation, returning the field's data. AppSync will put a returned
+// error in the GraphQL response's errors.
+func (r *AppSyncRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt AppSyncResolverEvent) (interface{}, error) {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return nil, errors.New("no handlers registered for AppSyncRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	return r.resolve(ctx, d, &evt)
+}
+
+// BatchLambdaHandler handles an AppSync BatchInvoke, returning a result for each item in the same order.
+// Errors are returned per item rather than failing the whole batch.
+func (r *AppSyncRouter) BatchLambdaHandler(ctx context.Context, d *HandlerDependencies, evts []AppSyncResolverEvent) ([]AppSyncBatchResult, error) {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return nil, errors.New("no handlers registered for AppSyncRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	results := make([]AppSyncBatchResult, len(evts))
+	for i := range evts {
+		data, err := r.resolve(ctx, d, &evts[i])
+		results[i].Data = data
+		if err != nil {
+			results[i].ErrorMessage = err.Error()
+			var appSyncErr AppSyncError
+			if errors.As(err, &appSyncErr) {
+				results[i].ErrorType = appSyncErr.Type
+			}
+		}
+	}
+	return results, nil
+}
+
+// resolve calls the handler for the event's type and field name, or the root handler
+func (r *AppSyncRouter) resolve(ctx context.Context, d *HandlerDependencies, evt *AppSyncResolverEvent) (interface{}, error) {
+	handler, ok := r.handlers[appSyncHandlerKey(evt.Info.ParentTypeName, evt.Info.FieldName)]
+	if !ok {
+		handler = r.rootHandler
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("no resolver for %s.%s", evt.Info.ParentTypeName, evt.Info.FieldName)
+	}
+
+	d.Tracer.Record("annotation",
+		map[string]interface{}{
+			"AppSyncParentTypeName": evt.Info.ParentTypeName,
+			"AppSyncFieldName":      evt.Info.FieldName,
+			"FallthroughHandler":    !ok,
+		},
+	)
+	var data interface{}
+	err := d.Tracer.Capture(ctx, "AppSyncHandler", func(ctx1 context.Context) error {
+		var err error
+		data, err = handler(ctx1, d, evt)
+		return err
+	})
+	return data, err
+}
+
+// Listen will start an AppSync event listener that handles incoming resolver invocations (not BatchInvoke)
+func (r *AppSyncRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewAppSyncRouter simply returns a new AppSyncRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewAppSyncRouter(rootHandler ...AppSyncHandler) *AppSyncRouter {
+	r := &AppSyncRouter{
+		handlers: make(map[string]AppSyncHandler),
+	}
+	if len(rootHandler) > 0 {
+		r.rootHandler = rootHandler[0]
+	}
+	return r
+}
+
+// Handle will register a handler for a given parent type name (ie. "Query" or "Post") and field name
+func (r *AppSyncRouter) Handle(parentTypeName string, fieldName string, handler AppSyncHandler) {
+	if r.handlers == nil {
+		r.handlers = make(map[string]AppSyncHandler)
+	}
+	r.handlers[appSyncHandlerKey(parentTypeName, fieldName)] = handler
+}
+
+// Query is the same as Handle only the Query type is already implied.
+func (r *AppSyncRouter) Query(fieldName string, handler AppSyncHandler) {
+	r.Handle("Query", fieldName, handler)
+}
+
+// Mutation is the same as Handle only the Mutation type is already implied.
+func (r *AppSyncRouter) Mutation(fieldName string, handler AppSyncHandler) {
+	r.Handle("Mutation", fieldName, handler)
+}
+
+// appSyncHandlerKey returns the handlers map key for a parent type name and field name
+func appSyncHandlerKey(parentTypeName string, fieldName string) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(parentTypeName)
+	buffer.WriteString(".")
+	buffer.WriteString(fieldName)
+	return buffer.String()
+}
+
+// UnmarshalArguments will decode the field's arguments into v (using JSON struct tags)
+func (evt *AppSyncResolverEvent) UnmarshalArguments(v interface{}) error {
+	return remarshal(evt.Arguments, v)
+}
+
+// UnmarshalSource will decode the parent object (for nested fields) into v (using JSON struct tags)
+func (evt *AppSyncResolverEvent) UnmarshalSource(v interface{}) error {
+	return remarshal(evt.Source, v)
+}
+
+// remarshal converts a value to another type by way of JSON
+func remarshal(in interface{}, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
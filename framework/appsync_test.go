@@ -0,0 +1,118 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAppSyncRouter(t *testing.T) {
+
+	newEvent := func(parentTypeName string, fieldName string, arguments map[string]interface{}, source map[string]interface{}) AppSyncResolverEvent {
+		return AppSyncResolverEvent{
+			Arguments: arguments,
+			Source:    source,
+			Identity:  &AppSyncIdentity{Sub: "user-123", Username: "tom"},
+			Info:      AppSyncInfo{ParentTypeName: parentTypeName, FieldName: fieldName},
+		}
+	}
+
+	router := NewAppSyncRouter()
+	router.Tracer = &errorTraceStrategy{}
+	router.Query("getPost", func(ctx context.Context, d *HandlerDependencies, evt *AppSyncResolverEvent) (interface{}, error) {
+		var args struct {
+			ID string `json:"id"`
+		}
+		if err := evt.UnmarshalArguments(&args); err != nil {
+			return nil, err
+		}
+		if args.ID == "missing" {
+			return nil, AppSyncError{Type: "NotFound", Message: "post not found"}
+		}
+		return map[string]interface{}{"id": args.ID, "author": evt.Identity.Username}, nil
+	})
+	router.Handle("Post", "comments", func(ctx context.Context, d *HandlerDependencies, evt *AppSyncResolverEvent) (interface{}, error) {
+		var post struct {
+			ID string `json:"id"`
+		}
+		evt.UnmarshalSource(&post)
+		return []string{post.ID + "-comment"}, nil
+	})
+
+	Convey("AppSyncRouter", t, func() {
+		Convey("Should route by parent type and field name", func() {
+			data, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("Query", "getPost", map[string]interface{}{"id": "1"}, nil))
+			So(err, ShouldBeNil)
+			So(data, ShouldResemble, map[string]interface{}{"id": "1", "author": "tom"})
+
+			data, err = router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("Post", "comments", nil, map[string]interface{}{"id": "1"}))
+			So(err, ShouldBeNil)
+			So(data, ShouldResemble, []string{"1-comment"})
+		})
+
+		Convey("Should return an error without a resolver", func() {
+			_, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("Query", "unknown", nil, nil))
+			So(err.Error(), ShouldEqual, "no resolver for Query.unknown")
+		})
+
+		Convey("Should return per item errors for batches", func() {
+			results, err := router.BatchLambdaHandler(context.Background(), &HandlerDependencies{}, []AppSyncResolverEvent{
+				newEvent("Query", "getPost", map[string]interface{}{"id": "1"}, nil),
+				newEvent("Query", "getPost", map[string]interface{}{"id": "missing"}, nil),
+			})
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Data, ShouldNotBeNil)
+			So(results[0].ErrorMessage, ShouldEqual, "")
+			So(results[1].ErrorMessage, ShouldEqual, "post not found")
+			So(results[1].ErrorType, ShouldEqual, "NotFound")
+		})
+	})
+
+	Convey("Handlers should detect and decode AppSync events", t, func() {
+		raw := []byte(`{
+			"arguments": {"id": "2"},
+			"identity": {"sub": "user-456", "username": "jane", "claims": {"email": "jane@example.com"}, "sourceIp": ["192.0.2.1"]},
+			"source": null,
+			"request": {"headers": {"host": "example.appsync-api.us-east-1.amazonaws.com"}},
+			"info": {"fieldName": "getPost", "parentTypeName": "Query", "variables": {}, "selectionSetList": ["id"]},
+			"prev": null,
+			"stash": {}
+		}`)
+		evt, err := UnmarshalEvent(raw)
+		So(err, ShouldBeNil)
+		So(getType(evt), ShouldEqual, "AppSyncResolverEvent")
+
+		h := Handlers{AppSyncRouter: router}
+		res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, evt)
+		So(err, ShouldBeNil)
+		So(res, ShouldResemble, map[string]interface{}{"id": "2", "author": "jane"})
+
+		Convey("Should handle BatchInvoke lists", func() {
+			batch, err := UnmarshalEvent([]byte(`[` + string(raw) + `,` + string(raw) + `]`))
+			So(err, ShouldBeNil)
+			So(batch, ShouldContainKey, BatchEventKey)
+			So(getType(batch), ShouldEqual, "AppSyncResolverEvent")
+
+			res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, batch)
+			So(err, ShouldBeNil)
+			So(res, ShouldHaveLength, 2)
+			So(res.([]AppSyncBatchResult)[1].Data, ShouldResemble, map[string]interface{}{"id": "2", "author": "jane"})
+		})
+	})
+}
@@ -0,0 +1,285 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	// AuthorizerTypeToken is the type of authorizer that receives only the caller's identity token
+	AuthorizerTypeToken = "TOKEN"
+	// AuthorizerTypeRequest is the type of authorizer that receives the request's headers, query string, etc.
+	AuthorizerTypeRequest = "REQUEST"
+)
+
+// ErrAuthorizerUnauthorized is the error API Gateway expects from an authorizer in order to respond with a 401
+var ErrAuthorizerUnauthorized = errors.New("Unauthorized")
+
+// APIGatewayCustomAuthorizerRequest is an incoming API Gateway Lambda authorizer event. The events package has separate
+// types for TOKEN and REQUEST authorizers, this combines them so one handler signature works for both.
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/api-gateway-lambda-authorizer-input.html
+type APIGatewayCustomAuthorizerRequest struct {
+	events.APIGatewayCustomAuthorizerRequestTypeRequest
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+// AuthorizerRouter struct provides an interface to handle API Gateway Lambda authorizer events (routers can be for
+// a specific authorizer type or both). Handlers are matched by the method and resource being invoked.
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/apigateway-use-lambda-authorizer.html
+type AuthorizerRouter struct {
+	handlers    []authorizerRoute
+	rootHandler AuthorizerHandler
+	Type        string
+	Tracer      TraceStrategy
+}
+
+// AuthorizerHandler handles authorizer events. The response's policy document should be built with Allow() and Deny().
+// Returning ErrAuthorizerUnauthorized will result in a 401 response from API Gateway, any other error in a 500.
+type AuthorizerHandler func(context.Context, *HandlerDependencies, *APIGatewayCustomAuthorizerRequest, *APIGatewayCustomAuthorizerResponse) error
+
+// authorizerRoute is a registered handler with its method and resource path globs
+type authorizerRoute struct {
+	handler  AuthorizerHandler
+	method   string
+	resource string
+}
+
+// MethodArn is a parsed API Gateway method ARN, ie. arn:aws:execute-api:{region}:{account}:{api-id}/{stage}/{method}/{resource}
+type MethodArn struct {
+	Partition string
+	Region    string
+	AccountID string
+	APIID     string
+	Stage     string
+	Method    string
+	Resource  string
+}
+
+func init() {
+	// Authorizer events have a "type" of TOKEN or REQUEST and a "methodArn".
+	// REQUEST authorizer events look like API Gateway proxy requests, so they must be detected first.
+	RegisterEventType(EventType{
+		Name:     "APIGatewayCustomAuthorizerRequest",
+		Priority: 90,
+		Detect:   isAuthorizerRequest,
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e APIGatewayCustomAuthorizerRequest
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.AuthorizerRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.AuthorizerRouter.LambdaHandler(ctx, d, evt.(APIGatewayCustomAuthorizerRequest))
+		},
+	})
+}
+
+// isAuthorizerRequest returns true if the event is an API Gateway Lambda authorizer event
+func isAuthorizerRequest(evt map[string]interface{}) bool {
+	t, _ := evt["type"].(string)
+	return (t == AuthorizerTypeToken || t == AuthorizerTypeRequest) && keyInMap("methodArn", evt)
+}
+
+// LambdaHandler handles API Gateway Lambda authorizer events. The first handler matching the method and resource
+// from the method ARN is used, in the order they were registered, then the router's root handler.
+// If no handler matches, the request is unauthorized.
+func (r *AuthorizerRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, req APIGatewayCustomAuthorizerRequest) (APIGatewayCustomAuthorizerResponse, error) {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return APIGatewayCustomAuthorizerResponse{}, errors.New("no handlers registered for AuthorizerRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	res := NewAPIGatewayCustomAuthorizerResponse("")
+	// If a type was defined for the router, other types of authorizer events are not handled
+	if r.Type != "" && r.Type != req.Type {
+		return res, ErrAuthorizerUnauthorized
+	}
+
+	arn := ParseMethodArn(req.MethodArn)
+	handler := r.rootHandler
+	fallthroughHandler := true
+	for _, route := range r.handlers {
+		if globMatch(route.method, arn.Method) && globMatch(route.resource, arn.Resource) {
+			handler = route.handler
+			fallthroughHandler = false
+			break
+		}
+	}
+	if handler == nil {
+		return res, ErrAuthorizerUnauthorized
+	}
+
+	d.Tracer.Record("annotation",
+		map[string]interface{}{
+			"AuthorizerType":     req.Type,
+			"AuthorizerMethod":   arn.Method,
+			"AuthorizerResource": arn.Resource,
+			"FallthroughHandler": fallthroughHandler,
+		},
+	)
+	err := d.Tracer.Capture(ctx, "AuthorizerHandler", func(ctx1 context.Context) error {
+		return handler(ctx1, d, &req, &res)
+	})
+
+	return res, err
+}
+
+// Listen will start an authorizer event listener that handles incoming API Gateway Lambda authorizer events
+func (r *AuthorizerRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewAuthorizerRouter simply returns a new AuthorizerRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewAuthorizerRouter(rootHandler ...AuthorizerHandler) *AuthorizerRouter {
+	r := &AuthorizerRouter{}
+	if len(rootHandler) > 0 {
+		r.rootHandler = rootHandler[0]
+	}
+	return r
+}
+
+// NewAuthorizerRouterForType is the same as NewAuthorizerRouter except it's for a specific type of authorizer (TOKEN or REQUEST)
+func NewAuthorizerRouterForType(authorizerType string, rootHandler ...AuthorizerHandler) *AuthorizerRouter {
+	r := NewAuthorizerRouter(rootHandler...)
+	r.Type = authorizerType
+	return r
+}
+
+// Handle will register a handler for a given HTTP method and resource path, both of which can be globs (empty matches all)
+func (r *AuthorizerRouter) Handle(method string, resource string, handler AuthorizerHandler) {
+	r.handlers = append(r.handlers, authorizerRoute{
+		handler:  handler,
+		method:   strings.ToUpper(method),
+		resource: resource,
+	})
+}
+
+// ParseMethodArn parses an API Gateway method ARN. The resource path will always begin with a slash.
+func ParseMethodArn(methodArn string) MethodArn {
+	var arn MethodArn
+	p := strings.SplitN(methodArn, ":", 6)
+	if len(p) < 6 {
+		return arn
+	}
+	arn.Partition = p[1]
+	arn.Region = p[3]
+	arn.AccountID = p[4]
+
+	r := strings.SplitN(p[5], "/", 4)
+	arn.APIID = r[0]
+	if len(r) > 1 {
+		arn.Stage = r[1]
+	}
+	if len(r) > 2 {
+		arn.Method = r[2]
+	}
+	arn.Resource = "/"
+	if len(r) > 3 {
+		arn.Resource += r[3]
+	}
+	return arn
+}
+
+// String returns the method ARN
+func (a MethodArn) String() string {
+	return "arn:" + a.Partition + ":execute-api:" + a.Region + ":" + a.AccountID + ":" + a.APIID + "/" + a.Stage + "/" + a.Method + "/" + strings.TrimPrefix(a.Resource, "/")
+}
+
+// Arn returns a method ARN for the same API and stage as the request, but for the given HTTP method and resource path.
+// Either can be a "*" wildcard, ie. Arn("*", "*") covers the entire API stage and Arn("GET", "/users/*") covers
+// reading any user.
+func (req *APIGatewayCustomAuthorizerRequest) Arn(method string, resource string) string {
+	arn := ParseMethodArn(req.MethodArn)
+	arn.Method = strings.ToUpper(method)
+	arn.Resource = resource
+	return arn.String()
+}
+
+// Token returns the caller's token, either from the TOKEN authorizer's authorizationToken or from the Authorization
+// header for REQUEST authorizers. A "Bearer " prefix will be removed.
+func (req *APIGatewayCustomAuthorizerRequest) Token() string {
+	t := req.AuthorizationToken
+	if t == "" {
+		for k, v := range req.Headers {
+			if strings.EqualFold(k, "Authorization") {
+				t = v
+				break
+			}
+		}
+	}
+	if len(t) > 7 && strings.EqualFold(t[:7], "Bearer ") {
+		t = t[7:]
+	}
+	return t
+}
+
+// NewAPIGatewayCustomAuthorizerResponse returns a new authorizer response for the given principal with an empty policy document
+func NewAPIGatewayCustomAuthorizerResponse(principalID string) APIGatewayCustomAuthorizerResponse {
+	return APIGatewayCustomAuthorizerResponse{
+		PrincipalID: principalID,
+		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
+			Version:   "2012-10-17",
+			Statement: []events.IAMPolicyStatement{},
+		},
+	}
+}
+
+// Allow adds a statement to the policy document allowing execute-api:Invoke for the given method ARNs
+func (res *APIGatewayCustomAuthorizerResponse) Allow(methodArns ...string) {
+	res.addStatement("Allow", methodArns)
+}
+
+// Deny adds a statement to the policy document denying execute-api:Invoke for the given method ARNs
+func (res *APIGatewayCustomAuthorizerResponse) Deny(methodArns ...string) {
+	res.addStatement("Deny", methodArns)
+}
+
+// addStatement adds an execute-api:Invoke statement to the policy document
+func (res *APIGatewayCustomAuthorizerResponse) addStatement(effect string, methodArns []string) {
+	if len(methodArns) == 0 {
+		return
+	}
+	if res.PolicyDocument.Version == "" {
+		res.PolicyDocument.Version = "2012-10-17"
+	}
+	res.PolicyDocument.Statement = append(res.PolicyDocument.Statement, events.IAMPolicyStatement{
+		Action:   []string{"execute-api:Invoke"},
+		Effect:   effect,
+		Resource: methodArns,
+	})
+}
+
+// SetContext sets a value in the context passed along to the API's integration (available as
+// requestContext.authorizer in proxy requests). API Gateway only allows string, number and boolean values.
+func (res *APIGatewayCustomAuthorizerResponse) SetContext(key string, value interface{}) {
+	if res.Context == nil {
+		res.Context = make(map[string]interface{})
+	}
+	res.Context[key] = value
+}
@@ -0,0 +1,142 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthorizerRouter(t *testing.T) {
+	methodArn := "arn:aws:execute-api:us-east-1:123456789012:a1b2c3/prod/GET/users/123"
+
+	newRequest := func(authorizerType string, method string, resource string, token string) APIGatewayCustomAuthorizerRequest {
+		req := APIGatewayCustomAuthorizerRequest{AuthorizationToken: token}
+		req.Type = authorizerType
+		req.MethodArn = "arn:aws:execute-api:us-east-1:123456789012:a1b2c3/prod/" + method + resource
+		return req
+	}
+
+	router := NewAuthorizerRouter()
+	router.Tracer = &errorTraceStrategy{}
+	router.Handle("GET", "/users/*", func(ctx context.Context, d *HandlerDependencies, req *APIGatewayCustomAuthorizerRequest, res *APIGatewayCustomAuthorizerResponse) error {
+		if req.Token() != "secret" {
+			return ErrAuthorizerUnauthorized
+		}
+		res.PrincipalID = "user"
+		res.Allow(req.Arn("GET", "/users/*"))
+		res.Deny(req.Arn("*", "/admin/*"))
+		res.SetContext("role", "reader")
+		return nil
+	})
+	router.Handle("", "", func(ctx context.Context, d *HandlerDependencies, req *APIGatewayCustomAuthorizerRequest, res *APIGatewayCustomAuthorizerResponse) error {
+		res.Deny(req.MethodArn)
+		return nil
+	})
+
+	Convey("ParseMethodArn()", t, func() {
+		arn := ParseMethodArn(methodArn)
+		So(arn.Region, ShouldEqual, "us-east-1")
+		So(arn.AccountID, ShouldEqual, "123456789012")
+		So(arn.APIID, ShouldEqual, "a1b2c3")
+		So(arn.Stage, ShouldEqual, "prod")
+		So(arn.Method, ShouldEqual, "GET")
+		So(arn.Resource, ShouldEqual, "/users/123")
+		So(arn.String(), ShouldEqual, methodArn)
+
+		So(ParseMethodArn("arn:aws:execute-api:us-east-1:123456789012:a1b2c3/prod/GET/").Resource, ShouldEqual, "/")
+		So(ParseMethodArn("invalid").APIID, ShouldEqual, "")
+	})
+
+	Convey("APIGatewayCustomAuthorizerRequest", t, func() {
+		Convey("Arn() should build method ARNs for the same API and stage", func() {
+			req := newRequest(AuthorizerTypeToken, "GET", "/users/123", "")
+			So(req.Arn("*", "*"), ShouldEqual, "arn:aws:execute-api:us-east-1:123456789012:a1b2c3/prod/*/*")
+			So(req.Arn("post", "/users"), ShouldEqual, "arn:aws:execute-api:us-east-1:123456789012:a1b2c3/prod/POST/users")
+		})
+
+		Convey("Token() should get the token from either type of authorizer", func() {
+			req := newRequest(AuthorizerTypeToken, "GET", "/", "Bearer abc")
+			So(req.Token(), ShouldEqual, "abc")
+
+			req = newRequest(AuthorizerTypeRequest, "GET", "/", "")
+			req.Headers = map[string]string{"authorization": "def"}
+			So(req.Token(), ShouldEqual, "def")
+		})
+	})
+
+	Convey("AuthorizerRouter", t, func() {
+		Convey("Should build a policy document with the matching handler", func() {
+			res, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newRequest(AuthorizerTypeToken, "GET", "/users/123", "secret"))
+			So(err, ShouldBeNil)
+			So(res.PrincipalID, ShouldEqual, "user")
+			So(res.PolicyDocument.Version, ShouldEqual, "2012-10-17")
+			So(res.PolicyDocument.Statement, ShouldHaveLength, 2)
+			So(res.PolicyDocument.Statement[0].Effect, ShouldEqual, "Allow")
+			So(res.PolicyDocument.Statement[0].Action, ShouldResemble, []string{"execute-api:Invoke"})
+			So(res.PolicyDocument.Statement[0].Resource, ShouldResemble, []string{"arn:aws:execute-api:us-east-1:123456789012:a1b2c3/prod/GET/users/*"})
+			So(res.PolicyDocument.Statement[1].Effect, ShouldEqual, "Deny")
+			So(res.Context["role"], ShouldEqual, "reader")
+		})
+
+		Convey("Should return unauthorized errors from handlers", func() {
+			_, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newRequest(AuthorizerTypeToken, "GET", "/users/123", "wrong"))
+			So(err, ShouldEqual, ErrAuthorizerUnauthorized)
+		})
+
+		Convey("Should use handlers in the order they were registered", func() {
+			res, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newRequest(AuthorizerTypeToken, "POST", "/users", "secret"))
+			So(err, ShouldBeNil)
+			So(res.PolicyDocument.Statement[0].Effect, ShouldEqual, "Deny")
+		})
+
+		Convey("Should be unauthorized when no handler matches", func() {
+			r := NewAuthorizerRouterForType(AuthorizerTypeRequest)
+			r.Tracer = &errorTraceStrategy{}
+			r.Handle("GET", "*", router.handlers[0].handler)
+			_, err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, newRequest(AuthorizerTypeRequest, "DELETE", "/users/123", "secret"))
+			So(err, ShouldEqual, ErrAuthorizerUnauthorized)
+
+			// The router is only for REQUEST authorizers
+			_, err = r.LambdaHandler(context.Background(), &HandlerDependencies{}, newRequest(AuthorizerTypeToken, "GET", "/users/123", "secret"))
+			So(err, ShouldEqual, ErrAuthorizerUnauthorized)
+		})
+	})
+
+	Convey("Handlers should detect and decode authorizer events", t, func() {
+		evt := map[string]interface{}{
+			"type":       "REQUEST",
+			"methodArn":  methodArn,
+			"resource":   "/users/{id}",
+			"path":       "/users/123",
+			"httpMethod": "GET",
+			"headers":    map[string]interface{}{"Authorization": "Bearer secret"},
+			"requestContext": map[string]interface{}{
+				"path":       "/prod/users/123",
+				"stage":      "prod",
+				"httpMethod": "GET",
+			},
+		}
+		So(getType(evt), ShouldEqual, "APIGatewayCustomAuthorizerRequest")
+		So(getType(map[string]interface{}{"type": "TOKEN", "methodArn": methodArn, "authorizationToken": "secret"}), ShouldEqual, "APIGatewayCustomAuthorizerRequest")
+
+		h := Handlers{AuthorizerRouter: router}
+		res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, evt)
+		So(err, ShouldBeNil)
+		So(res.(APIGatewayCustomAuthorizerResponse).PrincipalID, ShouldEqual, "user")
+	})
+}
@@ -0,0 +1,565 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxFormMemory is how much of a multipart form body is kept in memory, Lambda's payload limit is lower anyway
+const maxFormMemory = 6 << 20
+
+// emailPattern is a simple check for the email validation rule, it's not meant to catch every invalid address
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// FieldError is a problem with a single field of a bound struct
+type FieldError struct {
+	// Field is the name of the field in the request, ie. its JSON or query string name
+	Field string `json:"field" xml:"field"`
+	// Rule is the validation rule that failed, empty if the value couldn't be read at all
+	Rule    string `json:"rule,omitempty" xml:"rule,omitempty"`
+	Message string `json:"message" xml:"message"`
+}
+
+// BindingError is returned by Bind() and Validate() when the request is invalid. The Status is 400 Bad Request when
+// the request couldn't be read (ie. malformed JSON or a query string param that isn't a number) and 422 Unprocessable
+// Entity when it doesn't pass validation. Use APIGatewayProxyResponse.BindingError() to respond with it.
+type BindingError struct {
+	Status  int          `json:"-" xml:"-"`
+	Message string       `json:"error" xml:"message"`
+	Fields  []FieldError `json:"fields,omitempty" xml:"fields>field,omitempty"`
+}
+
+// Error returns the error message with the field errors
+func (e *BindingError) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = f.Field + " " + f.Message
+	}
+	return e.Message + ": " + strings.Join(messages, ", ")
+}
+
+// Bind fills v, a pointer to a struct, from the request and then validates it (see Validate()). The body is decoded
+// based on its content type; JSON and XML bodies use the json and xml struct tags, form bodies use the form tag.
+// Then fields with a path, query or header tag are set from the path params, query string and headers. A field with
+// more than one of those tags is set from the first that has a value, in that order (path, query, header), ie.
+//
+//	type UpdatePost struct {
+//	    ID     int      `path:"id"`
+//	    Draft  bool     `query:"draft"`
+//	    APIKey string   `header:"X-Api-Key" validate:"required"`
+//	    Title  string   `json:"title" validate:"required,max=100"`
+//	    Tags   []string `json:"tags" validate:"max=5"`
+//	}
+//
+// Fields set from strings can be strings, bools, numbers, slices of those (for repeated query string params) or
+// implement encoding.TextUnmarshaler (ie. time.Time). Errors for invalid requests are a *BindingError.
+func (req *APIGatewayProxyRequest) Bind(params url.Values, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("bind requires a pointer to a struct")
+	}
+
+	h := http.Header{}
+	for k, val := range req.Headers {
+		h.Set(k, val)
+	}
+	for k, vals := range req.MultiValueHeaders {
+		h.Del(k)
+		for _, val := range vals {
+			h.Add(k, val)
+		}
+	}
+	query := url.Values{}
+	for k, val := range req.QueryStringParameters {
+		query.Set(k, val)
+	}
+	for k, vals := range req.MultiValueQueryStringParameters {
+		query[k] = vals
+	}
+
+	sources := []bindSource{
+		{tag: "path", values: func(key string) []string { return params[key] }},
+		{tag: "query", values: func(key string) []string { return query[key] }},
+		{tag: "header", values: func(key string) []string { return h[http.CanonicalHeaderKey(key)] }},
+	}
+
+	// The body is decoded into a copy, so it can't set the fields that come from the sources (ie. an isAdmin field set
+	// from a header), even when the request has no value for them
+	body := reflect.New(rv.Elem().Type())
+	body.Elem().Set(rv.Elem())
+	if err := req.bindBody(body.Interface()); err != nil {
+		return err
+	}
+	copyBodyFields(rv.Elem(), body.Elem(), sources)
+
+	bindErr := &BindingError{Status: 400, Message: "invalid request"}
+	bindValues(rv.Elem(), sources, bindErr)
+	if len(bindErr.Fields) > 0 {
+		return bindErr
+	}
+
+	return Validate(v)
+}
+
+// bindBody decodes the request body into v based on the content type, an empty body is left alone
+func (req *APIGatewayProxyRequest) bindBody(v interface{}) error {
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		b, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return &BindingError{Status: 400, Message: "invalid body encoding"}
+		}
+		body = b
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	mediaType, mediaParams, _ := mime.ParseMediaType(req.GetHeader(HeaderContentType))
+	switch {
+	case mediaType == "" || mediaType == MIMEApplicationJSON || strings.HasSuffix(mediaType, "+json"):
+		if err := json.Unmarshal(body, v); err != nil {
+			bindErr := &BindingError{Status: 400, Message: "invalid JSON body"}
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) && typeErr.Field != "" {
+				bindErr.Fields = append(bindErr.Fields, FieldError{Field: typeErr.Field, Message: "must be a " + jsonTypeName(typeErr.Type)})
+			}
+			return bindErr
+		}
+	case mediaType == MIMEApplicationXML || mediaType == "text/xml":
+		if err := xml.Unmarshal(body, v); err != nil {
+			return &BindingError{Status: 400, Message: "invalid XML body"}
+		}
+	case mediaType == MIMEApplicationForm:
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return &BindingError{Status: 400, Message: "invalid form body"}
+		}
+		return bindForm(v, form)
+	case mediaType == MIMEMultipartForm:
+		form, err := multipart.NewReader(bytes.NewReader(body), mediaParams["boundary"]).ReadForm(maxFormMemory)
+		if err != nil {
+			return &BindingError{Status: 400, Message: "invalid form body"}
+		}
+		defer form.RemoveAll()
+		return bindForm(v, form.Value)
+	default:
+		return &BindingError{Status: 415, Message: "unsupported content type " + mediaType}
+	}
+	return nil
+}
+
+// bindForm sets the fields with a form tag from form values
+func bindForm(v interface{}, form url.Values) error {
+	bindErr := &BindingError{Status: 400, Message: "invalid form body"}
+	bindValues(reflect.ValueOf(v).Elem(), []bindSource{
+		{tag: "form", values: func(key string) []string { return form[key] }},
+	}, bindErr)
+	if len(bindErr.Fields) > 0 {
+		return bindErr
+	}
+	return nil
+}
+
+// bindSource is where values for fields with its struct tag come from, values returns the values for the tag's key
+type bindSource struct {
+	tag    string
+	values func(string) []string
+}
+
+// bindValues sets the struct's fields tagged with one of the sources' tags, from the values the source has for the
+// tag's key. A field with more than one of the tags is set from the first source, in order, that has a value for it.
+// Embedded and nested structs are bound too. Values that can't be converted are added to bindErr.
+func bindValues(rv reflect.Value, sources []bindSource, bindErr *BindingError) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		fv := rv.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		bound := false
+		for _, source := range sources {
+			key := field.Tag.Get(source.tag)
+			if key == "" || key == "-" || !fv.CanSet() {
+				continue
+			}
+			bound = true
+			vals := source.values(key)
+			if len(vals) == 0 {
+				continue
+			}
+			if err := setValue(fv, vals); err != nil {
+				bindErr.Fields = append(bindErr.Fields, FieldError{Field: key, Message: err.Error()})
+			}
+			break
+		}
+
+		// Look for tagged fields in structs, unless they are set from a string (ie. time.Time)
+		if !bound && fv.Kind() == reflect.Struct && !isTextUnmarshaler(fv) {
+			bindValues(fv, sources, bindErr)
+		}
+	}
+}
+
+// copyBodyFields copies the fields decoded from the body from src to dst, except those tagged with one of the sources'
+// tags. Structs with such fields are copied field by field, other values are copied whole.
+func copyBodyFields(dst reflect.Value, src reflect.Value, sources []bindSource) {
+	rt := dst.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if (field.PkgPath != "" && !field.Anonymous) || hasSourceTag(field, sources) {
+			continue
+		}
+		df := dst.Field(i)
+		if df.Kind() == reflect.Struct && !isTextUnmarshaler(df) && hasSourceFields(df.Type(), sources) {
+			copyBodyFields(df, src.Field(i), sources)
+			continue
+		}
+		if df.CanSet() {
+			df.Set(src.Field(i))
+		}
+	}
+}
+
+// hasSourceTag returns true if the field is tagged with one of the sources' tags
+func hasSourceTag(field reflect.StructField, sources []bindSource) bool {
+	for _, source := range sources {
+		if key := field.Tag.Get(source.tag); key != "" && key != "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSourceFields returns true if the struct, or a struct in it that bindValues() looks at, has a field tagged with
+// one of the sources' tags
+func hasSourceFields(t reflect.Type, sources []bindSource) bool {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		if hasSourceTag(field, sources) {
+			return true
+		}
+		if field.Type.Kind() == reflect.Struct && !reflect.PtrTo(field.Type).Implements(textUnmarshalerType) &&
+			hasSourceFields(field.Type, sources) {
+			return true
+		}
+	}
+	return false
+}
+
+// setValue sets a field from string values, the last one is used unless the field is a slice
+func setValue(fv reflect.Value, vals []string) error {
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setString(slice.Index(i), val); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setString(fv, vals[len(vals)-1])
+}
+
+// setString sets a field from a string value
+func setString(fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Ptr {
+		ptr := reflect.New(fv.Type().Elem())
+		if err := setString(ptr.Elem(), s); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+	if isTextUnmarshaler(fv) {
+		if err := fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return errors.New("is invalid")
+		}
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be a positive integer")
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		fv.SetFloat(n)
+	default:
+		return errors.New("can't be set from a string")
+	}
+	return nil
+}
+
+// textUnmarshalerType is the encoding.TextUnmarshaler interface type
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isTextUnmarshaler returns true if a pointer to the value implements encoding.TextUnmarshaler
+func isTextUnmarshaler(fv reflect.Value) bool {
+	return fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType)
+}
+
+// jsonTypeName returns the JSON name for a Go type, used in error messages
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+// Validate checks the fields of v, a struct or pointer to a struct, against the rules in their validate tags.
+// Rules are separated by commas, ie. `validate:"required,min=3,max=50"`. The rules are:
+//
+//	required      the value must not be empty (the zero value or a nil pointer)
+//	min=n, max=n  the minimum and maximum for numbers, or length for strings, slices and maps
+//	len=n         the exact length for strings, slices and maps
+//	oneof=a b c   the value must be one of the values separated by spaces
+//	email         the value must look like an email address
+//
+// Rules other than required are only checked for values that aren't empty. Nested structs are validated too.
+// Errors for invalid values are a *BindingError, with a 422 status.
+func Validate(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return errors.New("validate requires a struct")
+	}
+	bindErr := &BindingError{Status: 422, Message: "validation failed"}
+	if err := validateStruct(rv, "", bindErr); err != nil {
+		return err
+	}
+	if len(bindErr.Fields) > 0 {
+		return bindErr
+	}
+	return nil
+}
+
+// validateStruct validates each field of a struct, prefix is the path to the struct (ie. "author.")
+func validateStruct(rv reflect.Value, prefix string, bindErr *BindingError) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		fv := rv.Field(i)
+		name := prefix + fieldName(field)
+
+		if rules := field.Tag.Get("validate"); rules != "" && rules != "-" {
+			for _, rule := range strings.Split(rules, ",") {
+				message, err := checkRule(fv, rule)
+				if err != nil {
+					return fmt.Errorf("field %s: %s", name, err)
+				}
+				if message != "" {
+					ruleName := strings.SplitN(rule, "=", 2)[0]
+					bindErr.Fields = append(bindErr.Fields, FieldError{Field: name, Rule: ruleName, Message: message})
+					// Only the first failed rule is reported for each field
+					break
+				}
+			}
+		}
+
+		// Validate nested structs, embedded struct fields keep the parent's prefix
+		for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && !isTextUnmarshaler(fv) {
+			nestedPrefix := name + "."
+			if field.Anonymous && field.Tag.Get("json") == "" {
+				nestedPrefix = prefix
+			}
+			if err := validateStruct(fv, nestedPrefix, bindErr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fieldName returns the name of a field in the request, from the first tag that names it, or the Go field name
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"path", "query", "header", "form", "json", "xml"} {
+		name := strings.Split(field.Tag.Get(tag), ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// checkRule returns a message if the value doesn't pass the rule. An error is returned for an invalid rule.
+func checkRule(fv reflect.Value, rule string) (string, error) {
+	parts := strings.SplitN(strings.TrimSpace(rule), "=", 2)
+	ruleName := parts[0]
+	arg := ""
+	if len(parts) == 2 {
+		arg = parts[1]
+	}
+
+	empty := fv.IsZero()
+	if ruleName == "required" {
+		if empty {
+			return "is required", nil
+		}
+		return "", nil
+	}
+	if empty {
+		return "", nil
+	}
+	for fv.Kind() == reflect.Ptr {
+		fv = fv.Elem()
+	}
+
+	switch ruleName {
+	case "min", "max", "len":
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s rule %q", ruleName, rule)
+		}
+		value, isLength, ok := ruleValue(fv)
+		if !ok || (ruleName == "len" && !isLength) {
+			return "", fmt.Errorf("the %s rule can't be used for a %s", ruleName, fv.Kind())
+		}
+		unit := ""
+		if isLength {
+			unit = " in length"
+			if fv.Kind() == reflect.String {
+				unit = " characters"
+			}
+		}
+		switch {
+		case ruleName == "min" && value < n:
+			return "must be at least " + arg + unit, nil
+		case ruleName == "max" && value > n:
+			return "must be at most " + arg + unit, nil
+		case ruleName == "len" && value != n:
+			return "must be exactly " + arg + unit, nil
+		}
+	case "oneof":
+		s := fmt.Sprint(fv.Interface())
+		options := strings.Fields(arg)
+		for _, option := range options {
+			if s == option {
+				return "", nil
+			}
+		}
+		return "must be one of " + strings.Join(options, ", "), nil
+	case "email":
+		if fv.Kind() != reflect.String {
+			return "", fmt.Errorf("the email rule can't be used for a %s", fv.Kind())
+		}
+		if !emailPattern.MatchString(fv.String()) {
+			return "must be a valid email address", nil
+		}
+	default:
+		return "", fmt.Errorf("unknown validation rule %q", ruleName)
+	}
+	return "", nil
+}
+
+// ruleValue returns the number the min, max and len rules compare, which is the length for strings, slices and maps
+func ruleValue(fv reflect.Value) (float64, bool, bool) {
+	switch fv.Kind() {
+	case reflect.String:
+		return float64(len([]rune(fv.String()))), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(fv.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), false, true
+	}
+	return 0, false, false
+}
+
+// BindingError responds with an error from Bind() or Validate(). A *BindingError is sent as JSON (or XML if the
+// response's content type was set to XML) with its status and field errors, ie.
+// {"error": "validation failed", "fields": [{"field": "title", "rule": "required", "message": "is required"}]}
+// Any other error is a 500 Internal Server Error, since it means Bind() was used incorrectly.
+func (res *APIGatewayProxyResponse) BindingError(err error) {
+	var bindErr *BindingError
+	if !errors.As(err, &bindErr) {
+		res.Error(500, err)
+		return
+	}
+	switch res.GetHeader(HeaderContentType) {
+	case MIMEApplicationXML, MIMEApplicationXMLCharsetUTF8:
+		type xmlBindingError struct {
+			XMLName xml.Name `xml:"error"`
+			*BindingError
+		}
+		res.XML(bindErr.Status, xmlBindingError{BindingError: bindErr})
+	default:
+		res.JSON(bindErr.Status, bindErr)
+	}
+}
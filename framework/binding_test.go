@@ -0,0 +1,206 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type bindingTestAuthor struct {
+	Email string `json:"email" xml:"email" validate:"required,email"`
+}
+
+type bindingTestPost struct {
+	ID        int                `path:"id"`
+	Draft     *bool              `query:"draft"`
+	Tags      []string           `query:"tag" validate:"max=2"`
+	Since     time.Time          `query:"since"`
+	APIKey    string             `header:"X-Api-Key" validate:"required"`
+	Title     string             `json:"title" xml:"title" form:"title" validate:"required,min=3,max=20"`
+	Status    string             `json:"status" xml:"status" form:"status" validate:"oneof=draft published"`
+	Rating    int                `json:"rating" xml:"rating" form:"rating" validate:"min=1,max=5"`
+	Author    *bindingTestAuthor `json:"author" xml:"author"`
+	NotBound  string
+	unexposed string
+}
+
+func TestBind(t *testing.T) {
+	newRequest := func(contentType string, body string) *APIGatewayProxyRequest {
+		return &APIGatewayProxyRequest{
+			Headers:               map[string]string{"content-type": contentType, "x-api-key": "secret"},
+			QueryStringParameters: map[string]string{"draft": "true", "since": "2019-01-02T15:04:05Z"},
+			MultiValueQueryStringParameters: map[string][]string{
+				"tag": {"go", "aws"},
+			},
+			Body: body,
+		}
+	}
+	params := url.Values{"id": []string{"42"}}
+
+	Convey("Bind()", t, func() {
+		Convey("Should bind path params, the query string, headers and a JSON body", func() {
+			var post bindingTestPost
+			req := newRequest(MIMEApplicationJSON, `{"title": "Hello", "status": "draft", "rating": 5, "author": {"email": "tom@example.com"}}`)
+			So(req.Bind(params, &post), ShouldBeNil)
+			So(post.ID, ShouldEqual, 42)
+			So(*post.Draft, ShouldBeTrue)
+			So(post.Tags, ShouldResemble, []string{"go", "aws"})
+			So(post.Since.Year(), ShouldEqual, 2019)
+			So(post.APIKey, ShouldEqual, "secret")
+			So(post.Title, ShouldEqual, "Hello")
+			So(post.Author.Email, ShouldEqual, "tom@example.com")
+		})
+
+		Convey("Should use the first of the path params, query string and headers that has a value", func() {
+			var ref struct {
+				Ref string `path:"ref" query:"ref" header:"X-Ref"`
+			}
+			req := newRequest(MIMEApplicationJSON, "")
+			req.QueryStringParameters["ref"] = "query"
+			req.Headers["x-ref"] = "header"
+			So(req.Bind(url.Values{"ref": []string{"path"}}, &ref), ShouldBeNil)
+			So(ref.Ref, ShouldEqual, "path")
+			So(req.Bind(url.Values{}, &ref), ShouldBeNil)
+			So(ref.Ref, ShouldEqual, "query")
+			delete(req.QueryStringParameters, "ref")
+			So(req.Bind(url.Values{}, &ref), ShouldBeNil)
+			So(ref.Ref, ShouldEqual, "header")
+		})
+
+		Convey("Should not set fields tagged path, query or header from the body", func() {
+			var user struct {
+				Name    string `json:"name"`
+				IsAdmin bool   `header:"X-Admin"`
+				Nested  struct {
+					Role  string `json:"role" query:"role"`
+					Email string `json:"email"`
+				} `json:"nested"`
+			}
+			req := newRequest(MIMEApplicationJSON, `{"name": "tom", "isadmin": true, "nested": {"role": "admin", "email": "tom@example.com"}}`)
+			So(req.Bind(params, &user), ShouldBeNil)
+			So(user.Name, ShouldEqual, "tom")
+			So(user.IsAdmin, ShouldBeFalse)
+			So(user.Nested.Role, ShouldBeEmpty)
+			So(user.Nested.Email, ShouldEqual, "tom@example.com")
+		})
+
+		Convey("Should bind a base64 encoded body", func() {
+			var post bindingTestPost
+			req := newRequest(MIMEApplicationJSONCharsetUTF8, base64.StdEncoding.EncodeToString([]byte(`{"title": "Hello"}`)))
+			req.IsBase64Encoded = true
+			So(req.Bind(params, &post), ShouldBeNil)
+			So(post.Title, ShouldEqual, "Hello")
+		})
+
+		Convey("Should bind XML and form bodies", func() {
+			var post bindingTestPost
+			So(newRequest(MIMEApplicationXML, `<post><title>Hello XML</title><rating>3</rating></post>`).Bind(params, &post), ShouldBeNil)
+			So(post.Title, ShouldEqual, "Hello XML")
+			So(post.Rating, ShouldEqual, 3)
+
+			post = bindingTestPost{}
+			So(newRequest(MIMEApplicationForm, `title=Hello+form&rating=2`).Bind(params, &post), ShouldBeNil)
+			So(post.Title, ShouldEqual, "Hello form")
+			So(post.Rating, ShouldEqual, 2)
+
+			post = bindingTestPost{}
+			multipartBody := "--xyz\r\nContent-Disposition: form-data; name=\"title\"\r\n\r\nHello multipart\r\n--xyz--\r\n"
+			So(newRequest(MIMEMultipartForm+"; boundary=xyz", multipartBody).Bind(params, &post), ShouldBeNil)
+			So(post.Title, ShouldEqual, "Hello multipart")
+		})
+
+		Convey("Should return a 400 with field details when the request can't be read", func() {
+			var post bindingTestPost
+			err := newRequest(MIMEApplicationJSON, `{"title": 7}`).Bind(params, &post)
+			So(err, ShouldHaveSameTypeAs, &BindingError{})
+			So(err.(*BindingError).Status, ShouldEqual, 400)
+			So(err.(*BindingError).Fields, ShouldResemble, []FieldError{{Field: "title", Message: "must be a string"}})
+
+			err = newRequest(MIMEApplicationJSON, `{"title": "Hello"}`).Bind(url.Values{"id": []string{"abc"}}, &post)
+			So(err.(*BindingError).Status, ShouldEqual, 400)
+			So(err.(*BindingError).Fields, ShouldResemble, []FieldError{{Field: "id", Message: "must be an integer"}})
+
+			err = newRequest(MIMEApplicationJSON, `{"title": `).Bind(params, &post)
+			So(err.(*BindingError).Status, ShouldEqual, 400)
+
+			err = newRequest(MIMEOctetStream, `abc`).Bind(params, &post)
+			So(err.(*BindingError).Status, ShouldEqual, 415)
+		})
+
+		Convey("Should return a 422 with field details when validation fails", func() {
+			var post bindingTestPost
+			req := newRequest(MIMEApplicationJSON, `{"title": "Hi", "status": "deleted", "rating": 9, "author": {"email": "nope"}}`)
+			req.Headers = map[string]string{}
+			req.MultiValueQueryStringParameters["tag"] = []string{"a", "b", "c"}
+			err := req.Bind(params, &post)
+			So(err, ShouldHaveSameTypeAs, &BindingError{})
+			So(err.(*BindingError).Status, ShouldEqual, 422)
+			So(err.(*BindingError).Fields, ShouldResemble, []FieldError{
+				{Field: "tag", Rule: "max", Message: "must be at most 2 in length"},
+				{Field: "X-Api-Key", Rule: "required", Message: "is required"},
+				{Field: "title", Rule: "min", Message: "must be at least 3 characters"},
+				{Field: "status", Rule: "oneof", Message: "must be one of draft, published"},
+				{Field: "rating", Rule: "max", Message: "must be at most 5"},
+				{Field: "author.email", Rule: "email", Message: "must be a valid email address"},
+			})
+		})
+
+		Convey("Should require a pointer to a struct", func() {
+			var post bindingTestPost
+			So(newRequest(MIMEApplicationJSON, "").Bind(params, post), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Validate()", t, func() {
+		Convey("Should only check rules other than required for values that aren't empty", func() {
+			So(Validate(bindingTestPost{APIKey: "secret", Title: "Hello"}), ShouldBeNil)
+		})
+
+		Convey("Should return an error for invalid rules", func() {
+			invalid := struct {
+				Name string `validate:"unknown"`
+			}{Name: "x"}
+			err := Validate(invalid)
+			So(err, ShouldNotBeNil)
+			So(err, ShouldNotHaveSameTypeAs, &BindingError{})
+		})
+	})
+
+	Convey("BindingError()", t, func() {
+		Convey("Should respond with the status and field errors", func() {
+			res := APIGatewayProxyResponse{}
+			res.BindingError(&BindingError{Status: 422, Message: "validation failed", Fields: []FieldError{{Field: "title", Rule: "required", Message: "is required"}}})
+			So(res.StatusCode, ShouldEqual, 422)
+			So(res.Body, ShouldEqual, `{"error":"validation failed","fields":[{"field":"title","rule":"required","message":"is required"}]}`)
+
+			res = APIGatewayProxyResponse{Headers: map[string]string{HeaderContentType: MIMEApplicationXML}}
+			res.BindingError(&BindingError{Status: 400, Message: "invalid request", Fields: []FieldError{{Field: "id", Message: "must be an integer"}}})
+			So(res.StatusCode, ShouldEqual, 400)
+			So(res.Body, ShouldContainSubstring, "<field>id</field>")
+		})
+
+		Convey("Should respond with a 500 for other errors", func() {
+			res := APIGatewayProxyResponse{}
+			res.BindingError(errors.New("bind requires a pointer to a struct"))
+			So(res.StatusCode, ShouldEqual, 500)
+		})
+	})
+}
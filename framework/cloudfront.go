@@ -0,0 +1,309 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	// CloudFrontViewerRequest is the event type for functions triggered when CloudFront receives a request from a viewer
+	CloudFrontViewerRequest = "viewer-request"
+	// CloudFrontOriginRequest is the event type for functions triggered before CloudFront forwards a request to the origin
+	CloudFrontOriginRequest = "origin-request"
+	// CloudFrontOriginResponse is the event type for functions triggered after CloudFront receives a response from the origin
+	CloudFrontOriginResponse = "origin-response"
+	// CloudFrontViewerResponse is the event type for functions triggered before CloudFront returns a response to the viewer
+	CloudFrontViewerResponse = "viewer-response"
+)
+
+// The AWS Lambda events package (at the version used) has no Lambda@Edge types, so they are defined here.
+// https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/lambda-event-structure.html
+
+// CloudFrontEvent is a Lambda@Edge event, there is always exactly one record
+type CloudFrontEvent struct {
+	Records []CloudFrontEventRecord `json:"Records"`
+}
+
+// CloudFrontEventRecord is a Lambda@Edge event record
+type CloudFrontEventRecord struct {
+	CF CloudFrontEventRecordCF `json:"cf"`
+}
+
+// CloudFrontEventRecordCF contains the event's config, request and, for origin-response and viewer-response events, response.
+// Handlers for request events can also set the Response to have CloudFront return it instead of continuing with the request.
+type CloudFrontEventRecordCF struct {
+	Config   CloudFrontConfig    `json:"config"`
+	Request  CloudFrontRequest   `json:"request"`
+	Response *CloudFrontResponse `json:"response,omitempty"`
+}
+
+// CloudFrontConfig contains information about the CloudFront distribution and the event type
+type CloudFrontConfig struct {
+	DistributionDomainName string `json:"distributionDomainName"`
+	DistributionID         string `json:"distributionId"`
+	EventType              string `json:"eventType"`
+	RequestID              string `json:"requestId"`
+}
+
+// CloudFrontRequest is the request from the viewer or to the origin. The URI, headers, query string and origin can be changed.
+type CloudFrontRequest struct {
+	ClientIP    string                 `json:"clientIp"`
+	Headers     CloudFrontHeaders      `json:"headers"`
+	Method      string                 `json:"method"`
+	QueryString string                 `json:"querystring"`
+	URI         string                 `json:"uri"`
+	Body        *CloudFrontRequestBody `json:"body,omitempty"`
+	Origin      map[string]interface{} `json:"origin,omitempty"`
+}
+
+// CloudFrontRequestBody is the request body, only included when the Lambda function association is configured to include it
+type CloudFrontRequestBody struct {
+	InputTruncated bool   `json:"inputTruncated"`
+	Action         string `json:"action"`
+	Encoding       string `json:"encoding"`
+	Data           string `json:"data"`
+}
+
+// CloudFrontResponse is the response from the origin or to the viewer, or a response generated by a request event handler
+type CloudFrontResponse struct {
+	Status            string            `json:"status"`
+	StatusDescription string            `json:"statusDescription,omitempty"`
+	Headers           CloudFrontHeaders `json:"headers,omitempty"`
+	Body              string            `json:"body,omitempty"`
+	BodyEncoding      string            `json:"bodyEncoding,omitempty"`
+}
+
+// CloudFrontHeaders are keyed by the lowercase header name and each value keeps the original header name in Key
+type CloudFrontHeaders map[string][]CloudFrontHeader
+
+// CloudFrontHeader is a header name and value
+type CloudFrontHeader struct {
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value"`
+}
+
+// CloudFrontRouter struct provides an interface to handle Lambda@Edge events by event type and URI, using the same path
+// matching as Router (ie. "/images/:name")
+// https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/lambda-at-the-edge.html
+type CloudFrontRouter struct {
+	tree *node
+	// handlers are keyed by the routes added to the tree, which only does the path matching
+	handlers    map[*route]CloudFrontHandler
+	rootHandler CloudFrontHandler
+	Tracer      TraceStrategy
+}
+
+// CloudFrontHandler handles routed Lambda@Edge events. The record's request or response should be manipulated directly,
+// params contains any named path params from the URI.
+type CloudFrontHandler func(context.Context, *HandlerDependencies, *CloudFrontEventRecord, url.Values) error
+
+func init() {
+	// Lambda@Edge events have "Records" with a "cf" key rather than an event source
+	RegisterEventType(EventType{
+		Name:     "CloudFrontEvent",
+		Priority: 1700,
+		Detect: func(evt map[string]interface{}) bool {
+			record := firstRecord(evt)
+			return record != nil && keyInMap("cf", record)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e CloudFrontEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.CloudFrontRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.CloudFrontRouter.LambdaHandler(ctx, d, evt.(CloudFrontEvent))
+		},
+	})
+}
+
+// LambdaHandler handles Lambda@Edge events. For viewer-request and origin-request events, the (possibly changed) request
+// is returned unless the handler set a response. For origin-response and viewer-response events, the response is returned.
+func (r *CloudFrontRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt CloudFrontEvent) (interface{}, error) {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return nil, errors.New("no handlers registered for CloudFrontRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	if len(evt.Records) == 0 {
+		return nil, errors.New("no records in CloudFront event")
+	}
+
+	record := evt.Records[0]
+	eventType := record.CF.Config.EventType
+	params := url.Values{}
+
+	var handler CloudFrontHandler
+	if r.tree != nil {
+		node := r.tree.match(strings.Split(record.CF.Request.URI, "/")[1:], params)
+		if node != nil && node.methods[eventType] != nil {
+			handler = r.handlers[node.methods[eventType]]
+		}
+	}
+	fallthroughHandler := handler == nil
+	if fallthroughHandler {
+		handler = r.rootHandler
+	}
+
+	var err error
+	if handler != nil {
+		d.Tracer.Record("annotation",
+			map[string]interface{}{
+				"CloudFrontEventType":      eventType,
+				"CloudFrontDistributionID": record.CF.Config.DistributionID,
+				"RequestPath":              record.CF.Request.URI,
+				"FallthroughHandler":       fallthroughHandler,
+			},
+		)
+		err = d.Tracer.Capture(ctx, "CloudFrontHandler", func(ctx1 context.Context) error {
+			return handler(ctx1, d, &record, params)
+		})
+	}
+
+	if record.CF.Response != nil {
+		return *record.CF.Response, err
+	}
+	return record.CF.Request, err
+}
+
+// Listen will start a CloudFront event listener that handles incoming Lambda@Edge events
+func (r *CloudFrontRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewCloudFrontRouter simply returns a new CloudFrontRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewCloudFrontRouter(rootHandler ...CloudFrontHandler) *CloudFrontRouter {
+	r := &CloudFrontRouter{
+		tree:     &node{component: "/", isNamedParam: false, methods: make(map[string]*route)},
+		handlers: make(map[*route]CloudFrontHandler),
+	}
+	if len(rootHandler) > 0 {
+		r.rootHandler = rootHandler[0]
+	}
+	return r
+}
+
+// Handle will register a handler for a given CloudFront event type and URI path
+func (r *CloudFrontRouter) Handle(eventType string, path string, handler CloudFrontHandler) {
+	if r.tree == nil {
+		r.tree = &node{component: "/", isNamedParam: false, methods: make(map[string]*route)}
+	}
+	if r.handlers == nil {
+		r.handlers = make(map[*route]CloudFrontHandler)
+	}
+	rt := &route{}
+	r.tree.addRoute(eventType, path, rt)
+	r.handlers[rt] = handler
+}
+
+// ViewerRequest is the same as Handle only the viewer-request event type is already implied.
+func (r *CloudFrontRouter) ViewerRequest(path string, handler CloudFrontHandler) {
+	r.Handle(CloudFrontViewerRequest, path, handler)
+}
+
+// OriginRequest is the same as Handle only the origin-request event type is already implied.
+func (r *CloudFrontRouter) OriginRequest(path string, handler CloudFrontHandler) {
+	r.Handle(CloudFrontOriginRequest, path, handler)
+}
+
+// OriginResponse is the same as Handle only the origin-response event type is already implied.
+func (r *CloudFrontRouter) OriginResponse(path string, handler CloudFrontHandler) {
+	r.Handle(CloudFrontOriginResponse, path, handler)
+}
+
+// ViewerResponse is the same as Handle only the viewer-response event type is already implied.
+func (r *CloudFrontRouter) ViewerResponse(path string, handler CloudFrontHandler) {
+	r.Handle(CloudFrontViewerResponse, path, handler)
+}
+
+// IsRequestEvent returns true for viewer-request and origin-request events
+func (record *CloudFrontEventRecord) IsRequestEvent() bool {
+	t := record.CF.Config.EventType
+	return t == CloudFrontViewerRequest || t == CloudFrontOriginRequest
+}
+
+// Respond sets a generated response, for request events this response is returned instead of continuing with the request.
+// Note that responses can't be generated for viewer-response events, only changed.
+func (record *CloudFrontEventRecord) Respond(status int, body string, headers ...map[string]string) {
+	res := CloudFrontResponse{
+		Status:            strconv.Itoa(status),
+		StatusDescription: http.StatusText(status),
+		Headers:           CloudFrontHeaders{},
+		Body:              body,
+	}
+	for _, h := range headers {
+		for k, v := range h {
+			res.Headers.Set(k, v)
+		}
+	}
+	record.CF.Response = &res
+}
+
+// Redirect sets a generated redirect response
+func (record *CloudFrontEventRecord) Redirect(status int, location string) {
+	record.Respond(status, "", map[string]string{"Location": location})
+}
+
+// Get returns the first value of the given header (case insensitive)
+func (h CloudFrontHeaders) Get(name string) string {
+	if values := h[strings.ToLower(name)]; len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// Set replaces any values of the given header
+func (h CloudFrontHeaders) Set(name string, value string) {
+	h[strings.ToLower(name)] = []CloudFrontHeader{{Key: name, Value: value}}
+}
+
+// Add adds a value to the given header
+func (h CloudFrontHeaders) Add(name string, value string) {
+	k := strings.ToLower(name)
+	h[k] = append(h[k], CloudFrontHeader{Key: name, Value: value})
+}
+
+// Del removes the given header
+func (h CloudFrontHeaders) Del(name string) {
+	delete(h, strings.ToLower(name))
+}
+
+// Query returns the parsed query string
+func (req *CloudFrontRequest) Query() url.Values {
+	q, _ := url.ParseQuery(req.QueryString)
+	return q
+}
+
+// SetQuery sets the query string
+func (req *CloudFrontRequest) SetQuery(q url.Values) {
+	req.QueryString = q.Encode()
+}
@@ -0,0 +1,147 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCloudFrontRouter(t *testing.T) {
+
+	newEvent := func(eventType string, uri string, querystring string) CloudFrontEvent {
+		record := CloudFrontEventRecord{}
+		record.CF.Config = CloudFrontConfig{DistributionID: "EDFDVBD6EXAMPLE", EventType: eventType}
+		record.CF.Request = CloudFrontRequest{
+			Method:      "GET",
+			URI:         uri,
+			QueryString: querystring,
+			Headers:     CloudFrontHeaders{"host": {{Key: "Host", Value: "d111111abcdef8.cloudfront.net"}}},
+		}
+		if !record.IsRequestEvent() {
+			record.CF.Response = &CloudFrontResponse{Status: "200", StatusDescription: "OK", Headers: CloudFrontHeaders{}}
+		}
+		return CloudFrontEvent{Records: []CloudFrontEventRecord{record}}
+	}
+
+	router := NewCloudFrontRouter()
+	router.Tracer = NoTraceStrategy{}
+	router.ViewerRequest("/images/:name", func(ctx context.Context, d *HandlerDependencies, record *CloudFrontEventRecord, params url.Values) error {
+		q := record.CF.Request.Query()
+		q.Set("w", "100")
+		record.CF.Request.SetQuery(q)
+		record.CF.Request.URI = "/resized/" + params.Get("name")
+		record.CF.Request.Headers.Set("X-Resized", "true")
+		return nil
+	})
+	router.ViewerRequest("/old", func(ctx context.Context, d *HandlerDependencies, record *CloudFrontEventRecord, params url.Values) error {
+		record.Redirect(301, "/new")
+		return nil
+	})
+	router.OriginResponse("/images/:name", func(ctx context.Context, d *HandlerDependencies, record *CloudFrontEventRecord, params url.Values) error {
+		record.CF.Response.Headers.Set("Cache-Control", "max-age=3600")
+		return nil
+	})
+
+	Convey("CloudFrontRouter", t, func() {
+		Convey("Should rewrite requests", func() {
+			res, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(CloudFrontViewerRequest, "/images/cat.jpg", "q=1"))
+			So(err, ShouldBeNil)
+			So(res, ShouldHaveSameTypeAs, CloudFrontRequest{})
+			req := res.(CloudFrontRequest)
+			So(req.URI, ShouldEqual, "/resized/cat.jpg")
+			So(req.QueryString, ShouldEqual, "q=1&w=100")
+			So(req.Headers.Get("x-resized"), ShouldEqual, "true")
+			So(req.Headers["x-resized"][0].Key, ShouldEqual, "X-Resized")
+		})
+
+		Convey("Should generate responses for request events", func() {
+			res, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(CloudFrontViewerRequest, "/old", ""))
+			So(err, ShouldBeNil)
+			So(res, ShouldHaveSameTypeAs, CloudFrontResponse{})
+			So(res.(CloudFrontResponse).Status, ShouldEqual, "301")
+			So(res.(CloudFrontResponse).StatusDescription, ShouldEqual, "Moved Permanently")
+			So(res.(CloudFrontResponse).Headers.Get("Location"), ShouldEqual, "/new")
+		})
+
+		Convey("Should route by event type", func() {
+			res, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(CloudFrontOriginResponse, "/images/cat.jpg", ""))
+			So(err, ShouldBeNil)
+			So(res.(CloudFrontResponse).Headers.Get("Cache-Control"), ShouldEqual, "max-age=3600")
+
+			// No handler for origin-request events, the request is returned unchanged
+			res, err = router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(CloudFrontOriginRequest, "/images/cat.jpg", ""))
+			So(err, ShouldBeNil)
+			So(res.(CloudFrontRequest).URI, ShouldEqual, "/images/cat.jpg")
+		})
+
+		Convey("Should use the root handler", func() {
+			r := NewCloudFrontRouter(func(ctx context.Context, d *HandlerDependencies, record *CloudFrontEventRecord, params url.Values) error {
+				record.Respond(404, "not found", map[string]string{"Content-Type": "text/plain"})
+				return nil
+			})
+			r.Tracer = NoTraceStrategy{}
+			res, _ := r.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(CloudFrontViewerRequest, "/missing", ""))
+			So(res.(CloudFrontResponse).Status, ShouldEqual, "404")
+			So(res.(CloudFrontResponse).Body, ShouldEqual, "not found")
+		})
+	})
+
+	Convey("CloudFrontHeaders", t, func() {
+		h := CloudFrontHeaders{}
+		h.Add("Set-Cookie", "a=1")
+		h.Add("Set-Cookie", "b=2")
+		So(h["set-cookie"], ShouldHaveLength, 2)
+		So(h.Get("SET-COOKIE"), ShouldEqual, "a=1")
+		h.Del("set-cookie")
+		So(h, ShouldBeEmpty)
+	})
+
+	Convey("Handlers should detect and decode CloudFront events", t, func() {
+		evt := map[string]interface{}{
+			"Records": []interface{}{
+				map[string]interface{}{
+					"cf": map[string]interface{}{
+						"config": map[string]interface{}{
+							"distributionDomainName": "d111111abcdef8.cloudfront.net",
+							"distributionId":         "EDFDVBD6EXAMPLE",
+							"eventType":              "viewer-request",
+							"requestId":              "4TyzHTaYWb1GX1qTfsHhEqV6HUDd_BzoBZnwfnvQc_1oF26ClkoUSEQ==",
+						},
+						"request": map[string]interface{}{
+							"clientIp":    "203.0.113.178",
+							"method":      "GET",
+							"querystring": "",
+							"uri":         "/images/dog.png",
+							"headers": map[string]interface{}{
+								"host": []interface{}{map[string]interface{}{"key": "Host", "value": "d111111abcdef8.cloudfront.net"}},
+							},
+						},
+					},
+				},
+			},
+		}
+		So(getType(evt), ShouldEqual, "CloudFrontEvent")
+
+		h := Handlers{CloudFrontRouter: router}
+		res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, evt)
+		So(err, ShouldBeNil)
+		So(res.(CloudFrontRequest).URI, ShouldEqual, "/resized/dog.png")
+		So(res.(CloudFrontRequest).ClientIP, ShouldEqual, "203.0.113.178")
+	})
+}
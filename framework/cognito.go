@@ -32,13 +32,27 @@ type CognitoRouter struct {
 // CognitoHandler handles routed trigger events, note that these must return a map[string]interface{} response
 type CognitoHandler func(context.Context, *HandlerDependencies, map[string]interface{}) (map[string]interface{}, error)
 
+func init() {
+	RegisterEventType(EventType{
+		Name:     "CognitoTrigger",
+		Priority: 700,
+		Detect: func(evt map[string]interface{}) bool {
+			return keyInMap("userPoolId", evt) && keyInMap("triggerSource", evt)
+		},
+		// There's so many different formats here, routing for each is a bit silly.
+		// So send map[string]interface{}
+		// The handler itself can unmarshal using structs found in cognito_trigger_types.go
+		Handled: func(h *Handlers) bool {
+			return h.CognitoRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.CognitoRouter.LambdaHandler(ctx, d, evt.(map[string]interface{}))
+		},
+	})
+}
+
 // LambdaHandler handles Cognito trigger events.
 func (r *CognitoRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt map[string]interface{}) (map[string]interface{}, error) {
-	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
-	if r.Tracer != nil {
-		d.Tracer = r.Tracer
-	}
-
 	var err error
 	handled := false
 	userPoolID := evt["userPoolId"].(string)
@@ -56,6 +70,11 @@ func (r *CognitoRouter) LambdaHandler(ctx context.Context, d *HandlerDependencie
 		return response, errors.New("no handlers registered for CognitoRouter")
 	}
 
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
 	if r.PoolID == "" || r.PoolID == userPoolID {
 		if handler, ok := r.handlers[triggerSource]; ok {
 			handled = true
@@ -18,6 +18,8 @@ import (
 	"context"
 	"errors"
 	"net/url"
+
+	"github.com/dgrijalva/jwt-go"
 )
 
 // ValidAccessTokenMiddleware is helper middleware to verify a JWT from an `acess_token` cookie.
@@ -45,3 +47,33 @@ func ValidAccessTokenMiddleware(ctx context.Context, d *HandlerDependencies, req
 	res.JSONError(401, errors.New("unauthorized"))
 	return false
 }
+
+// CognitoAuthorizer is a helper AuthorizerHandler to verify a Cognito JWT from the authorizer's token (or the Authorization
+// header for REQUEST authorizers). A configured CognitoAppClient must be provided. Valid tokens are allowed to invoke every
+// method of the API stage, the principal is the token's `sub` claim and the token's claims are passed along in the context.
+// For more control, call it from your own handler and then add to or change the response's policy document.
+func CognitoAuthorizer(ctx context.Context, d *HandlerDependencies, req *APIGatewayCustomAuthorizerRequest, res *APIGatewayCustomAuthorizerResponse) error {
+	if d == nil || d.Services == nil || d.Services.Cognito == nil || d.Services.Cognito.ClientID == "" {
+		return errors.New("auth has not been configured")
+	}
+
+	token, err := d.Services.Cognito.ParseAndVerifyJWT(req.Token())
+	if err != nil || token == nil {
+		return ErrAuthorizerUnauthorized
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		for k, v := range claims {
+			// API Gateway only allows string, number and boolean context values
+			switch v.(type) {
+			case string, float64, bool:
+				res.SetContext(k, v)
+			}
+		}
+		if sub, ok := claims["sub"].(string); ok {
+			res.PrincipalID = sub
+		}
+	}
+	res.Allow(req.Arn("*", "*"))
+	return nil
+}
@@ -47,4 +47,26 @@ func TestCognitoHelpers(t *testing.T) {
 		})
 	})
 
+	Convey("CognitoAuthorizer()", t, func() {
+
+		Convey("Should be unauthorized without a valid token", func() {
+			d := &HandlerDependencies{}
+			req := &APIGatewayCustomAuthorizerRequest{AuthorizationToken: "Bearer invalid"}
+			res := &APIGatewayCustomAuthorizerResponse{}
+
+			err := CognitoAuthorizer(context.Background(), d, req, res)
+			So(err, ShouldNotBeNil)
+			So(err, ShouldNotEqual, ErrAuthorizerUnauthorized)
+
+			d.Services = &Services{
+				Cognito: &CognitoAppClient{
+					ClientID: "foo",
+				},
+			}
+			err = CognitoAuthorizer(context.Background(), d, req, res)
+			So(err, ShouldEqual, ErrAuthorizerUnauthorized)
+			So(res.PolicyDocument.Statement, ShouldBeEmpty)
+		})
+	})
+
 }
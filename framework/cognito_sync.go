@@ -0,0 +1,211 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// CognitoSyncRouter struct provides an interface to handle Cognito Sync events (routers can be for a specific identity pool or any)
+// https://docs.aws.amazon.com/cognito/latest/developerguide/cognito-events.html
+type CognitoSyncRouter struct {
+	handlers map[string]CognitoSyncHandler
+	// handlerKeys are the keys of handlers in the order they were registered, which is the order they're called in
+	handlerKeys []string
+	PoolID      string
+	Tracer      TraceStrategy
+}
+
+// CognitoSyncHandler handles routed sync events. IdentityPoolID and DatasetName are glob matches.
+// The handler returns the dataset records that Cognito Sync should store, which may be modified. If nil is returned,
+// the records are left as they were.
+type CognitoSyncHandler struct {
+	Handler        func(context.Context, *HandlerDependencies, *CognitoEvent) (map[string]events.CognitoDatasetRecord, error)
+	IdentityPoolID string
+	DatasetName    string
+}
+
+const (
+	// CognitoSyncOpReplace is the op for dataset records that were added or updated
+	CognitoSyncOpReplace = "replace"
+	// CognitoSyncOpRemove is the op for dataset records that were removed
+	CognitoSyncOpRemove = "remove"
+)
+
+func init() {
+	// Cognito Sync events (NOT a Cognito trigger)
+	RegisterEventType(EventType{
+		Name:     "CognitoEvent",
+		Priority: 800,
+		Detect: func(evt map[string]interface{}) bool {
+			return keyInMap("identityPoolId", evt) && keyInMap("datasetRecords", evt)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e CognitoEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.CognitoSyncRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.CognitoSyncRouter.LambdaHandler(ctx, d, evt.(CognitoEvent))
+		},
+	})
+}
+
+// LambdaHandler handles Cognito Sync events. Cognito Sync expects the event to be returned, with any changes
+// made to the dataset records, so each matching handler's records replace the event's records in turn (in the order
+// the handlers were added).
+func (r *CognitoSyncRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt CognitoEvent) (CognitoEvent, error) {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return evt, errors.New("no handlers registered for CognitoSyncRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	var err error
+
+	// If there are no handlers registered or the pool doesn't match (if a pool was defined for the router),
+	// return the event unchanged so the sync still goes through.
+	if r.handlers == nil || (r.PoolID != "" && r.PoolID != evt.IdentityPoolID) {
+		return evt, err
+	}
+
+	handled := false
+	for _, k := range r.handlerKeys {
+		handler := r.handlers[k]
+		if k == "_" || !globMatch(handler.IdentityPoolID, evt.IdentityPoolID) || !globMatch(handler.DatasetName, evt.DatasetName) {
+			continue
+		}
+		handled = true
+		d.Tracer.Record("annotation",
+			map[string]interface{}{
+				"CognitoIdentityPoolID": evt.IdentityPoolID,
+				"CognitoDatasetName":    evt.DatasetName,
+			},
+		)
+		if err = r.callHandler(ctx, d, handler, &evt); err != nil {
+			return evt, err
+		}
+	}
+
+	// Otherwise, use the catch all (router "fallthrough" equivalent) handler.
+	// The application can inspect the event and make a decision on what to do, if anything.
+	// This is optional.
+	if !handled {
+		// It's possible that the CognitoSyncRouter wasn't created with NewCognitoSyncRouter, so check for this still.
+		if handler, ok := r.handlers["_"]; ok {
+			d.Tracer.Record("annotation",
+				map[string]interface{}{
+					"CognitoIdentityPoolID": evt.IdentityPoolID,
+					"CognitoDatasetName":    evt.DatasetName,
+					"FallthroughHandler":    true,
+				},
+			)
+			err = r.callHandler(ctx, d, handler, &evt)
+		}
+	}
+
+	return evt, err
+}
+
+// callHandler calls a handler and replaces the event's dataset records with the returned records (unless nil)
+func (r *CognitoSyncRouter) callHandler(ctx context.Context, d *HandlerDependencies, handler CognitoSyncHandler, evt *CognitoEvent) error {
+	return d.Tracer.Capture(ctx, "CognitoSyncHandler", func(ctx1 context.Context) error {
+		records, err := handler.Handler(ctx1, d, evt)
+		if err != nil {
+			return err
+		}
+		if records != nil {
+			evt.DatasetRecords = records
+		}
+		return nil
+	})
+}
+
+// Listen will start a Cognito Sync event listener that handles incoming dataset sync events
+func (r *CognitoSyncRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewCognitoSyncRouter simply returns a new CognitoSyncRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewCognitoSyncRouter(rootHandler ...func(context.Context, *HandlerDependencies, *CognitoEvent) (map[string]events.CognitoDatasetRecord, error)) *CognitoSyncRouter {
+	// The catch all is optional, if not provided, an empty handler is still called and it leaves the records unchanged.
+	handler := CognitoSyncHandler{
+		Handler: func(context.Context, *HandlerDependencies, *CognitoEvent) (map[string]events.CognitoDatasetRecord, error) {
+			return nil, nil
+		},
+	}
+	if len(rootHandler) > 0 {
+		handler = CognitoSyncHandler{
+			Handler: rootHandler[0],
+		}
+	}
+	return &CognitoSyncRouter{
+		handlers: map[string]CognitoSyncHandler{
+			"_": handler,
+		},
+	}
+}
+
+// NewCognitoSyncRouterForPool is the same as NewCognitoSyncRouter except it's for a specific identity pool (you could also set the PoolID field after using the other function)
+func NewCognitoSyncRouterForPool(poolID string, rootHandler ...func(context.Context, *HandlerDependencies, *CognitoEvent) (map[string]events.CognitoDatasetRecord, error)) *CognitoSyncRouter {
+	r := NewCognitoSyncRouter(rootHandler...)
+	// Just convenience
+	r.PoolID = poolID
+	return r
+}
+
+// Handle will register a handler for a given identity pool ID and dataset name glob match.
+// An empty string for either will match any identity pool or dataset.
+func (r *CognitoSyncRouter) Handle(poolID string, datasetName string, handler func(context.Context, *HandlerDependencies, *CognitoEvent) (map[string]events.CognitoDatasetRecord, error)) {
+	if r.handlers == nil {
+		r.handlers = make(map[string]CognitoSyncHandler)
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(poolID)
+	buffer.WriteString(":")
+	buffer.WriteString(datasetName)
+	k := buffer.String()
+	buffer.Reset()
+	if _, ok := r.handlers[k]; !ok {
+		r.handlerKeys = append(r.handlerKeys, k)
+	}
+	r.handlers[k] = CognitoSyncHandler{
+		Handler:        handler,
+		IdentityPoolID: poolID,
+		DatasetName:    datasetName,
+	}
+}
+
+// Records returns a copy of the event's dataset records, which handlers can modify and return
+func (evt *CognitoEvent) Records() map[string]events.CognitoDatasetRecord {
+	records := make(map[string]events.CognitoDatasetRecord, len(evt.DatasetRecords))
+	for k, v := range evt.DatasetRecords {
+		records[k] = v
+	}
+	return records
+}
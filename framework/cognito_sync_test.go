@@ -0,0 +1,146 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	events "github.com/aws/aws-lambda-go/events"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCognitoSyncRouter(t *testing.T) {
+
+	// Fake event
+	evt := CognitoEvent{
+		DatasetName:    "profile",
+		EventType:      "SyncTrigger",
+		IdentityID:     "us-east-1:c2e8a3b2-0000-0000-0000-000000000000",
+		IdentityPoolID: "us-east-1:a1b2c3d4-0000-0000-0000-000000000000",
+		Region:         "us-east-1",
+		Version:        2,
+		DatasetRecords: map[string]events.CognitoDatasetRecord{
+			"name": {NewValue: "  Jane  ", Op: CognitoSyncOpReplace},
+		},
+	}
+
+	Convey("NewCognitoSyncRouterForPool()", t, func() {
+
+		Convey("Should create a new CognitoSyncRouter for a specific pool", func() {
+			r := NewCognitoSyncRouterForPool(evt.IdentityPoolID)
+			So(r, ShouldNotBeNil)
+			So(r.PoolID, ShouldEqual, evt.IdentityPoolID)
+		})
+
+		Convey("Should return the event unchanged by default", func() {
+			r := NewCognitoSyncRouterForPool(evt.IdentityPoolID)
+			r.Tracer = NoTraceStrategy{}
+			res, err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(err, ShouldBeNil)
+			So(res, ShouldResemble, evt)
+		})
+
+		Convey("Should not handle events from other pools", func() {
+			handled := false
+			r := NewCognitoSyncRouterForPool("us-east-1:other", func(ctx context.Context, d *HandlerDependencies, e *CognitoEvent) (map[string]events.CognitoDatasetRecord, error) {
+				handled = true
+				return nil, nil
+			})
+			r.Tracer = NoTraceStrategy{}
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(handled, ShouldBeFalse)
+		})
+	})
+
+	Convey("Handle()", t, func() {
+		Convey("Should route by dataset name and return modified records", func() {
+			r := NewCognitoSyncRouter()
+			r.Tracer = NoTraceStrategy{}
+			r.Handle("us-east-1:*", "prof*", func(ctx context.Context, d *HandlerDependencies, e *CognitoEvent) (map[string]events.CognitoDatasetRecord, error) {
+				records := e.Records()
+				for k, record := range records {
+					record.NewValue = strings.TrimSpace(record.NewValue)
+					records[k] = record
+				}
+				return records, nil
+			})
+			r.Handle("", "settings", func(ctx context.Context, d *HandlerDependencies, e *CognitoEvent) (map[string]events.CognitoDatasetRecord, error) {
+				return map[string]events.CognitoDatasetRecord{}, nil
+			})
+			res, err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(err, ShouldBeNil)
+			So(res.DatasetRecords["name"].NewValue, ShouldEqual, "Jane")
+			// The original event's records should not be modified
+			So(evt.DatasetRecords["name"].NewValue, ShouldEqual, "  Jane  ")
+		})
+
+		Convey("Should chain matching handlers in the order they were added", func() {
+			for i := 0; i < 10; i++ {
+				r := NewCognitoSyncRouter()
+				r.Tracer = NoTraceStrategy{}
+				r.Handle("", "prof*", func(ctx context.Context, d *HandlerDependencies, e *CognitoEvent) (map[string]events.CognitoDatasetRecord, error) {
+					records := e.Records()
+					record := records["name"]
+					record.NewValue = strings.TrimSpace(record.NewValue)
+					records["name"] = record
+					return records, nil
+				})
+				r.Handle("us-east-1:*", "", func(ctx context.Context, d *HandlerDependencies, e *CognitoEvent) (map[string]events.CognitoDatasetRecord, error) {
+					records := e.Records()
+					record := records["name"]
+					record.NewValue += "!"
+					records["name"] = record
+					return records, nil
+				})
+				res, err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+				So(err, ShouldBeNil)
+				So(res.DatasetRecords["name"].NewValue, ShouldEqual, "Jane!")
+			}
+		})
+	})
+
+	Convey("Handlers should detect and decode Cognito Sync events", t, func() {
+		So(getType(map[string]interface{}{"identityPoolId": "123", "datasetRecords": map[string]interface{}{}}), ShouldEqual, "CognitoEvent")
+
+		router := NewCognitoSyncRouter(func(ctx context.Context, d *HandlerDependencies, e *CognitoEvent) (map[string]events.CognitoDatasetRecord, error) {
+			records := map[string]events.CognitoDatasetRecord{}
+			for k, record := range e.DatasetRecords {
+				if k != "secret" {
+					records[k] = record
+				}
+			}
+			return records, nil
+		})
+		router.Tracer = NoTraceStrategy{}
+		h := Handlers{CognitoSyncRouter: router}
+		res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+			"version":        2,
+			"eventType":      "SyncTrigger",
+			"region":         "us-east-1",
+			"identityPoolId": "us-east-1:a1b2c3d4-0000-0000-0000-000000000000",
+			"identityId":     "us-east-1:c2e8a3b2-0000-0000-0000-000000000000",
+			"datasetName":    "profile",
+			"datasetRecords": map[string]interface{}{
+				"name":   map[string]interface{}{"oldValue": "", "newValue": "Jane", "op": "replace"},
+				"secret": map[string]interface{}{"oldValue": "", "newValue": "shh", "op": "replace"},
+			},
+		})
+		So(err, ShouldBeNil)
+		So(res.(CognitoEvent).DatasetRecords, ShouldHaveLength, 1)
+		So(res.(CognitoEvent).DatasetRecords["name"].NewValue, ShouldEqual, "Jane")
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig is a CORS policy for a Router. When set, responses to cross-origin requests from allowed origins get CORS
+// headers and OPTIONS preflight requests are answered for any path with a route (unless an OPTIONS route is handled).
+// Note that API Gateway can also handle CORS, in which case this isn't needed.
+type CORSConfig struct {
+	// AllowOrigins are the allowed origins, ie. "https://example.com", or "*" for any origin
+	AllowOrigins []string
+	// AllowMethods are the methods allowed in preflight responses, the methods handled for the path if empty
+	AllowMethods []string
+	// AllowHeaders are the request headers allowed in preflight responses, the requested headers if empty
+	AllowHeaders []string
+	// ExposeHeaders are the response headers the browser can read
+	ExposeHeaders []string
+	// AllowCredentials allows cookies and authorization headers, the origin is then always echoed instead of "*"
+	AllowCredentials bool
+	// MaxAge is how long, in seconds, a preflight response can be cached
+	MaxAge int
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for the request origin, empty if it isn't allowed
+func (c *CORSConfig) allowedOrigin(origin string) string {
+	if c == nil || origin == "" {
+		return ""
+	}
+	for _, o := range c.AllowOrigins {
+		if o == "*" {
+			// Credentials are not allowed with a wildcard origin
+			if c.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// setHeaders sets the CORS headers for a cross-origin request on the response
+func (c *CORSConfig) setHeaders(req *APIGatewayProxyRequest, res *APIGatewayProxyResponse) {
+	allowOrigin := c.allowedOrigin(req.GetHeader(HeaderOrigin))
+	if allowOrigin == "" {
+		return
+	}
+	res.SetHeader(HeaderAccessControlAllowOrigin, allowOrigin)
+	// The response depends on the origin unless any origin gets the same one
+	if allowOrigin != "*" {
+		res.SetHeader(HeaderVary, HeaderOrigin)
+	}
+	if c.AllowCredentials {
+		res.SetHeader(HeaderAccessControlAllowCredentials, "true")
+	}
+	if len(c.ExposeHeaders) > 0 {
+		res.SetHeader(HeaderAccessControlExposeHeaders, strings.Join(c.ExposeHeaders, ", "))
+	}
+}
+
+// setPreflightHeaders sets the headers for a response to a preflight request, allow is the path's Allow header value
+func (c *CORSConfig) setPreflightHeaders(req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, allow string) {
+	if res.GetHeader(HeaderAccessControlAllowOrigin) == "" {
+		return
+	}
+	allowMethods := allow
+	if len(c.AllowMethods) > 0 {
+		allowMethods = strings.Join(c.AllowMethods, ", ")
+	}
+	res.SetHeader(HeaderAccessControlAllowMethods, allowMethods)
+
+	allowHeaders := req.GetHeader(HeaderAccessControlRequestHeaders)
+	if len(c.AllowHeaders) > 0 {
+		allowHeaders = strings.Join(c.AllowHeaders, ", ")
+	}
+	if allowHeaders != "" {
+		res.SetHeader(HeaderAccessControlAllowHeaders, allowHeaders)
+	}
+	if c.MaxAge > 0 {
+		res.SetHeader(HeaderAccessControlMaxAge, strconv.Itoa(c.MaxAge))
+	}
+}
+
+// allowHeader returns the Allow header value for a path's handled methods. HEAD is allowed when GET is handled and
+// OPTIONS is always allowed, since the Router answers them.
+func allowHeader(methods map[string]*route) string {
+	allowed := []string{options}
+	for method := range methods {
+		if method != options {
+			allowed = append(allowed, method)
+		}
+	}
+	if _, ok := methods[get]; ok {
+		if _, ok := methods[head]; !ok {
+			allowed = append(allowed, head)
+		}
+	}
+	sort.Strings(allowed)
+	return strings.Join(allowed, ", ")
+}
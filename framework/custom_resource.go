@@ -0,0 +1,278 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/cfn"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+// DefaultCustomResourceDeadlineMargin is how long before the Lambda deadline a FAILED response is sent for a handler that hasn't finished
+const DefaultCustomResourceDeadlineMargin = 2 * time.Second
+
+// CustomResourceRouter struct provides an interface to handle CloudFormation custom resource events by resource type
+// and request type. The outcome of each handler is sent to CloudFormation automatically.
+// https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/template-custom-resources-lambda.html
+type CustomResourceRouter struct {
+	handlers    map[string]CustomResourceHandler
+	rootHandler CustomResourceHandler
+	// HTTPClient is used to send the response to CloudFormation, http.DefaultClient is used if not set
+	HTTPClient *http.Client
+	// DeadlineMargin is how long before the Lambda deadline a FAILED response is sent if the handler hasn't finished
+	DeadlineMargin time.Duration
+	Tracer         TraceStrategy
+}
+
+// CustomResourceHandler handles routed custom resource events. It returns the physical resource ID and any data to make
+// available to Fn::GetAtt in the template. If an empty physical resource ID is returned, the event's physical resource ID
+// is kept (for Update and Delete requests). Returning an error sends a FAILED response with the error as the reason.
+type CustomResourceHandler func(context.Context, *HandlerDependencies, *CustomResourceEvent) (string, map[string]interface{}, error)
+
+func init() {
+	// Custom resource events have a "RequestType" and a presigned "ResponseURL" to send the outcome to
+	RegisterEventType(EventType{
+		Name:     "CustomResourceEvent",
+		Priority: 1800,
+		Detect: func(evt map[string]interface{}) bool {
+			return keyInMap("RequestType", evt) && keyInMap("ResponseURL", evt) && keyInMap("StackId", evt)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e CustomResourceEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		// There is no Handled function, since a response must be sent even if CustomResourceRouter isn't set
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return nil, h.CustomResourceRouter.LambdaHandler(ctx, d, evt.(CustomResourceEvent))
+		},
+	})
+}
+
+// LambdaHandler handles CloudFormation custom resource events. A response is always sent to CloudFormation, even when
+// there is no handler for the resource type, the handler panics or the handler is still running close to the Lambda's
+// deadline. Otherwise the stack would wait (up to an hour) for a response. The returned error is only about sending it.
+func (r *CustomResourceRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt CustomResourceEvent) error {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}. The stack still needs a response.
+	if r == nil {
+		res := evt.NewResponse()
+		res.Status = cfn.StatusFailed
+		res.Reason = "no handlers registered for CustomResourceRouter"
+		log.Printf("sending FAILED custom resource response: %s", res.Reason)
+		return (&CustomResourceRouter{}).send(ctx, evt.ResponseURL, res)
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	res := evt.NewResponse()
+
+	handler, fallthroughHandler := r.handler(&evt)
+	if handler == nil {
+		res.Status = cfn.StatusFailed
+		res.Reason = fmt.Sprintf("no handler for %s %s request", evt.ResourceType, evt.RequestType)
+		return r.send(ctx, evt.ResponseURL, res)
+	}
+
+	d.Tracer.Record("annotation",
+		map[string]interface{}{
+			"CustomResourceType":        evt.ResourceType,
+			"CustomResourceRequestType": string(evt.RequestType),
+			"CustomResourceLogicalID":   evt.LogicalResourceID,
+			"FallthroughHandler":        fallthroughHandler,
+		},
+	)
+
+	type result struct {
+		physicalResourceID string
+		data               map[string]interface{}
+		err                error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var rs result
+		defer func() {
+			if p := recover(); p != nil {
+				rs.err = fmt.Errorf("custom resource handler panic: %v", p)
+			}
+			done <- rs
+		}()
+		rs.err = d.Tracer.Capture(ctx, "CustomResourceHandler", func(ctx1 context.Context) error {
+			var err error
+			rs.physicalResourceID, rs.data, err = handler(ctx1, d, &evt)
+			return err
+		})
+	}()
+
+	// Stop waiting for the handler shortly before the Lambda times out, so a response can still be sent
+	var timeout <-chan time.Time
+	if deadline, ok := ctx.Deadline(); ok {
+		margin := r.DeadlineMargin
+		if margin == 0 {
+			margin = DefaultCustomResourceDeadlineMargin
+		}
+		timer := time.NewTimer(time.Until(deadline.Add(-margin)))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case rs := <-done:
+		if rs.physicalResourceID != "" {
+			res.PhysicalResourceID = rs.physicalResourceID
+		}
+		res.Data = rs.data
+		res.Status = cfn.StatusSuccess
+		if rs.err != nil {
+			res.Status = cfn.StatusFailed
+			res.Reason = rs.err.Error()
+		}
+	case <-timeout:
+		res.Status = cfn.StatusFailed
+		res.Reason = "custom resource handler did not finish before the Lambda deadline"
+	}
+
+	if res.Status == cfn.StatusFailed {
+		log.Printf("sending FAILED custom resource response: %s", res.Reason)
+	}
+	return r.send(ctx, evt.ResponseURL, res)
+}
+
+// handler returns the handler for the event's resource type and request type, falling back to a handler for all
+// request types of the resource type and then the root handler. The boolean is true for the root handler.
+func (r *CustomResourceRouter) handler(evt *CustomResourceEvent) (CustomResourceHandler, bool) {
+	if h, ok := r.handlers[customResourceHandlerKey(evt.ResourceType, string(evt.RequestType))]; ok {
+		return h, false
+	}
+	if h, ok := r.handlers[customResourceHandlerKey(evt.ResourceType, "")]; ok {
+		return h, false
+	}
+	return r.rootHandler, true
+}
+
+// send will PUT the response to the presigned URL from the event
+func (r *CustomResourceRouter) send(ctx context.Context, url string, res *cfn.Response) error {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// The URL is presigned without a content type, so one must not be sent
+	req.Header.Del("Content-Type")
+
+	client := r.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("custom resource response could not be sent, %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// Listen will start a custom resource event listener that handles incoming CloudFormation custom resource events
+func (r *CustomResourceRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewCustomResourceRouter simply returns a new CustomResourceRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewCustomResourceRouter(rootHandler ...CustomResourceHandler) *CustomResourceRouter {
+	r := &CustomResourceRouter{
+		handlers: make(map[string]CustomResourceHandler),
+	}
+	if len(rootHandler) > 0 {
+		r.rootHandler = rootHandler[0]
+	}
+	return r
+}
+
+// Handle will register a handler for a given resource type (ie. "Custom::MyResource") and request type.
+// An empty request type will handle all request types for the resource type.
+func (r *CustomResourceRouter) Handle(resourceType string, requestType string, handler CustomResourceHandler) {
+	if r.handlers == nil {
+		r.handlers = make(map[string]CustomResourceHandler)
+	}
+	r.handlers[customResourceHandlerKey(resourceType, requestType)] = handler
+}
+
+// Create is the same as Handle only the Create request type is already implied.
+func (r *CustomResourceRouter) Create(resourceType string, handler CustomResourceHandler) {
+	r.Handle(resourceType, string(cfn.RequestCreate), handler)
+}
+
+// Update is the same as Handle only the Update request type is already implied.
+func (r *CustomResourceRouter) Update(resourceType string, handler CustomResourceHandler) {
+	r.Handle(resourceType, string(cfn.RequestUpdate), handler)
+}
+
+// Delete is the same as Handle only the Delete request type is already implied.
+func (r *CustomResourceRouter) Delete(resourceType string, handler CustomResourceHandler) {
+	r.Handle(resourceType, string(cfn.RequestDelete), handler)
+}
+
+// customResourceHandlerKey returns the handlers map key for a resource type and request type
+func customResourceHandlerKey(resourceType string, requestType string) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(resourceType)
+	buffer.WriteString(":")
+	buffer.WriteString(requestType)
+	return buffer.String()
+}
+
+// NewResponse returns a response for the event. The physical resource ID is the event's, if there is one (Update and
+// Delete requests), otherwise the Lambda's log stream name (as the aws-lambda-go cfn package does) or the logical resource ID.
+func (evt *CustomResourceEvent) NewResponse() *cfn.Response {
+	e := cfn.Event(*evt)
+	res := cfn.NewResponse(&e)
+	res.PhysicalResourceID = evt.PhysicalResourceID
+	if res.PhysicalResourceID == "" {
+		res.PhysicalResourceID = lambdacontext.LogStreamName
+	}
+	if res.PhysicalResourceID == "" {
+		res.PhysicalResourceID = evt.LogicalResourceID
+	}
+	return res
+}
+
+// UnmarshalProperties will decode the resource properties into v (using JSON struct tags). Note that CloudFormation
+// sends all property values as strings.
+func (evt *CustomResourceEvent) UnmarshalProperties(v interface{}) error {
+	b, err := json.Marshal(evt.ResourceProperties)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,161 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/cfn"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCustomResourceRouter(t *testing.T) {
+	var lastRequest *http.Request
+	var lastResponse cfn.Response
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastRequest = r
+		lastResponse = cfn.Response{}
+		json.NewDecoder(r.Body).Decode(&lastResponse)
+	}))
+	defer server.Close()
+
+	newEvent := func(resourceType string, requestType cfn.RequestType, physicalResourceID string) CustomResourceEvent {
+		return CustomResourceEvent{
+			RequestType:        requestType,
+			RequestID:          "unique-id-for-this-request",
+			ResponseURL:        server.URL + "/presigned",
+			ResourceType:       resourceType,
+			LogicalResourceID:  "MyResource",
+			PhysicalResourceID: physicalResourceID,
+			StackID:            "arn:aws:cloudformation:us-east-1:123456789012:stack/my-stack/guid",
+			ResourceProperties: map[string]interface{}{"Name": "widget", "Size": "2"},
+		}
+	}
+
+	router := NewCustomResourceRouter()
+	router.Tracer = &errorTraceStrategy{}
+	router.Create("Custom::Widget", func(ctx context.Context, d *HandlerDependencies, evt *CustomResourceEvent) (string, map[string]interface{}, error) {
+		var props struct {
+			Name string
+			Size string
+		}
+		if err := evt.UnmarshalProperties(&props); err != nil {
+			return "", nil, err
+		}
+		return "widget-" + props.Name, map[string]interface{}{"Size": props.Size}, nil
+	})
+	router.Handle("Custom::Widget", "", func(ctx context.Context, d *HandlerDependencies, evt *CustomResourceEvent) (string, map[string]interface{}, error) {
+		return "", nil, errors.New("widgets can't be changed")
+	})
+	router.Delete("Custom::Panic", func(ctx context.Context, d *HandlerDependencies, evt *CustomResourceEvent) (string, map[string]interface{}, error) {
+		panic("oops")
+	})
+	router.Create("Custom::Slow", func(ctx context.Context, d *HandlerDependencies, evt *CustomResourceEvent) (string, map[string]interface{}, error) {
+		time.Sleep(time.Second)
+		return "slow", nil, nil
+	})
+
+	Convey("CustomResourceRouter", t, func() {
+		Convey("Should send a SUCCESS response with the physical resource ID and data", func() {
+			err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("Custom::Widget", cfn.RequestCreate, ""))
+			So(err, ShouldBeNil)
+			So(lastRequest.Method, ShouldEqual, http.MethodPut)
+			So(lastRequest.URL.Path, ShouldEqual, "/presigned")
+			So(lastRequest.Header.Get("Content-Type"), ShouldEqual, "")
+			So(lastResponse.Status, ShouldEqual, cfn.StatusSuccess)
+			So(lastResponse.PhysicalResourceID, ShouldEqual, "widget-widget")
+			So(lastResponse.RequestID, ShouldEqual, "unique-id-for-this-request")
+			So(lastResponse.LogicalResourceID, ShouldEqual, "MyResource")
+			So(lastResponse.Data["Size"], ShouldEqual, "2")
+		})
+
+		Convey("Should send a FAILED response for handler errors and keep the physical resource ID", func() {
+			err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("Custom::Widget", cfn.RequestUpdate, "widget-widget"))
+			So(err, ShouldBeNil)
+			So(lastResponse.Status, ShouldEqual, cfn.StatusFailed)
+			So(lastResponse.Reason, ShouldEqual, "widgets can't be changed")
+			So(lastResponse.PhysicalResourceID, ShouldEqual, "widget-widget")
+		})
+
+		Convey("Should send a FAILED response when a handler panics", func() {
+			err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("Custom::Panic", cfn.RequestDelete, "panic"))
+			So(err, ShouldBeNil)
+			So(lastResponse.Status, ShouldEqual, cfn.StatusFailed)
+			So(lastResponse.Reason, ShouldContainSubstring, "oops")
+		})
+
+		Convey("Should send a FAILED response before the deadline", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			r := NewCustomResourceRouter()
+			r.Tracer = router.Tracer
+			r.handlers = router.handlers
+			r.DeadlineMargin = 100 * time.Millisecond
+			err := r.LambdaHandler(ctx, &HandlerDependencies{}, newEvent("Custom::Slow", cfn.RequestCreate, ""))
+			So(err, ShouldBeNil)
+			So(lastResponse.Status, ShouldEqual, cfn.StatusFailed)
+			So(lastResponse.Reason, ShouldContainSubstring, "deadline")
+			So(lastResponse.PhysicalResourceID, ShouldEqual, "MyResource")
+		})
+
+		Convey("Should send a FAILED response when there is no handler", func() {
+			err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("Custom::Unknown", cfn.RequestCreate, ""))
+			So(err, ShouldBeNil)
+			So(lastResponse.Status, ShouldEqual, cfn.StatusFailed)
+			So(lastResponse.Reason, ShouldEqual, "no handler for Custom::Unknown Create request")
+		})
+	})
+
+	Convey("Handlers should detect and decode custom resource events", t, func() {
+		evt := map[string]interface{}{
+			"RequestType":        "Create",
+			"ResponseURL":        server.URL + "/presigned",
+			"StackId":            "arn:aws:cloudformation:us-east-1:123456789012:stack/my-stack/guid",
+			"RequestId":          "unique-id-for-this-request",
+			"ResourceType":       "Custom::Widget",
+			"LogicalResourceId":  "MyResource",
+			"ResourceProperties": map[string]interface{}{"ServiceToken": "arn:aws:lambda:us-east-1:123456789012:function:widgets", "Name": "gear"},
+		}
+		So(getType(evt), ShouldEqual, "CustomResourceEvent")
+
+		h := Handlers{CustomResourceRouter: router}
+		_, err := h.eventHandler(context.Background(), &HandlerDependencies{}, evt)
+		So(err, ShouldBeNil)
+		So(lastResponse.Status, ShouldEqual, cfn.StatusSuccess)
+		So(lastResponse.PhysicalResourceID, ShouldEqual, "widget-gear")
+	})
+
+	Convey("Handlers should send a FAILED response when there is no CustomResourceRouter", t, func() {
+		h := Handlers{}
+		_, err := h.eventHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+			"RequestType":       "Delete",
+			"ResponseURL":       server.URL + "/presigned",
+			"StackId":           "arn:aws:cloudformation:us-east-1:123456789012:stack/my-stack/guid",
+			"RequestId":         "unique-id-for-this-request",
+			"ResourceType":      "Custom::Widget",
+			"LogicalResourceId": "MyResource",
+		})
+		So(err, ShouldBeNil)
+		So(lastResponse.Status, ShouldEqual, cfn.StatusFailed)
+		So(lastResponse.Reason, ShouldEqual, "no handlers registered for CustomResourceRouter")
+		So(lastResponse.LogicalResourceID, ShouldEqual, "MyResource")
+	})
+}
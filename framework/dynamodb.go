@@ -0,0 +1,329 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// DynamoDBStreamRouter struct provides an interface to handle DynamoDB Stream events (routers can be for a specific table or all tables)
+// https://docs.aws.amazon.com/lambda/latest/dg/with-ddb.html
+type DynamoDBStreamRouter struct {
+	handlers map[string]DynamoDBStreamHandler
+	// handlerKeys are the keys of handlers in the order they were registered, which is the order they're tried in
+	handlerKeys []string
+	Table       string
+	Tracer      TraceStrategy
+}
+
+// DynamoDBStreamHandler handles routed stream records. Unlike some other routers, the handler function receives
+// each matching record (not the entire event). Table and EventName (INSERT, MODIFY, REMOVE) are glob matches.
+type DynamoDBStreamHandler struct {
+	Handler   func(context.Context, *HandlerDependencies, *DynamoDBEventRecord) error
+	Table     string
+	EventName string
+}
+
+func init() {
+	// DynamoDB Streams have "Records" with an eventSource of "aws:dynamodb"
+	RegisterEventType(EventType{
+		Name:     "DynamoDBEvent",
+		Priority: 900,
+		Detect: func(evt map[string]interface{}) bool {
+			record := firstRecord(evt)
+			return record != nil && record["eventSource"] == "aws:dynamodb"
+		},
+		// Attribute values and epoch times have custom JSON unmarshalers, so mapstructure won't do here
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e DynamoDBEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.DynamoDBStreamRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return nil, h.DynamoDBStreamRouter.LambdaHandler(ctx, d, evt.(DynamoDBEvent))
+		},
+	})
+}
+
+// LambdaHandler handles DynamoDB Stream events. If a handler returns an error, processing stops and the error
+// is returned so that Lambda will retry the batch.
+func (r *DynamoDBStreamRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt DynamoDBEvent) error {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return errors.New("no handlers registered for DynamoDBStreamRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	var err error
+
+	for i := range evt.Records {
+		record := DynamoDBEventRecord(evt.Records[i])
+		tableName := record.TableName()
+
+		// If there are no handlers registered or the table doesn't match (if a table was defined for the router)
+		if r.handlers == nil || (r.Table != "" && r.Table != tableName) {
+			continue
+		}
+
+		handled := false
+		for _, k := range r.handlerKeys {
+			handler := r.handlers[k]
+			if k == "_" || !dynamoDBStreamHandlerMatch(handler, tableName, record.EventName) {
+				continue
+			}
+			handled = true
+			d.Tracer.Record("annotation",
+				map[string]interface{}{
+					"DynamoDBTable":     tableName,
+					"DynamoDBEventName": record.EventName,
+					"DynamoDBEventID":   record.EventID,
+				},
+			)
+			err = d.Tracer.Capture(ctx, "DynamoDBStreamHandler", func(ctx1 context.Context) error {
+				return handler.Handler(ctx1, d, &record)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// Otherwise, use the catch all (router "fallthrough" equivalent) handler.
+		// The application can inspect the record and make a decision on what to do, if anything.
+		// This is optional.
+		if !handled {
+			// It's possible that the DynamoDBStreamRouter wasn't created with NewDynamoDBStreamRouter, so check for this still.
+			if handler, ok := r.handlers["_"]; ok {
+				d.Tracer.Record("annotation",
+					map[string]interface{}{
+						"DynamoDBTable":      tableName,
+						"DynamoDBEventName":  record.EventName,
+						"DynamoDBEventID":    record.EventID,
+						"FallthroughHandler": true,
+					},
+				)
+				err = d.Tracer.Capture(ctx, "DynamoDBStreamHandler", func(ctx1 context.Context) error {
+					return handler.Handler(ctx1, d, &record)
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return err
+}
+
+// dynamoDBStreamHandlerMatch checks a handler's table and event name globs against a record (empty matches all)
+func dynamoDBStreamHandlerMatch(handler DynamoDBStreamHandler, tableName string, eventName string) bool {
+	return globMatch(handler.Table, tableName) && globMatch(handler.EventName, eventName)
+}
+
+// Listen will start a DynamoDB Stream event listener that handles incoming record changes (insert, modify, remove)
+func (r *DynamoDBStreamRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewDynamoDBStreamRouter simply returns a new DynamoDBStreamRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewDynamoDBStreamRouter(rootHandler ...func(context.Context, *HandlerDependencies, *DynamoDBEventRecord) error) *DynamoDBStreamRouter {
+	// The catch all is optional, if not provided, an empty handler is still called and it returns nothing.
+	handler := DynamoDBStreamHandler{
+		Handler: func(context.Context, *HandlerDependencies, *DynamoDBEventRecord) error {
+			return nil
+		},
+	}
+	if len(rootHandler) > 0 {
+		handler = DynamoDBStreamHandler{
+			Handler: rootHandler[0],
+		}
+	}
+	return &DynamoDBStreamRouter{
+		handlers: map[string]DynamoDBStreamHandler{
+			"_": handler,
+		},
+	}
+}
+
+// NewDynamoDBStreamRouterForTable is the same as NewDynamoDBStreamRouter except it's for a specific table (you could also set the Table field after using the other function)
+func NewDynamoDBStreamRouterForTable(table string, rootHandler ...func(context.Context, *HandlerDependencies, *DynamoDBEventRecord) error) *DynamoDBStreamRouter {
+	r := NewDynamoDBStreamRouter(rootHandler...)
+	// Just convenience
+	r.Table = table
+	return r
+}
+
+// Handle will register a handler for a given table name and event name glob match (INSERT, MODIFY, REMOVE).
+// An empty string for either will match any table or event.
+func (r *DynamoDBStreamRouter) Handle(table string, eventName string, handler func(context.Context, *HandlerDependencies, *DynamoDBEventRecord) error) {
+	if r.handlers == nil {
+		r.handlers = make(map[string]DynamoDBStreamHandler)
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(table)
+	buffer.WriteString(":")
+	buffer.WriteString(eventName)
+	k := buffer.String()
+	buffer.Reset()
+	if _, ok := r.handlers[k]; !ok {
+		r.handlerKeys = append(r.handlerKeys, k)
+	}
+	r.handlers[k] = DynamoDBStreamHandler{
+		Handler:   handler,
+		Table:     table,
+		EventName: eventName,
+	}
+}
+
+// Insert is the same as Handle only the event name is already implied.
+func (r *DynamoDBStreamRouter) Insert(table string, handler func(context.Context, *HandlerDependencies, *DynamoDBEventRecord) error) {
+	r.Handle(table, string(events.DynamoDBOperationTypeInsert), handler)
+}
+
+// Modify is the same as Handle only the event name is already implied.
+func (r *DynamoDBStreamRouter) Modify(table string, handler func(context.Context, *HandlerDependencies, *DynamoDBEventRecord) error) {
+	r.Handle(table, string(events.DynamoDBOperationTypeModify), handler)
+}
+
+// Remove is the same as Handle only the event name is already implied.
+func (r *DynamoDBStreamRouter) Remove(table string, handler func(context.Context, *HandlerDependencies, *DynamoDBEventRecord) error) {
+	r.Handle(table, string(events.DynamoDBOperationTypeRemove), handler)
+}
+
+// GetTableNameFromARN will get the DynamoDB table name given a table or stream ARN string
+// ie. arn:aws:dynamodb:us-east-1:123456789012:table/ExampleTable/stream/2015-06-27T00:48:05.899
+func GetTableNameFromARN(arn string) string {
+	p := strings.Split(arn, "/")
+	if len(p) > 1 {
+		return p[1]
+	}
+	return ""
+}
+
+// TableName returns the name of the table the stream record came from
+func (r *DynamoDBEventRecord) TableName() string {
+	return GetTableNameFromARN(r.EventSourceArn)
+}
+
+// Keys returns the primary key attribute(s) of the modified item as a plain map
+func (r *DynamoDBEventRecord) Keys() map[string]interface{} {
+	return DynamoDBImageToMap(r.Change.Keys)
+}
+
+// NewImage returns the item as it appeared after it was modified as a plain map (nil for REMOVE events or KEYS_ONLY streams)
+func (r *DynamoDBEventRecord) NewImage() map[string]interface{} {
+	return DynamoDBImageToMap(r.Change.NewImage)
+}
+
+// OldImage returns the item as it appeared before it was modified as a plain map (nil for INSERT events or KEYS_ONLY streams)
+func (r *DynamoDBEventRecord) OldImage() map[string]interface{} {
+	return DynamoDBImageToMap(r.Change.OldImage)
+}
+
+// UnmarshalNewImage will decode the item as it appeared after it was modified into v (using `json` struct tags)
+func (r *DynamoDBEventRecord) UnmarshalNewImage(v interface{}) error {
+	return UnmarshalDynamoDBImage(r.Change.NewImage, v)
+}
+
+// UnmarshalOldImage will decode the item as it appeared before it was modified into v (using `json` struct tags)
+func (r *DynamoDBEventRecord) UnmarshalOldImage(v interface{}) error {
+	return UnmarshalDynamoDBImage(r.Change.OldImage, v)
+}
+
+// DynamoDBImageToMap converts a DynamoDB Stream image (attribute value form) into a plain map.
+// Numbers become int64 when possible (float64 otherwise), binary values become []byte and sets become slices.
+func DynamoDBImageToMap(image map[string]events.DynamoDBAttributeValue) map[string]interface{} {
+	if image == nil {
+		return nil
+	}
+	m := make(map[string]interface{}, len(image))
+	for k, av := range image {
+		m[k] = dynamoDBAttributeValueToInterface(av)
+	}
+	return m
+}
+
+// UnmarshalDynamoDBImage will decode a DynamoDB Stream image (attribute value form) into v by way of JSON,
+// so the struct fields should use `json` tags.
+func UnmarshalDynamoDBImage(image map[string]events.DynamoDBAttributeValue, v interface{}) error {
+	b, err := json.Marshal(DynamoDBImageToMap(image))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// dynamoDBAttributeValueToInterface converts a single attribute value into a plain Go value
+func dynamoDBAttributeValueToInterface(av events.DynamoDBAttributeValue) interface{} {
+	switch av.DataType() {
+	case events.DataTypeString:
+		return av.String()
+	case events.DataTypeNumber:
+		return dynamoDBNumber(av.Number())
+	case events.DataTypeBinary:
+		return av.Binary()
+	case events.DataTypeBoolean:
+		return av.Boolean()
+	case events.DataTypeNull:
+		return nil
+	case events.DataTypeList:
+		list := av.List()
+		l := make([]interface{}, len(list))
+		for i, item := range list {
+			l[i] = dynamoDBAttributeValueToInterface(item)
+		}
+		return l
+	case events.DataTypeMap:
+		return DynamoDBImageToMap(av.Map())
+	case events.DataTypeStringSet:
+		return av.StringSet()
+	case events.DataTypeNumberSet:
+		set := av.NumberSet()
+		l := make([]interface{}, len(set))
+		for i, n := range set {
+			l[i] = dynamoDBNumber(n)
+		}
+		return l
+	case events.DataTypeBinarySet:
+		return av.BinarySet()
+	}
+	return nil
+}
+
+// dynamoDBNumber converts DynamoDB's string number representation into an int64 or float64
+func dynamoDBNumber(n string) interface{} {
+	if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(n, 64); err == nil {
+		return f
+	}
+	return n
+}
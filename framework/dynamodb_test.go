@@ -0,0 +1,205 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	events "github.com/aws/aws-lambda-go/events"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDynamoDBStreamRouter(t *testing.T) {
+
+	tableRouter := NewDynamoDBStreamRouterForTable("ExampleTable")
+	// Note: If a Tracer is not set, there will be a panic
+	tableRouter.Tracer = NoTraceStrategy{}
+
+	// Fake event and record
+	record := events.DynamoDBEventRecord{
+		EventID:        "1",
+		EventName:      "INSERT",
+		EventSource:    "aws:dynamodb",
+		EventSourceArn: "arn:aws:dynamodb:us-east-1:123456789012:table/ExampleTable/stream/2015-06-27T00:48:05.899",
+		Change: events.DynamoDBStreamRecord{
+			Keys: map[string]events.DynamoDBAttributeValue{
+				"Id": events.NewNumberAttribute("101"),
+			},
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"Id":      events.NewNumberAttribute("101"),
+				"Message": events.NewStringAttribute("New item!"),
+				"Price":   events.NewNumberAttribute("9.99"),
+				"Tags":    events.NewStringSetAttribute([]string{"a", "b"}),
+				"Meta": events.NewMapAttribute(map[string]events.DynamoDBAttributeValue{
+					"Active": events.NewBooleanAttribute(true),
+				}),
+			},
+		},
+	}
+	insertEvt := DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{record},
+	}
+
+	Convey("NewDynamoDBStreamRouterForTable()", t, func() {
+
+		Convey("Should create a new DynamoDBStreamRouter for a specific table", func() {
+			So(tableRouter, ShouldNotBeNil)
+			So(tableRouter.Table, ShouldEqual, "ExampleTable")
+		})
+
+		Convey("Should handle any stream record with a fall through handler", func() {
+			handled := false
+			routerWithFallthrough := NewDynamoDBStreamRouterForTable("ExampleTable", func(ctx context.Context, d *HandlerDependencies, r *DynamoDBEventRecord) error {
+				So(r.EventID, ShouldEqual, "1")
+				handled = true
+				return nil
+			})
+			routerWithFallthrough.Tracer = NoTraceStrategy{}
+			routerWithFallthrough.LambdaHandler(context.Background(), &HandlerDependencies{}, insertEvt)
+			So(handled, ShouldBeTrue)
+		})
+
+		Convey("Should not handle records from other tables", func() {
+			handled := false
+			otherRouter := NewDynamoDBStreamRouterForTable("OtherTable", func(ctx context.Context, d *HandlerDependencies, r *DynamoDBEventRecord) error {
+				handled = true
+				return nil
+			})
+			otherRouter.Tracer = NoTraceStrategy{}
+			otherRouter.LambdaHandler(context.Background(), &HandlerDependencies{}, insertEvt)
+			So(handled, ShouldBeFalse)
+		})
+
+		Convey("Insert() should handle an INSERT record for a matching table", func() {
+			handled := false
+			modified := false
+			tableRouter.Insert("Example*", func(ctx context.Context, d *HandlerDependencies, r *DynamoDBEventRecord) error {
+				So(r.TableName(), ShouldEqual, "ExampleTable")
+				handled = true
+				return nil
+			})
+			tableRouter.Modify("ExampleTable", func(ctx context.Context, d *HandlerDependencies, r *DynamoDBEventRecord) error {
+				modified = true
+				return nil
+			})
+			tableRouter.LambdaHandler(context.Background(), &HandlerDependencies{}, insertEvt)
+			So(handled, ShouldBeTrue)
+			So(modified, ShouldBeFalse)
+		})
+
+		Convey("Should call matching handlers in the order they were added", func() {
+			for i := 0; i < 10; i++ {
+				called := []string{}
+				orderRouter := NewDynamoDBStreamRouter()
+				orderRouter.Tracer = NoTraceStrategy{}
+				for _, table := range []string{"Example*", "*", "ExampleTable"} {
+					table := table
+					orderRouter.Insert(table, func(ctx context.Context, d *HandlerDependencies, r *DynamoDBEventRecord) error {
+						called = append(called, table)
+						return nil
+					})
+				}
+				orderRouter.LambdaHandler(context.Background(), &HandlerDependencies{}, insertEvt)
+				So(called, ShouldResemble, []string{"Example*", "*", "ExampleTable"})
+			}
+		})
+
+		Convey("Should return handler errors", func() {
+			errRouter := NewDynamoDBStreamRouter()
+			errRouter.Tracer = &errorTraceStrategy{}
+			errRouter.Handle("", "INSERT", func(ctx context.Context, d *HandlerDependencies, r *DynamoDBEventRecord) error {
+				return errors.New("failed")
+			})
+			err := errRouter.LambdaHandler(context.Background(), &HandlerDependencies{}, insertEvt)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("DynamoDBEventRecord", t, func() {
+		r := DynamoDBEventRecord(record)
+
+		Convey("NewImage() should decode attribute values into a plain map", func() {
+			image := r.NewImage()
+			So(image["Id"], ShouldEqual, int64(101))
+			So(image["Message"], ShouldEqual, "New item!")
+			So(image["Price"], ShouldEqual, 9.99)
+			So(image["Tags"], ShouldResemble, []string{"a", "b"})
+			So(image["Meta"].(map[string]interface{})["Active"], ShouldBeTrue)
+			So(r.OldImage(), ShouldBeNil)
+			So(r.Keys()["Id"], ShouldEqual, int64(101))
+		})
+
+		Convey("UnmarshalNewImage() should decode attribute values into a struct", func() {
+			var item struct {
+				ID      int      `json:"Id"`
+				Message string   `json:"Message"`
+				Price   float64  `json:"Price"`
+				Tags    []string `json:"Tags"`
+			}
+			err := r.UnmarshalNewImage(&item)
+			So(err, ShouldBeNil)
+			So(item.ID, ShouldEqual, 101)
+			So(item.Message, ShouldEqual, "New item!")
+			So(item.Price, ShouldEqual, 9.99)
+			So(item.Tags, ShouldResemble, []string{"a", "b"})
+		})
+	})
+
+	Convey("Handlers should detect and decode DynamoDB Stream events", t, func() {
+		So(getType(map[string]interface{}{"Records": []interface{}{
+			map[string]interface{}{"eventSource": "aws:dynamodb"},
+		}}), ShouldEqual, "DynamoDBEvent")
+
+		handled := false
+		router := NewDynamoDBStreamRouter()
+		router.Tracer = NoTraceStrategy{}
+		router.Insert("", func(ctx context.Context, d *HandlerDependencies, r *DynamoDBEventRecord) error {
+			So(r.NewImage()["Message"], ShouldEqual, "hello")
+			handled = true
+			return nil
+		})
+		h := Handlers{DynamoDBStreamRouter: router}
+		_, err := h.eventHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+			"Records": []interface{}{
+				map[string]interface{}{
+					"eventID":        "1",
+					"eventName":      "INSERT",
+					"eventSource":    "aws:dynamodb",
+					"eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/ExampleTable/stream/2015-06-27T00:48:05.899",
+					"dynamodb": map[string]interface{}{
+						"ApproximateCreationDateTime": 1479499740,
+						"NewImage": map[string]interface{}{
+							"Message": map[string]interface{}{"S": "hello"},
+						},
+					},
+				},
+			},
+		})
+		So(err, ShouldBeNil)
+		So(handled, ShouldBeTrue)
+	})
+}
+
+// errorTraceStrategy is a NoTraceStrategy that returns the error from captured functions
+type errorTraceStrategy struct {
+	NoTraceStrategy
+}
+
+// Capture in this case just executes the function it's wrapping and returns its error
+func (t errorTraceStrategy) Capture(ctx context.Context, name string, fn func(context.Context) error) error {
+	return fn(ctx)
+}
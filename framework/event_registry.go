@@ -0,0 +1,174 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// EventType describes a kind of Lambda event that Aegis knows how to handle. Each router registers its own
+// EventType (see the init() functions in router.go, s3.go, etc.) and applications can register their own too.
+//
+// Handlers checks each registered EventType's Detect function in Priority order (lowest first). The first one
+// to match decodes the raw event and dispatches it. The built-in event types use priorities in steps of 100,
+// so custom event types can be placed before, after, or in between them. Event types that look like API Gateway
+// proxy requests (Application Load Balancer, WebSocket API and REQUEST authorizer events) are below 100, so that
+// they're detected first.
+type EventType struct {
+	// Name identifies the event type (ie. "S3Event"), registering a type with an existing name replaces it
+	Name string
+	// Priority determines the order in which event types are detected, lower values are checked first
+	Priority int
+	// Detect returns true when the raw Lambda event is of this type
+	Detect func(evt map[string]interface{}) bool
+	// DetectFor is used instead of Detect when detecting the event type depends on how a router on Handlers is
+	// configured (ie. the StepFunctionsRouter's StateField), h is nil if the event isn't being handled by Handlers
+	DetectFor func(h *Handlers, evt map[string]interface{}) bool
+	// Decode converts the raw Lambda event into the value passed to Dispatch (the raw map is passed if nil)
+	Decode func(evt map[string]interface{}) (interface{}, error)
+	// Handled returns false when Handlers can't handle the event, typically because its router isn't set, in which
+	// case DefaultHandler is used instead (the event is always dispatched if nil)
+	Handled func(h *Handlers) bool
+	// Dispatch handles the decoded event, typically by passing it to a router on Handlers (DefaultHandler is used if nil)
+	Dispatch func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error)
+}
+
+// BatchEventKey is the key that events sent to Lambda as a JSON list (rather than an object), such as AppSync
+// BatchInvoke events, are found under. Detect functions for these event types should look for this key.
+const BatchEventKey = "_batch"
+
+// eventTypeRegistry holds all registered event types, sorted by priority
+var eventTypeRegistry = struct {
+	sync.RWMutex
+	types []EventType
+}{}
+
+// RegisterEventType will add an EventType to the registry used by Handlers to detect and dispatch Lambda events.
+// If an EventType with the same name was already registered, it will be replaced.
+func RegisterEventType(t EventType) {
+	eventTypeRegistry.Lock()
+	defer eventTypeRegistry.Unlock()
+
+	replaced := false
+	for i, existing := range eventTypeRegistry.types {
+		if existing.Name == t.Name {
+			eventTypeRegistry.types[i] = t
+			replaced = true
+		}
+	}
+	if !replaced {
+		eventTypeRegistry.types = append(eventTypeRegistry.types, t)
+	}
+
+	// Stable so that event types with the same priority are detected in the order they were registered
+	sort.SliceStable(eventTypeRegistry.types, func(i, j int) bool {
+		return eventTypeRegistry.types[i].Priority < eventTypeRegistry.types[j].Priority
+	})
+}
+
+// unregisterEventType removes an EventType from the registry by name (used by tests to clean up after themselves)
+func unregisterEventType(name string) {
+	eventTypeRegistry.Lock()
+	defer eventTypeRegistry.Unlock()
+
+	types := eventTypeRegistry.types[:0]
+	for _, t := range eventTypeRegistry.types {
+		if t.Name != name {
+			types = append(types, t)
+		}
+	}
+	eventTypeRegistry.types = types
+}
+
+// RegisteredEventTypes returns all registered event types in the order they will be detected
+func RegisteredEventTypes() []EventType {
+	eventTypeRegistry.RLock()
+	defer eventTypeRegistry.RUnlock()
+
+	types := make([]EventType, len(eventTypeRegistry.types))
+	copy(types, eventTypeRegistry.types)
+	return types
+}
+
+// detectEventType returns the first registered EventType (by priority) whose detector matches the event
+func detectEventType(h *Handlers, evt map[string]interface{}) (EventType, bool) {
+	for _, t := range RegisteredEventTypes() {
+		if t.DetectFor != nil {
+			if t.DetectFor(h, evt) {
+				return t, true
+			}
+			continue
+		}
+		if t.Detect != nil && t.Detect(evt) {
+			return t, true
+		}
+	}
+	return EventType{}, false
+}
+
+// DecodeEvent will decode a raw Lambda event into the given result (a pointer to a struct) using mapstructure.
+// Event times are typically formatted like 2018-04-02T17:09:32.273Z and mapstructure does not handle string to
+// time.Time automatically, so an RFC3339Nano hook is used unless other decode hooks are provided.
+func DecodeEvent(evt map[string]interface{}, result interface{}, hooks ...mapstructure.DecodeHookFunc) error {
+	if len(hooks) == 0 {
+		hooks = []mapstructure.DecodeHookFunc{mapstructure.StringToTimeHookFunc(time.RFC3339Nano)}
+	}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(hooks...),
+		Result:     result,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(evt)
+}
+
+// DecodeEventJSON will decode a raw Lambda event into the given result by way of JSON. This is slower than DecodeEvent(),
+// but it is necessary for types that rely on JSON struct tags or custom unmarshalers (epoch times, base64 data, etc.)
+func DecodeEventJSON(evt map[string]interface{}, result interface{}) error {
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, result)
+}
+
+// UnmarshalEvent will decode a raw Lambda event. Events are almost always JSON objects, but a JSON list is put
+// under the BatchEventKey key so it can still be detected and dispatched like any other event.
+func UnmarshalEvent(raw []byte) (map[string]interface{}, error) {
+	var evt map[string]interface{}
+	var batch []interface{}
+	if err := json.Unmarshal(raw, &batch); err == nil {
+		return map[string]interface{}{BatchEventKey: batch}, nil
+	}
+	err := json.Unmarshal(raw, &evt)
+	return evt, err
+}
+
+// firstRecord returns the first item under a "Records" key (S3, SES, SQS, etc. events) or nil if there isn't one
+func firstRecord(evt map[string]interface{}) map[string]interface{} {
+	if records, ok := evt["Records"].([]interface{}); ok && len(records) > 0 {
+		if record, ok := records[0].(map[string]interface{}); ok {
+			return record
+		}
+	}
+	return nil
+}
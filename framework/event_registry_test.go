@@ -0,0 +1,143 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventRegistry(t *testing.T) {
+
+	type widgetEvent struct {
+		WidgetID string
+		Created  time.Time
+	}
+
+	Convey("RegisterEventType()", t, func() {
+		// The registry is global, so the event types registered here must not leak into other tests
+		Reset(func() {
+			unregisterEventType("TestWidgetEvent")
+			unregisterEventType("TestPriorityWidgetEvent")
+			unregisterEventType("TestDispatchlessWidgetEvent")
+		})
+
+		RegisterEventType(EventType{
+			Name:     "TestWidgetEvent",
+			Priority: 10000,
+			Detect: func(evt map[string]interface{}) bool {
+				return keyInMap("widgetId", evt)
+			},
+			Decode: func(evt map[string]interface{}) (interface{}, error) {
+				var e widgetEvent
+				err := DecodeEvent(evt, &e)
+				return e, err
+			},
+			Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+				return evt.(widgetEvent).WidgetID, nil
+			},
+		})
+
+		Convey("Should make the event type detectable", func() {
+			So(getType(map[string]interface{}{"widgetId": "abc"}), ShouldEqual, "TestWidgetEvent")
+		})
+
+		Convey("Should dispatch the decoded event from Handlers", func() {
+			h := Handlers{}
+			res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+				"widgetId": "abc",
+				"created":  "2018-04-02T17:09:32.273Z",
+			})
+			So(err, ShouldBeNil)
+			So(res, ShouldEqual, "abc")
+		})
+
+		Convey("Should detect event types in priority order", func() {
+			RegisterEventType(EventType{
+				Name:     "TestPriorityWidgetEvent",
+				Priority: 9999,
+				Detect: func(evt map[string]interface{}) bool {
+					return keyInMap("widgetId", evt) && keyInMap("priority", evt)
+				},
+			})
+			So(getType(map[string]interface{}{"widgetId": "abc", "priority": true}), ShouldEqual, "TestPriorityWidgetEvent")
+			So(getType(map[string]interface{}{"widgetId": "abc"}), ShouldEqual, "TestWidgetEvent")
+		})
+
+		Convey("Should replace an event type with the same name", func() {
+			count := len(RegisteredEventTypes())
+			RegisterEventType(EventType{
+				Name:     "TestWidgetEvent",
+				Priority: 10000,
+				Detect: func(evt map[string]interface{}) bool {
+					return false
+				},
+			})
+			So(RegisteredEventTypes(), ShouldHaveLength, count)
+			So(getType(map[string]interface{}{"widgetId": "abc"}), ShouldEqual, "")
+		})
+
+		Convey("Should be able to remove an event type", func() {
+			count := len(RegisteredEventTypes())
+			unregisterEventType("TestWidgetEvent")
+			So(RegisteredEventTypes(), ShouldHaveLength, count-1)
+			So(getType(map[string]interface{}{"widgetId": "abc"}), ShouldEqual, "")
+		})
+
+		Convey("Should use DefaultHandler for detected event types without a Dispatch function", func() {
+			RegisterEventType(EventType{
+				Name:     "TestDispatchlessWidgetEvent",
+				Priority: 9998,
+				Detect: func(evt map[string]interface{}) bool {
+					return keyInMap("widgetId", evt) && keyInMap("dispatchless", evt)
+				},
+			})
+			handled := false
+			h := Handlers{
+				DefaultHandler: func(ctx context.Context, d *HandlerDependencies, evt *map[string]interface{}) (interface{}, error) {
+					handled = true
+					return nil, nil
+				},
+			}
+			_, err := h.eventHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{"widgetId": "abc", "dispatchless": true})
+			So(err, ShouldBeNil)
+			So(handled, ShouldBeTrue)
+		})
+	})
+
+	Convey("DecodeEvent()", t, func() {
+		Convey("Should decode time strings by default", func() {
+			var e widgetEvent
+			err := DecodeEvent(map[string]interface{}{"widgetId": "abc", "created": "2018-04-02T17:09:32.273Z"}, &e)
+			So(err, ShouldBeNil)
+			So(e.WidgetID, ShouldEqual, "abc")
+			So(e.Created.Year(), ShouldEqual, 2018)
+		})
+	})
+
+	Convey("DecodeEventJSON()", t, func() {
+		Convey("Should decode an event using JSON struct tags", func() {
+			var e struct {
+				DetailType string `json:"detail-type"`
+			}
+			err := DecodeEventJSON(map[string]interface{}{"detail-type": "Scheduled Event"}, &e)
+			So(err, ShouldBeNil)
+			So(e.DetailType, ShouldEqual, "Scheduled Event")
+		})
+	})
+}
@@ -0,0 +1,415 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// EventBridgeRouter struct provides an interface to handle EventBridge (CloudWatch Events) events
+// https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-run-lambda-schedule.html
+type EventBridgeRouter struct {
+	handlers map[string]EventBridgeHandler
+	// handlerKeys are the keys of handlers in the order they were registered, which is the order they're called in
+	handlerKeys []string
+	Tracer      TraceStrategy
+}
+
+// EventBridgeHandler handles routed events. Source, DetailType and Rule are glob matches (Rule is matched against the
+// names of the rules in the event's resources). Pattern is an EventBridge content filtering pattern applied to the
+// event's detail. Empty values match anything.
+// https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-event-patterns-content-based-filtering.html
+type EventBridgeHandler struct {
+	Handler    func(context.Context, *HandlerDependencies, *CloudWatchEvent) error
+	Source     string
+	DetailType string
+	Rule       string
+	Pattern    map[string]interface{}
+}
+
+const (
+	// EventBridgeScheduledEventSource is the source of scheduled (cron or rate expression) events
+	EventBridgeScheduledEventSource = "aws.events"
+	// EventBridgeScheduledEventDetailType is the detail-type of scheduled (cron or rate expression) events
+	EventBridgeScheduledEventDetailType = "Scheduled Event"
+)
+
+func init() {
+	// EventBridge events have a "detail-type" and "source"
+	// Note: Scheduled events configured with a constant input that includes _taskName are AegisTask events instead.
+	RegisterEventType(EventType{
+		Name:     "CloudWatchEvent",
+		Priority: 1200,
+		Detect: func(evt map[string]interface{}) bool {
+			return keyInMap("detail-type", evt) && keyInMap("source", evt)
+		},
+		// The "detail-type" key and raw "detail" need JSON struct tags
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e CloudWatchEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.EventBridgeRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return nil, h.EventBridgeRouter.LambdaHandler(ctx, d, evt.(CloudWatchEvent))
+		},
+	})
+}
+
+// LambdaHandler handles EventBridge (CloudWatch Events) events
+func (r *EventBridgeRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt CloudWatchEvent) error {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return errors.New("no handlers registered for EventBridgeRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	var err error
+	handled := false
+
+	// The detail is only decoded if a handler has a pattern
+	var detail map[string]interface{}
+	detailDecoded := false
+
+	for _, k := range r.handlerKeys {
+		handler := r.handlers[k]
+		if k == "_" || !eventBridgeHandlerMatch(handler, &evt) {
+			continue
+		}
+		if len(handler.Pattern) > 0 {
+			if !detailDecoded {
+				evt.UnmarshalDetail(&detail)
+				detailDecoded = true
+			}
+			if !EventPatternMatch(handler.Pattern, detail) {
+				continue
+			}
+		}
+		handled = true
+		d.Tracer.Record("annotation",
+			map[string]interface{}{
+				"EventBridgeSource":     evt.Source,
+				"EventBridgeDetailType": evt.DetailType,
+				"EventBridgeEventID":    evt.ID,
+			},
+		)
+		err = d.Tracer.Capture(ctx, "EventBridgeHandler", func(ctx1 context.Context) error {
+			return handler.Handler(ctx1, d, &evt)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Otherwise, use the catch all (router "fallthrough" equivalent) handler.
+	// The application can inspect the event and make a decision on what to do, if anything.
+	// This is optional.
+	if !handled {
+		// It's possible that the EventBridgeRouter wasn't created with NewEventBridgeRouter, so check for this still.
+		if handler, ok := r.handlers["_"]; ok {
+			d.Tracer.Record("annotation",
+				map[string]interface{}{
+					"EventBridgeSource":     evt.Source,
+					"EventBridgeDetailType": evt.DetailType,
+					"EventBridgeEventID":    evt.ID,
+					"FallthroughHandler":    true,
+				},
+			)
+			err = d.Tracer.Capture(ctx, "EventBridgeHandler", func(ctx1 context.Context) error {
+				return handler.Handler(ctx1, d, &evt)
+			})
+		}
+	}
+
+	return err
+}
+
+// eventBridgeHandlerMatch checks a handler's source, detail-type and rule globs against an event (empty matches all)
+func eventBridgeHandlerMatch(handler EventBridgeHandler, evt *CloudWatchEvent) bool {
+	if !globMatch(handler.Source, evt.Source) || !globMatch(handler.DetailType, evt.DetailType) {
+		return false
+	}
+	if handler.Rule != "" {
+		for _, rule := range evt.RuleNames() {
+			if globMatch(handler.Rule, rule) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Listen will start an EventBridge event listener that handles incoming events
+func (r *EventBridgeRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewEventBridgeRouter simply returns a new EventBridgeRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewEventBridgeRouter(rootHandler ...func(context.Context, *HandlerDependencies, *CloudWatchEvent) error) *EventBridgeRouter {
+	// The catch all is optional, if not provided, an empty handler is still called and it returns nothing.
+	handler := EventBridgeHandler{
+		Handler: func(context.Context, *HandlerDependencies, *CloudWatchEvent) error {
+			return nil
+		},
+	}
+	if len(rootHandler) > 0 {
+		handler = EventBridgeHandler{
+			Handler: rootHandler[0],
+		}
+	}
+	return &EventBridgeRouter{
+		handlers: map[string]EventBridgeHandler{
+			"_": handler,
+		},
+	}
+}
+
+// Handle will register a handler for a given source and detail-type glob match.
+// An empty string for either will match any source or detail-type.
+func (r *EventBridgeRouter) Handle(source string, detailType string, handler func(context.Context, *HandlerDependencies, *CloudWatchEvent) error) {
+	r.addHandler(EventBridgeHandler{
+		Handler:    handler,
+		Source:     source,
+		DetailType: detailType,
+	})
+}
+
+// HandlePattern is the same as Handle, but the event's detail must also match the given EventBridge content pattern.
+// Patterns are the same as those used by EventBridge rules, ie. {"state": []string{"running"}} or
+// {"size": []interface{}{map[string]interface{}{"numeric": []interface{}{">", 100}}}}
+// Patterns are normalized through JSON, so if the pattern can't be marshaled this will panic.
+func (r *EventBridgeRouter) HandlePattern(source string, detailType string, pattern map[string]interface{}, handler func(context.Context, *HandlerDependencies, *CloudWatchEvent) error) {
+	// Normalize the pattern so []string, int, etc. compare the same way as the decoded event detail
+	b, err := json.Marshal(pattern)
+	if err != nil {
+		panic("Invalid EventBridge pattern: " + err.Error())
+	}
+	var normalized map[string]interface{}
+	json.Unmarshal(b, &normalized)
+
+	r.addHandler(EventBridgeHandler{
+		Handler:    handler,
+		Source:     source,
+		DetailType: detailType,
+		Pattern:    normalized,
+	})
+}
+
+// HandleScheduled will register a handler for scheduled events triggered by a given rule name glob match.
+// An empty string will match any scheduled event.
+func (r *EventBridgeRouter) HandleScheduled(rule string, handler func(context.Context, *HandlerDependencies, *CloudWatchEvent) error) {
+	r.addHandler(EventBridgeHandler{
+		Handler:    handler,
+		Source:     EventBridgeScheduledEventSource,
+		DetailType: EventBridgeScheduledEventDetailType,
+		Rule:       rule,
+	})
+}
+
+// addHandler registers an EventBridgeHandler keyed by its matching rules
+func (r *EventBridgeRouter) addHandler(h EventBridgeHandler) {
+	if r.handlers == nil {
+		r.handlers = make(map[string]EventBridgeHandler)
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(h.Source)
+	buffer.WriteString(":")
+	buffer.WriteString(h.DetailType)
+	buffer.WriteString(":")
+	buffer.WriteString(h.Rule)
+	if h.Pattern != nil {
+		b, _ := json.Marshal(h.Pattern)
+		buffer.WriteString(":")
+		buffer.Write(b)
+	}
+	k := buffer.String()
+	buffer.Reset()
+	if _, ok := r.handlers[k]; !ok {
+		r.handlerKeys = append(r.handlerKeys, k)
+	}
+	r.handlers[k] = h
+}
+
+// GetRuleNameFromARN will get the EventBridge rule name given a rule ARN string
+// ie. arn:aws:events:us-east-1:123456789012:rule/example-rule
+func GetRuleNameFromARN(arn string) string {
+	p := strings.SplitN(arn, ":rule/", 2)
+	if len(p) > 1 {
+		return p[1]
+	}
+	return ""
+}
+
+// RuleNames returns the names of any rules found in the event's resources (typically one for scheduled events)
+func (evt *CloudWatchEvent) RuleNames() []string {
+	names := []string{}
+	for _, resource := range evt.Resources {
+		if name := GetRuleNameFromARN(resource); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// IsScheduled returns true if the event was triggered by a schedule (cron or rate expression)
+func (evt *CloudWatchEvent) IsScheduled() bool {
+	return evt.Source == EventBridgeScheduledEventSource && evt.DetailType == EventBridgeScheduledEventDetailType
+}
+
+// UnmarshalDetail will decode the event's detail as JSON into v
+func (evt *CloudWatchEvent) UnmarshalDetail(v interface{}) error {
+	if len(evt.Detail) == 0 {
+		return nil
+	}
+	return json.Unmarshal(evt.Detail, v)
+}
+
+// EventPatternMatch returns true if the value (ie. an event's decoded detail) matches an EventBridge content pattern.
+// Supported are exact values, "prefix", "anything-but", "exists" and "numeric" matching.
+// Both the pattern and value should be decoded from JSON (numbers as float64, arrays as []interface{}).
+func EventPatternMatch(pattern map[string]interface{}, value map[string]interface{}) bool {
+	for k, p := range pattern {
+		v, exists := value[k]
+		switch pt := p.(type) {
+		case map[string]interface{}:
+			// Nested pattern
+			sub, ok := v.(map[string]interface{})
+			if !ok || !EventPatternMatch(pt, sub) {
+				return false
+			}
+		case []interface{}:
+			if !eventPatternValuesMatch(pt, v, exists) {
+				return false
+			}
+		default:
+			// A single value is the same as a list with one value
+			if !eventPatternValuesMatch([]interface{}{pt}, v, exists) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// eventPatternValuesMatch returns true if any of the rules match the value (or any value, if the value is an array)
+func eventPatternValuesMatch(rules []interface{}, v interface{}, exists bool) bool {
+	var values []interface{}
+	if exists {
+		if l, ok := v.([]interface{}); ok {
+			values = l
+		} else {
+			values = []interface{}{v}
+		}
+	}
+
+	for _, rule := range rules {
+		if m, ok := rule.(map[string]interface{}); ok {
+			if e, ok := m["exists"]; ok {
+				if e == exists {
+					return true
+				}
+				continue
+			}
+		}
+		for _, value := range values {
+			if eventPatternRuleMatch(rule, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// eventPatternRuleMatch returns true if a single value matches a single pattern rule
+func eventPatternRuleMatch(rule interface{}, value interface{}) bool {
+	m, ok := rule.(map[string]interface{})
+	if !ok {
+		return reflect.DeepEqual(rule, value)
+	}
+
+	if prefix, ok := m["prefix"].(string); ok {
+		s, ok := value.(string)
+		return ok && strings.HasPrefix(s, prefix)
+	}
+
+	if anythingBut, ok := m["anything-but"]; ok {
+		switch ab := anythingBut.(type) {
+		case []interface{}:
+			for _, a := range ab {
+				if reflect.DeepEqual(a, value) {
+					return false
+				}
+			}
+			return true
+		case map[string]interface{}:
+			if prefix, ok := ab["prefix"].(string); ok {
+				s, ok := value.(string)
+				return !ok || !strings.HasPrefix(s, prefix)
+			}
+			return false
+		default:
+			return !reflect.DeepEqual(ab, value)
+		}
+	}
+
+	if numeric, ok := m["numeric"].([]interface{}); ok {
+		n, ok := value.(float64)
+		if !ok || len(numeric)%2 != 0 {
+			return false
+		}
+		for i := 0; i < len(numeric); i += 2 {
+			op, _ := numeric[i].(string)
+			operand, ok := numeric[i+1].(float64)
+			if !ok {
+				return false
+			}
+			switch op {
+			case "=":
+				ok = n == operand
+			case "<":
+				ok = n < operand
+			case "<=":
+				ok = n <= operand
+			case ">":
+				ok = n > operand
+			case ">=":
+				ok = n >= operand
+			default:
+				ok = false
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,196 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventBridgeRouter(t *testing.T) {
+
+	// Fake events
+	ec2Evt := CloudWatchEvent{
+		ID:         "7bf73129-1428-4cd3-a780-95db273d1602",
+		DetailType: "EC2 Instance State-change Notification",
+		Source:     "aws.ec2",
+		Detail:     json.RawMessage(`{"instance-id":"i-abcd1111","state":"running","cpus":4,"tags":["web","prod"]}`),
+	}
+	scheduledEvt := CloudWatchEvent{
+		ID:         "cdc73f9d-aea9-11e3-9d5a-835b769c0d9c",
+		DetailType: "Scheduled Event",
+		Source:     "aws.events",
+		Resources:  []string{"arn:aws:events:us-east-1:123456789012:rule/nightly-report"},
+		Detail:     json.RawMessage(`{}`),
+	}
+
+	Convey("NewEventBridgeRouter()", t, func() {
+		Convey("Should handle any event with a fall through handler", func() {
+			handled := false
+			r := NewEventBridgeRouter(func(ctx context.Context, d *HandlerDependencies, evt *CloudWatchEvent) error {
+				handled = true
+				return nil
+			})
+			r.Tracer = NoTraceStrategy{}
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, ec2Evt)
+			So(handled, ShouldBeTrue)
+		})
+	})
+
+	Convey("Handle()", t, func() {
+		Convey("Should route events by source and detail-type", func() {
+			handled := false
+			fellThrough := false
+			r := NewEventBridgeRouter(func(ctx context.Context, d *HandlerDependencies, evt *CloudWatchEvent) error {
+				fellThrough = true
+				return nil
+			})
+			r.Tracer = NoTraceStrategy{}
+			r.Handle("aws.ec2", "EC2 Instance *", func(ctx context.Context, d *HandlerDependencies, evt *CloudWatchEvent) error {
+				handled = true
+				return nil
+			})
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, ec2Evt)
+			So(handled, ShouldBeTrue)
+			So(fellThrough, ShouldBeFalse)
+		})
+
+		Convey("Should call matching handlers in the order they were added and stop at an error", func() {
+			for i := 0; i < 10; i++ {
+				called := []string{}
+				r := NewEventBridgeRouter()
+				r.Tracer = &errorTraceStrategy{}
+				for _, source := range []string{"aws.*", "*", "aws.ec2", "aws.e*"} {
+					source := source
+					r.Handle(source, "", func(ctx context.Context, d *HandlerDependencies, evt *CloudWatchEvent) error {
+						called = append(called, source)
+						if source == "aws.ec2" {
+							return errors.New("failed")
+						}
+						return nil
+					})
+				}
+				err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, ec2Evt)
+				So(err, ShouldNotBeNil)
+				So(called, ShouldResemble, []string{"aws.*", "*", "aws.ec2"})
+			}
+		})
+	})
+
+	Convey("HandlePattern()", t, func() {
+		Convey("Should route events by a content pattern over the detail", func() {
+			handled := false
+			stopped := false
+			r := NewEventBridgeRouter()
+			r.Tracer = NoTraceStrategy{}
+			r.HandlePattern("aws.ec2", "", map[string]interface{}{"state": []string{"running"}}, func(ctx context.Context, d *HandlerDependencies, evt *CloudWatchEvent) error {
+				handled = true
+				return nil
+			})
+			r.HandlePattern("aws.ec2", "", map[string]interface{}{"state": []string{"stopped"}}, func(ctx context.Context, d *HandlerDependencies, evt *CloudWatchEvent) error {
+				stopped = true
+				return nil
+			})
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, ec2Evt)
+			So(handled, ShouldBeTrue)
+			So(stopped, ShouldBeFalse)
+		})
+	})
+
+	Convey("HandleScheduled()", t, func() {
+		Convey("Should route scheduled events by rule name", func() {
+			handled := false
+			r := NewEventBridgeRouter()
+			r.Tracer = NoTraceStrategy{}
+			r.HandleScheduled("nightly-*", func(ctx context.Context, d *HandlerDependencies, evt *CloudWatchEvent) error {
+				So(evt.IsScheduled(), ShouldBeTrue)
+				handled = true
+				return nil
+			})
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, ec2Evt)
+			So(handled, ShouldBeFalse)
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, scheduledEvt)
+			So(handled, ShouldBeTrue)
+		})
+	})
+
+	Convey("EventPatternMatch()", t, func() {
+		var detail map[string]interface{}
+		ec2Evt.UnmarshalDetail(&detail)
+		pattern := func(s string) map[string]interface{} {
+			var p map[string]interface{}
+			json.Unmarshal([]byte(s), &p)
+			return p
+		}
+
+		Convey("Should match exact values", func() {
+			So(EventPatternMatch(pattern(`{"state":["running","pending"]}`), detail), ShouldBeTrue)
+			So(EventPatternMatch(pattern(`{"state":["stopped"]}`), detail), ShouldBeFalse)
+			So(EventPatternMatch(pattern(`{"tags":["prod"]}`), detail), ShouldBeTrue)
+		})
+
+		Convey("Should match prefixes", func() {
+			So(EventPatternMatch(pattern(`{"instance-id":[{"prefix":"i-ab"}]}`), detail), ShouldBeTrue)
+			So(EventPatternMatch(pattern(`{"instance-id":[{"prefix":"i-zz"}]}`), detail), ShouldBeFalse)
+		})
+
+		Convey("Should match anything-but", func() {
+			So(EventPatternMatch(pattern(`{"state":[{"anything-but":"stopped"}]}`), detail), ShouldBeTrue)
+			So(EventPatternMatch(pattern(`{"state":[{"anything-but":["running","stopped"]}]}`), detail), ShouldBeFalse)
+			So(EventPatternMatch(pattern(`{"state":[{"anything-but":{"prefix":"run"}}]}`), detail), ShouldBeFalse)
+		})
+
+		Convey("Should match exists", func() {
+			So(EventPatternMatch(pattern(`{"state":[{"exists":true}]}`), detail), ShouldBeTrue)
+			So(EventPatternMatch(pattern(`{"missing":[{"exists":false}]}`), detail), ShouldBeTrue)
+			So(EventPatternMatch(pattern(`{"missing":[{"exists":true}]}`), detail), ShouldBeFalse)
+		})
+
+		Convey("Should match numeric ranges", func() {
+			So(EventPatternMatch(pattern(`{"cpus":[{"numeric":[">",2,"<=",4]}]}`), detail), ShouldBeTrue)
+			So(EventPatternMatch(pattern(`{"cpus":[{"numeric":["<",4]}]}`), detail), ShouldBeFalse)
+		})
+	})
+
+	Convey("Handlers should detect and decode EventBridge events", t, func() {
+		So(getType(map[string]interface{}{"detail-type": "Scheduled Event", "source": "aws.events"}), ShouldEqual, "CloudWatchEvent")
+
+		var state string
+		router := NewEventBridgeRouter(func(ctx context.Context, d *HandlerDependencies, evt *CloudWatchEvent) error {
+			var detail struct {
+				State string `json:"state"`
+			}
+			evt.UnmarshalDetail(&detail)
+			state = detail.State
+			return nil
+		})
+		router.Tracer = NoTraceStrategy{}
+		h := Handlers{EventBridgeRouter: router}
+		_, err := h.eventHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+			"version":     "0",
+			"id":          "7bf73129-1428-4cd3-a780-95db273d1602",
+			"detail-type": "EC2 Instance State-change Notification",
+			"source":      "aws.ec2",
+			"time":        "2015-11-11T21:29:54Z",
+			"detail":      map[string]interface{}{"state": "running"},
+		})
+		So(err, ShouldBeNil)
+		So(state, ShouldEqual, "running")
+	})
+}
@@ -0,0 +1,271 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// FirehoseRouter struct provides an interface to handle Kinesis Data Firehose data transformation events
+// (routers can be for a specific delivery stream or all delivery streams)
+// https://docs.aws.amazon.com/firehose/latest/dev/data-transformation.html
+type FirehoseRouter struct {
+	handlers       []FirehoseHandler
+	rootHandler    FirehoseHandler
+	DeliveryStream string
+	Tracer         TraceStrategy
+}
+
+// FirehoseHandler transforms routed records. Unlike other record based routers, only one handler transforms each record;
+// the first one registered that matches. DeliveryStream is a glob match against the delivery stream name. If Field is set,
+// the record data is decoded as JSON and the value at Field (dot notation for nested fields) is glob matched against Value.
+type FirehoseHandler struct {
+	Handler        func(context.Context, *HandlerDependencies, *KinesisFirehoseEventRecord) (KinesisFirehoseResponseRecord, error)
+	DeliveryStream string
+	Field          string
+	Value          string
+}
+
+func init() {
+	// Firehose data transformation events have a "deliveryStreamArn" and "records" (lowercase)
+	RegisterEventType(EventType{
+		Name:     "KinesisFirehoseEvent",
+		Priority: 2000,
+		Detect: func(evt map[string]interface{}) bool {
+			return keyInMap("deliveryStreamArn", evt) && keyInMap("records", evt)
+		},
+		// Record data is base64 encoded, which JSON decoding into []byte takes care of
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e KinesisFirehoseEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.FirehoseRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.FirehoseRouter.LambdaHandler(ctx, d, evt.(KinesisFirehoseEvent))
+		},
+	})
+}
+
+// LambdaHandler handles Firehose data transformation events. Every record is returned with its result; Ok, Dropped or
+// ProcessingFailed. If a handler returns an error (or a record without a result), the record's result is ProcessingFailed
+// with its original data.
+// Records without a matching handler (and no root handler) are returned unchanged.
+func (r *FirehoseRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt KinesisFirehoseEvent) (KinesisFirehoseResponse, error) {
+	res := KinesisFirehoseResponse{Records: make([]events.KinesisFirehoseResponseRecord, 0, len(evt.Records))}
+
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return res, errors.New("no handlers registered for FirehoseRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	deliveryStream := GetDeliveryStreamNameFromARN(evt.DeliveryStreamArn)
+	for i := range evt.Records {
+		record := KinesisFirehoseEventRecord(evt.Records[i])
+		transformed := record.Ok(record.Data)
+
+		// If the delivery stream doesn't match (if a delivery stream was defined for the router), the record is unchanged
+		if r.DeliveryStream == "" || r.DeliveryStream == deliveryStream {
+			var err error
+			transformed, err = r.handleRecord(ctx, d, &record, deliveryStream)
+			if err != nil {
+				d.Tracer.Record("annotation",
+					map[string]interface{}{
+						"FirehoseDeliveryStream": deliveryStream,
+						"FirehoseRecordID":       record.RecordID,
+						"Error":                  err.Error(),
+					},
+				)
+				transformed = record.ProcessingFailed()
+			}
+			// The record ID must always match the incoming record
+			transformed.RecordID = record.RecordID
+		}
+
+		res.Records = append(res.Records, events.KinesisFirehoseResponseRecord(transformed))
+	}
+
+	return res, nil
+}
+
+// handleRecord calls the first handler matching the record, or the fallthrough handler if none match
+func (r *FirehoseRouter) handleRecord(ctx context.Context, d *HandlerDependencies, record *KinesisFirehoseEventRecord, deliveryStream string) (KinesisFirehoseResponseRecord, error) {
+	handler := r.rootHandler
+	fallthroughHandler := true
+	for _, h := range r.handlers {
+		if firehoseHandlerMatch(h, deliveryStream, record) {
+			handler = h
+			fallthroughHandler = false
+			break
+		}
+	}
+	// The catch all is optional, without one the record is unchanged
+	if handler.Handler == nil {
+		return record.Ok(record.Data), nil
+	}
+
+	d.Tracer.Record("annotation",
+		map[string]interface{}{
+			"FirehoseDeliveryStream": deliveryStream,
+			"FirehoseRecordID":       record.RecordID,
+			"FallthroughHandler":     fallthroughHandler,
+		},
+	)
+	var transformed KinesisFirehoseResponseRecord
+	err := d.Tracer.Capture(ctx, "FirehoseHandler", func(ctx1 context.Context) error {
+		var err error
+		transformed, err = handler.Handler(ctx1, d, record)
+		return err
+	})
+	// Firehose rejects the whole batch if a record has no result, so it's treated like a handler error
+	if err == nil && transformed.Result == "" {
+		err = errors.New("firehose handler returned a record without a result")
+	}
+	return transformed, err
+}
+
+// firehoseHandlerMatch checks a handler's delivery stream and field globs against a record (empty matches all)
+func firehoseHandlerMatch(handler FirehoseHandler, deliveryStream string, record *KinesisFirehoseEventRecord) bool {
+	if !globMatch(handler.DeliveryStream, deliveryStream) {
+		return false
+	}
+	if handler.Field != "" {
+		v, ok := record.DataField(handler.Field)
+		if !ok || !globMatch(handler.Value, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Listen will start a Firehose event listener that handles incoming data transformation events
+func (r *FirehoseRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewFirehoseRouter simply returns a new FirehoseRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewFirehoseRouter(rootHandler ...func(context.Context, *HandlerDependencies, *KinesisFirehoseEventRecord) (KinesisFirehoseResponseRecord, error)) *FirehoseRouter {
+	r := &FirehoseRouter{}
+	if len(rootHandler) > 0 {
+		r.rootHandler = FirehoseHandler{
+			Handler: rootHandler[0],
+		}
+	}
+	return r
+}
+
+// NewFirehoseRouterForDeliveryStream is the same as NewFirehoseRouter except it's for a specific delivery stream (you could also set the DeliveryStream field after using the other function)
+func NewFirehoseRouterForDeliveryStream(deliveryStream string, rootHandler ...func(context.Context, *HandlerDependencies, *KinesisFirehoseEventRecord) (KinesisFirehoseResponseRecord, error)) *FirehoseRouter {
+	r := NewFirehoseRouter(rootHandler...)
+	// Just convenience
+	r.DeliveryStream = deliveryStream
+	return r
+}
+
+// Handle will register a handler for a given delivery stream name glob match. An empty string will match any delivery stream.
+func (r *FirehoseRouter) Handle(deliveryStream string, handler func(context.Context, *HandlerDependencies, *KinesisFirehoseEventRecord) (KinesisFirehoseResponseRecord, error)) {
+	r.handlers = append(r.handlers, FirehoseHandler{
+		Handler:        handler,
+		DeliveryStream: deliveryStream,
+	})
+}
+
+// HandleField will register a handler for a given delivery stream name and a JSON field value glob match.
+// The record data must be a JSON object, nested fields can be matched using dot notation (ie. "detail.type").
+func (r *FirehoseRouter) HandleField(deliveryStream string, field string, value string, handler func(context.Context, *HandlerDependencies, *KinesisFirehoseEventRecord) (KinesisFirehoseResponseRecord, error)) {
+	r.handlers = append(r.handlers, FirehoseHandler{
+		Handler:        handler,
+		DeliveryStream: deliveryStream,
+		Field:          field,
+		Value:          value,
+	})
+}
+
+// GetDeliveryStreamNameFromARN will get the delivery stream name given a delivery stream ARN string
+// ie. arn:aws:firehose:us-east-1:123456789012:deliverystream/example-stream
+func GetDeliveryStreamNameFromARN(arn string) string {
+	p := strings.Split(arn, "/")
+	if len(p) > 1 {
+		return p[1]
+	}
+	return ""
+}
+
+// UnmarshalData will decode the record's data as JSON into v
+func (r *KinesisFirehoseEventRecord) UnmarshalData(v interface{}) error {
+	return json.Unmarshal(r.Data, v)
+}
+
+// DataField returns the string value of a field in the record's JSON data (dot notation for nested fields)
+// and false if the data is not a JSON object or the field does not exist.
+func (r *KinesisFirehoseEventRecord) DataField(field string) (string, bool) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(r.Data, &m); err != nil {
+		return "", false
+	}
+	return lookupField(m, field)
+}
+
+// Ok returns a successfully transformed record with the given data
+func (r *KinesisFirehoseEventRecord) Ok(data []byte) KinesisFirehoseResponseRecord {
+	return KinesisFirehoseResponseRecord{
+		RecordID: r.RecordID,
+		Result:   events.KinesisFirehoseTransformedStateOk,
+		Data:     data,
+	}
+}
+
+// OkJSON returns a successfully transformed record with v marshaled as JSON for its data. Firehose doesn't add
+// delimiters between records, so a newline is appended (as most destinations, like S3 with Athena, expect).
+func (r *KinesisFirehoseEventRecord) OkJSON(v interface{}) (KinesisFirehoseResponseRecord, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return r.ProcessingFailed(), err
+	}
+	return r.Ok(append(b, '\n')), nil
+}
+
+// Dropped returns a record that was intentionally dropped, it won't be delivered
+func (r *KinesisFirehoseEventRecord) Dropped() KinesisFirehoseResponseRecord {
+	return KinesisFirehoseResponseRecord{
+		RecordID: r.RecordID,
+		Result:   events.KinesisFirehoseTransformedStateDropped,
+		Data:     r.Data,
+	}
+}
+
+// ProcessingFailed returns a record that could not be transformed, Firehose will deliver it to the processing failed
+// location (ie. the S3 bucket's "processing-failed" prefix) with its original data
+func (r *KinesisFirehoseEventRecord) ProcessingFailed() KinesisFirehoseResponseRecord {
+	return KinesisFirehoseResponseRecord{
+		RecordID: r.RecordID,
+		Result:   events.KinesisFirehoseTransformedStateProcessingFailed,
+		Data:     r.Data,
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	events "github.com/aws/aws-lambda-go/events"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFirehoseRouter(t *testing.T) {
+	deliveryStreamArn := "arn:aws:firehose:us-east-1:123456789012:deliverystream/clicks"
+
+	newEvent := func(data ...string) KinesisFirehoseEvent {
+		evt := KinesisFirehoseEvent{DeliveryStreamArn: deliveryStreamArn, InvocationID: "invocation"}
+		for i, d := range data {
+			evt.Records = append(evt.Records, events.KinesisFirehoseEventRecord{
+				RecordID: string(rune('a' + i)),
+				Data:     []byte(d),
+			})
+		}
+		return evt
+	}
+
+	router := NewFirehoseRouter()
+	router.Tracer = &errorTraceStrategy{}
+	router.HandleField("clicks", "type", "bot", func(ctx context.Context, d *HandlerDependencies, record *KinesisFirehoseEventRecord) (KinesisFirehoseResponseRecord, error) {
+		return record.Dropped(), nil
+	})
+	router.Handle("click*", func(ctx context.Context, d *HandlerDependencies, record *KinesisFirehoseEventRecord) (KinesisFirehoseResponseRecord, error) {
+		var click map[string]interface{}
+		if err := record.UnmarshalData(&click); err != nil {
+			return KinesisFirehoseResponseRecord{}, errors.New("invalid click")
+		}
+		click["processed"] = true
+		return record.OkJSON(click)
+	})
+
+	Convey("FirehoseRouter", t, func() {
+		Convey("Should transform, drop and fail records", func() {
+			res, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(`{"type":"user"}`, `{"type":"bot"}`, `not json`))
+			So(err, ShouldBeNil)
+			So(res.Records, ShouldHaveLength, 3)
+
+			So(res.Records[0].RecordID, ShouldEqual, "a")
+			So(res.Records[0].Result, ShouldEqual, events.KinesisFirehoseTransformedStateOk)
+			So(string(res.Records[0].Data), ShouldEqual, "{\"processed\":true,\"type\":\"user\"}\n")
+
+			So(res.Records[1].RecordID, ShouldEqual, "b")
+			So(res.Records[1].Result, ShouldEqual, events.KinesisFirehoseTransformedStateDropped)
+
+			So(res.Records[2].RecordID, ShouldEqual, "c")
+			So(res.Records[2].Result, ShouldEqual, events.KinesisFirehoseTransformedStateProcessingFailed)
+			So(string(res.Records[2].Data), ShouldEqual, "not json")
+		})
+
+		Convey("Should return records unchanged without a matching handler", func() {
+			r := NewFirehoseRouterForDeliveryStream("other")
+			r.Tracer = &errorTraceStrategy{}
+			r.Handle("", router.handlers[0].Handler)
+			res, err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(`{"type":"bot"}`))
+			So(err, ShouldBeNil)
+			So(res.Records[0].Result, ShouldEqual, events.KinesisFirehoseTransformedStateOk)
+			So(string(res.Records[0].Data), ShouldEqual, `{"type":"bot"}`)
+		})
+
+		Convey("Should fail records returned without a result", func() {
+			r := NewFirehoseRouter(func(ctx context.Context, d *HandlerDependencies, record *KinesisFirehoseEventRecord) (KinesisFirehoseResponseRecord, error) {
+				return KinesisFirehoseResponseRecord{Data: []byte("changed")}, nil
+			})
+			r.Tracer = &errorTraceStrategy{}
+			res, err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(`{"type":"user"}`))
+			So(err, ShouldBeNil)
+			So(res.Records[0].RecordID, ShouldEqual, "a")
+			So(res.Records[0].Result, ShouldEqual, events.KinesisFirehoseTransformedStateProcessingFailed)
+			So(string(res.Records[0].Data), ShouldEqual, `{"type":"user"}`)
+		})
+
+		Convey("Should get the delivery stream name from an ARN", func() {
+			So(GetDeliveryStreamNameFromARN(deliveryStreamArn), ShouldEqual, "clicks")
+		})
+	})
+
+	Convey("Handlers should detect and decode Firehose events", t, func() {
+		evt := map[string]interface{}{
+			"invocationId":      "invocation",
+			"deliveryStreamArn": deliveryStreamArn,
+			"region":            "us-east-1",
+			"records": []interface{}{
+				map[string]interface{}{
+					"recordId":                    "49546986683135544286507457936321625675700192471156785154",
+					"approximateArrivalTimestamp": 1495072949453,
+					"data":                        base64.StdEncoding.EncodeToString([]byte(`{"type":"user"}`)),
+				},
+			},
+		}
+		So(getType(evt), ShouldEqual, "KinesisFirehoseEvent")
+
+		h := Handlers{FirehoseRouter: router}
+		res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, evt)
+		So(err, ShouldBeNil)
+
+		// The response must be in the exact shape Firehose expects, with base64 encoded data
+		b, _ := json.Marshal(res)
+		So(string(b), ShouldEqual, `{"records":[{"recordId":"49546986683135544286507457936321625675700192471156785154","result":"Ok","data":"`+
+			base64.StdEncoding.EncodeToString([]byte("{\"processed\":true,\"type\":\"user\"}\n"))+`"}]}`)
+	})
+}
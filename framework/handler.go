@@ -18,23 +18,37 @@ import (
 	"context"
 	"errors"
 	"log"
-	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/mitchellh/mapstructure"
 	"github.com/sirupsen/logrus"
 )
 
 // Handlers defines a set of Aegis framework Lambda handlers
 type Handlers struct {
-	Router         *Router
-	Tasker         *Tasker
-	RPCRouter      *RPCRouter
-	S3ObjectRouter *S3ObjectRouter
-	SESRouter      *SESRouter
-	SQSRouter      *SQSRouter
-	CognitoRouter  *CognitoRouter
-	DefaultHandler DefaultHandler
+	Router                 *Router
+	Tasker                 *Tasker
+	RPCRouter              *RPCRouter
+	S3ObjectRouter         *S3ObjectRouter
+	SESRouter              *SESRouter
+	SQSRouter              *SQSRouter
+	CognitoRouter          *CognitoRouter
+	CognitoSyncRouter      *CognitoSyncRouter
+	DynamoDBStreamRouter   *DynamoDBStreamRouter
+	KinesisRouter          *KinesisRouter
+	SNSRouter              *SNSRouter
+	EventBridgeRouter      *EventBridgeRouter
+	WebSocketRouter        *WebSocketRouter
+	AuthorizerRouter       *AuthorizerRouter
+	CloudFrontRouter       *CloudFrontRouter
+	CustomResourceRouter   *CustomResourceRouter
+	AppSyncRouter          *AppSyncRouter
+	FirehoseRouter         *FirehoseRouter
+	LogsSubscriptionRouter *LogsSubscriptionRouter
+	S3BatchRouter          *S3BatchRouter
+	SecretRotationRouter   *SecretRotationRouter
+	KafkaRouter            *KafkaRouter
+	StepFunctionsRouter    *StepFunctionsRouter
+	DefaultHandler         DefaultHandler
 }
 
 // HandlerDependencies defines dependencies to be injected into each handler
@@ -48,55 +62,11 @@ type HandlerDependencies struct {
 // DefaultHandler is used when the message type can't be identified as anything else, completely optional to use
 type DefaultHandler func(context.Context, *HandlerDependencies, *map[string]interface{}) (interface{}, error)
 
-// getType will determine which type of event is being sent
+// getType will determine which type of event is being sent (the name of the first matching registered EventType)
 func getType(evt map[string]interface{}) string {
-	// if APIGatewayProxyRequest
-	if keyInMap("httpMethod", evt) && keyInMap("path", evt) {
-		return "APIGatewayProxyRequest"
+	if t, ok := detectEventType(nil, evt); ok {
+		return t.Name
 	}
-
-	// if S3Event or SimpleEmailEvent
-	if keyInMap("Records", evt) {
-		records := evt["Records"].([]interface{})
-		if len(records) > 0 {
-			// S3
-			if keyInMap("s3", records[0].(map[string]interface{})) {
-				return "S3Event"
-			}
-			// SES
-			if keyInMap("ses", records[0].(map[string]interface{})) {
-				return "SimpleEmailEvent"
-			}
-			// SQS
-			if keyInMap("eventSource", records[0].(map[string]interface{})) {
-				record := records[0].(map[string]interface{})
-				if record != nil && record["eventSource"].(string) == "aws:sqs" {
-					return "SQSEvent"
-				}
-			}
-		}
-	}
-
-	// The convention will be that tasks are named with a `_taskName` key.
-	// This is known as an "AegisTask" and gets handled by Tasker.
-	if keyInMap("_taskName", evt) {
-		return "AegisTask"
-	}
-
-	if keyInMap("_rpcName", evt) {
-		return "AegisRPC"
-	}
-
-	// if Cognito trigger
-	if keyInMap("userPoolId", evt) && keyInMap("triggerSource", evt) {
-		return "CognitoTrigger"
-	}
-
-	// if CognitoEvent
-	if keyInMap("identityPoolId", evt) && keyInMap("datasetRecords", evt) {
-		return "CognitoEvent"
-	}
-
 	return ""
 }
 
@@ -109,88 +79,51 @@ func keyInMap(k string, m map[string]interface{}) bool {
 }
 
 // eventHandler is a general handler that accepts an interface and determines which hanlder to use based on the event.
+// The event is matched against the registered event types (see RegisterEventType()), decoded and then dispatched.
 // See: https://godoc.org/github.com/aws/aws-lambda-go/lambda#Start
 func (h *Handlers) eventHandler(ctx context.Context, d *HandlerDependencies, evt map[string]interface{}) (interface{}, error) {
 	// log.Println("Determining type of event for:", evt)
 
-	var err error
-	// TODO: This isn't exactly reflection, it's a map.
-	// But we do need to look at the signature to make a determination.
-	evtType := getType(evt)
-	// log.Println("Incoming Lambda event type: ", evtType)
-	switch evtType {
-	case "APIGatewayProxyRequest":
-		var e APIGatewayProxyRequest
-		// The event contains no time/date, should decode just fine
-		err = mapstructure.Decode(evt, &e)
-		if err == nil {
-			return h.Router.LambdaHandler(ctx, d, e)
-		}
-		log.Println("Could not decode APIGatewayProxyRequest event", err)
-	case "AegisTask":
-		// Task handlers have no return
-		// Tasker takes a simple map[string]interface{} - not a struct (like some other events).
-		h.Tasker.LambdaHandler(ctx, d, evt)
-		return nil, nil
-	case "AegisRPC":
-		return h.RPCRouter.LambdaHandler(ctx, d, evt)
-	case "S3Event":
-		var e S3Event
-		decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-			// Event time format: 2018-04-02T17:09:32.273Z
-			// mapstructure does not handle string to time.Time automatically so we need to use a hook
-			DecodeHook: mapstructure.StringToTimeHookFunc(time.RFC3339Nano),
-			Result:     &e,
-		})
-		// decodeErr := mapstructure.Decode(evt, &e)
-		decodeErr := decoder.Decode(evt)
-		if decodeErr == nil {
-			err = h.S3ObjectRouter.LambdaHandler(ctx, d, e)
-		} else {
-			log.Println("Could not decode S3Event", decodeErr)
-		}
-	case "SimpleEmailEvent":
-		var e SimpleEmailEvent
-		decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-			// Event time format: 2018-04-02T17:09:32.273Z
-			// mapstructure does not handle string to time.Time automatically so we need to use a hook
-			DecodeHook: mapstructure.StringToTimeHookFunc(time.RFC3339Nano),
-			Result:     &e,
-		})
-		decodeErr := decoder.Decode(evt)
-		if decodeErr == nil {
-			err = h.SESRouter.LambdaHandler(ctx, d, e)
-		} else {
-			log.Println("Could not decode SimpleEmailEvent", decodeErr)
-		}
-	case "SQSEvent":
-		var e SQSEvent
-		err = mapstructure.Decode(evt, &e)
-		if err == nil {
-			return nil, h.SQSRouter.LambdaHandler(ctx, d, e)
-		}
-		log.Println("Could not decode SQSEvent", err)
-	case "CognitoTrigger":
-		// There's so many different formats here, routing for each is a bit silly.
-		// So send map[string]interface{}
-		// The handler itself can unmarshal using structs found in cognito_trigger_types.go
-		return h.CognitoRouter.LambdaHandler(ctx, d, evt)
-	default:
+	evtType, ok := detectEventType(h, evt)
+	// log.Println("Incoming Lambda event type: ", evtType.Name)
+	if !ok || evtType.Dispatch == nil {
 		log.Println("Could not determine Lambda event type, using DefaultHandler.")
-		// If a default handler is not set, return an error about it.
-		// It's essentially an unhandled Lambda invocation at this point.
-		if h.DefaultHandler == nil {
-			h.DefaultHandler = func(context.Context, *HandlerDependencies, *map[string]interface{}) (interface{}, error) {
-				return nil, errors.New("unhandled event")
-			}
+		return h.defaultHandler(ctx, d, evt)
+	}
+	// The event type is known, but there may be no router set for it
+	if evtType.Handled != nil && !evtType.Handled(h) {
+		log.Println("No handler set for " + evtType.Name + " events, using DefaultHandler.")
+		return h.defaultHandler(ctx, d, evt)
+	}
+
+	// Some event types (like AegisTask) take the map[string]interface{} as is, others decode into a struct
+	var e interface{} = evt
+	if evtType.Decode != nil {
+		decoded, err := evtType.Decode(evt)
+		if err != nil {
+			log.Println("Could not decode "+evtType.Name+" event", err)
+			return nil, err
 		}
-		return h.DefaultHandler(ctx, d, &evt)
+		e = decoded
 	}
 
+	res, err := evtType.Dispatch(ctx, h, d, e)
 	if err != nil {
 		log.Println(err)
 	}
-	return nil, err
+	return res, err
+}
+
+// defaultHandler calls DefaultHandler for events that can't be handled otherwise
+func (h *Handlers) defaultHandler(ctx context.Context, d *HandlerDependencies, evt map[string]interface{}) (interface{}, error) {
+	// If a default handler is not set, return an error about it.
+	// It's essentially an unhandled Lambda invocation at this point.
+	if h.DefaultHandler == nil {
+		h.DefaultHandler = func(context.Context, *HandlerDependencies, *map[string]interface{}) (interface{}, error) {
+			return nil, errors.New("unhandled event")
+		}
+	}
+	return h.DefaultHandler(ctx, d, &evt)
 }
 
 // lambdaHandler is a handler used directly with AWS Lambda. It must match this signature.
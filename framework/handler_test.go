@@ -15,6 +15,7 @@
 package framework
 
 import (
+	"context"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -56,4 +57,30 @@ func TestHandler(t *testing.T) {
 		evtType = getType(map[string]interface{}{"unknown": "event"})
 		So(evtType, ShouldEqual, "")
 	})
+
+	Convey("eventHandler() should use DefaultHandler when no router is set for the event type", t, func() {
+		handled := false
+		h := Handlers{
+			DefaultHandler: func(ctx context.Context, d *HandlerDependencies, evt *map[string]interface{}) (interface{}, error) {
+				handled = true
+				return nil, nil
+			},
+		}
+		_, err := h.eventHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{"Records": []interface{}{
+			map[string]interface{}{"eventSource": "aws:dynamodb"},
+		}})
+		So(err, ShouldBeNil)
+		So(handled, ShouldBeTrue)
+
+		handled = false
+		_, err = h.eventHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{"httpMethod": "GET", "path": "/"})
+		So(err, ShouldBeNil)
+		So(handled, ShouldBeTrue)
+	})
+
+	Convey("A nil router should return an error without a Tracer", t, func() {
+		var r *DynamoDBStreamRouter
+		So(func() { r.LambdaHandler(context.Background(), &HandlerDependencies{}, DynamoDBEvent{}) }, ShouldNotPanic)
+		So(r.LambdaHandler(context.Background(), &HandlerDependencies{}, DynamoDBEvent{}), ShouldNotBeNil)
+	})
 }
@@ -0,0 +1,237 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// The aws-lambda-go events package (at the version used) has no types for HTTP API (payload format version 2.0) events.
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/http-api-develop-integrations-lambda.html
+
+// APIGatewayV2HTTPRequest contains data coming from an API Gateway HTTP API (payload format version 2.0)
+type APIGatewayV2HTTPRequest struct {
+	Version               string                         `json:"version"`
+	RouteKey              string                         `json:"routeKey"`
+	RawPath               string                         `json:"rawPath"`
+	RawQueryString        string                         `json:"rawQueryString"`
+	Cookies               []string                       `json:"cookies,omitempty"`
+	Headers               map[string]string              `json:"headers"`
+	QueryStringParameters map[string]string              `json:"queryStringParameters,omitempty"`
+	PathParameters        map[string]string              `json:"pathParameters,omitempty"`
+	RequestContext        APIGatewayV2HTTPRequestContext `json:"requestContext"`
+	StageVariables        map[string]string              `json:"stageVariables,omitempty"`
+	Body                  string                         `json:"body,omitempty"`
+	IsBase64Encoded       bool                           `json:"isBase64Encoded"`
+}
+
+// APIGatewayV2HTTPRequestContext contains the information to identify the AWS account and resources invoking the Lambda function
+type APIGatewayV2HTTPRequestContext struct {
+	RouteKey     string                                    `json:"routeKey"`
+	AccountID    string                                    `json:"accountId"`
+	Stage        string                                    `json:"stage"`
+	RequestID    string                                    `json:"requestId"`
+	Authorizer   *APIGatewayV2HTTPRequestContextAuthorizer `json:"authorizer,omitempty"`
+	APIID        string                                    `json:"apiId"`
+	DomainName   string                                    `json:"domainName"`
+	DomainPrefix string                                    `json:"domainPrefix"`
+	Time         string                                    `json:"time"`
+	TimeEpoch    int64                                     `json:"timeEpoch"`
+	HTTP         APIGatewayV2HTTPRequestContextHTTP        `json:"http"`
+}
+
+// APIGatewayV2HTTPRequestContextAuthorizer contains authorizer details (JWT claims, Lambda authorizer context, or IAM)
+type APIGatewayV2HTTPRequestContextAuthorizer struct {
+	JWT    *APIGatewayV2HTTPRequestContextAuthorizerJWT `json:"jwt,omitempty"`
+	Lambda map[string]interface{}                       `json:"lambda,omitempty"`
+	IAM    map[string]interface{}                       `json:"iam,omitempty"`
+}
+
+// APIGatewayV2HTTPRequestContextAuthorizerJWT contains the claims and scopes from a JWT authorizer
+type APIGatewayV2HTTPRequestContextAuthorizerJWT struct {
+	Claims map[string]string `json:"claims"`
+	Scopes []string          `json:"scopes,omitempty"`
+}
+
+// APIGatewayV2HTTPRequestContextHTTP contains HTTP information for the request
+type APIGatewayV2HTTPRequestContextHTTP struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Protocol  string `json:"protocol"`
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+// APIGatewayV2HTTPResponse configures the response to be returned by an API Gateway HTTP API (payload format version 2.0).
+// Multiple header values are comma separated and cookies are returned separately.
+type APIGatewayV2HTTPResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded,omitempty"`
+	Cookies         []string          `json:"cookies,omitempty"`
+}
+
+func init() {
+	// HTTP APIs using payload format version 2.0 are also handled by Router
+	RegisterEventType(EventType{
+		Name:     "APIGatewayV2HTTPRequest",
+		Priority: 1300,
+		Detect: func(evt map[string]interface{}) bool {
+			if evt["version"] != "2.0" || !keyInMap("rawPath", evt) {
+				return false
+			}
+			requestContext, ok := evt["requestContext"].(map[string]interface{})
+			return ok && keyInMap("http", requestContext)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e APIGatewayV2HTTPRequest
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.Router != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.Router.HTTPAPILambdaHandler(ctx, d, evt.(APIGatewayV2HTTPRequest))
+		},
+	})
+}
+
+// HTTPAPILambdaHandler handles API Gateway HTTP API (payload format version 2.0) events. The request is converted to an
+// APIGatewayProxyRequest so the same routes, middleware and handlers work for both REST APIs and HTTP APIs.
+// The response is then converted back to the 2.0 format.
+func (r *Router) HTTPAPILambdaHandler(ctx context.Context, d *HandlerDependencies, req APIGatewayV2HTTPRequest) (APIGatewayV2HTTPResponse, error) {
+	if r == nil {
+		return APIGatewayV2HTTPResponse{}, errors.New("no handlers registered for Router")
+	}
+	res, err := r.LambdaHandler(ctx, d, req.ProxyRequest())
+	return NewAPIGatewayV2HTTPResponse(res), err
+}
+
+// ProxyRequest converts the HTTP API request into an APIGatewayProxyRequest (the REST API format)
+func (req *APIGatewayV2HTTPRequest) ProxyRequest() APIGatewayProxyRequest {
+	// Unlike REST APIs, the raw path includes the stage name unless it's the $default stage
+	path := req.RawPath
+	if stage := "/" + req.RequestContext.Stage; req.RequestContext.Stage != "" && req.RequestContext.Stage != "$default" {
+		if path == stage {
+			path = "/"
+		} else if strings.HasPrefix(path, stage+"/") {
+			path = strings.TrimPrefix(path, stage)
+		}
+	}
+
+	headers := make(map[string]string, len(req.Headers)+1)
+	multiValueHeaders := make(map[string][]string, len(req.Headers)+1)
+	for k, v := range req.Headers {
+		headers[k] = v
+		multiValueHeaders[k] = []string{v}
+	}
+	// Cookies are sent separately and need to go back into a header for Cookie() and standard middleware
+	if len(req.Cookies) > 0 {
+		headers["cookie"] = strings.Join(req.Cookies, "; ")
+		multiValueHeaders["cookie"] = []string{headers["cookie"]}
+	}
+
+	var multiValueQuery map[string][]string
+	if req.RawQueryString != "" {
+		if q, err := url.ParseQuery(req.RawQueryString); err == nil {
+			multiValueQuery = q
+		}
+	}
+
+	var authorizer map[string]interface{}
+	if a := req.RequestContext.Authorizer; a != nil {
+		authorizer = map[string]interface{}{}
+		if a.JWT != nil {
+			claims := make(map[string]interface{}, len(a.JWT.Claims))
+			for k, v := range a.JWT.Claims {
+				claims[k] = v
+			}
+			authorizer["claims"] = claims
+			authorizer["scopes"] = a.JWT.Scopes
+		}
+		for k, v := range a.Lambda {
+			authorizer[k] = v
+		}
+		if a.IAM != nil {
+			authorizer["iam"] = a.IAM
+		}
+	}
+
+	return APIGatewayProxyRequest{
+		Resource:                        req.RouteKey,
+		Path:                            path,
+		HTTPMethod:                      req.RequestContext.HTTP.Method,
+		Headers:                         headers,
+		MultiValueHeaders:               multiValueHeaders,
+		QueryStringParameters:           req.QueryStringParameters,
+		MultiValueQueryStringParameters: multiValueQuery,
+		PathParameters:                  req.PathParameters,
+		StageVariables:                  req.StageVariables,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			AccountID:    req.RequestContext.AccountID,
+			Stage:        req.RequestContext.Stage,
+			RequestID:    req.RequestContext.RequestID,
+			ResourcePath: req.RequestContext.RouteKey,
+			Authorizer:   authorizer,
+			HTTPMethod:   req.RequestContext.HTTP.Method,
+			APIID:        req.RequestContext.APIID,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  req.RequestContext.HTTP.SourceIP,
+				UserAgent: req.RequestContext.HTTP.UserAgent,
+			},
+		},
+		Body:            req.Body,
+		IsBase64Encoded: req.IsBase64Encoded,
+	}
+}
+
+// NewAPIGatewayV2HTTPResponse converts an APIGatewayProxyResponse into the HTTP API (payload format version 2.0) response format.
+// Set-Cookie headers become cookies and any other multi-value headers are comma separated.
+func NewAPIGatewayV2HTTPResponse(res APIGatewayProxyResponse) APIGatewayV2HTTPResponse {
+	v2 := APIGatewayV2HTTPResponse{
+		StatusCode:      res.StatusCode,
+		Headers:         map[string]string{},
+		Body:            res.Body,
+		IsBase64Encoded: res.IsBase64Encoded,
+	}
+
+	// Multi-value headers take precedence, the same as API Gateway does for REST APIs
+	for k, v := range res.Headers {
+		if _, ok := res.MultiValueHeaders[k]; ok {
+			continue
+		}
+		if strings.EqualFold(k, "Set-Cookie") {
+			v2.Cookies = append(v2.Cookies, v)
+			continue
+		}
+		v2.Headers[k] = v
+	}
+	for k, v := range res.MultiValueHeaders {
+		if strings.EqualFold(k, "Set-Cookie") {
+			v2.Cookies = append(v2.Cookies, v...)
+			continue
+		}
+		v2.Headers[k] = strings.Join(v, ",")
+	}
+
+	return v2
+}
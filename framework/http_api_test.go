@@ -0,0 +1,141 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHTTPAPI(t *testing.T) {
+	testFallThroughHandler := func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) error {
+		res.String(404, "not found")
+		return nil
+	}
+	testRouter := NewRouter(testFallThroughHandler)
+	testRouter.Tracer = NoTraceStrategy{}
+	testRouter.GET("/users/:id", func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) error {
+		c, err := req.Cookie("session")
+		if err != nil {
+			return err
+		}
+		res.SetHeader("Set-Cookie", "seen=1")
+		res.JSON(200, map[string]interface{}{
+			"id":      params.Get("id"),
+			"session": c.Value,
+			"tags":    req.MultiValueQueryStringParameters["tag"],
+		})
+		return nil
+	})
+
+	// Fake event
+	req := APIGatewayV2HTTPRequest{
+		Version:        "2.0",
+		RouteKey:       "$default",
+		RawPath:        "/prod/users/123",
+		RawQueryString: "tag=a&tag=b",
+		Cookies:        []string{"session=abc", "theme=dark"},
+		Headers:        map[string]string{"accept": "application/json"},
+		QueryStringParameters: map[string]string{
+			"tag": "a,b",
+		},
+		RequestContext: APIGatewayV2HTTPRequestContext{
+			Stage: "prod",
+			HTTP: APIGatewayV2HTTPRequestContextHTTP{
+				Method:    "GET",
+				Path:      "/prod/users/123",
+				SourceIP:  "192.0.2.1",
+				UserAgent: "agent",
+			},
+		},
+	}
+
+	Convey("ProxyRequest()", t, func() {
+		Convey("Should convert an HTTP API request into an APIGatewayProxyRequest", func() {
+			proxyReq := req.ProxyRequest()
+			So(proxyReq.HTTPMethod, ShouldEqual, "GET")
+			So(proxyReq.Path, ShouldEqual, "/users/123")
+			So(proxyReq.Headers["cookie"], ShouldEqual, "session=abc; theme=dark")
+			So(proxyReq.MultiValueQueryStringParameters["tag"], ShouldResemble, []string{"a", "b"})
+			So(proxyReq.IP(), ShouldEqual, "192.0.2.1")
+		})
+
+		Convey("Should only remove the stage name when it's a full path segment", func() {
+			r := APIGatewayV2HTTPRequest{RawPath: "/products", RequestContext: APIGatewayV2HTTPRequestContext{Stage: "prod"}}
+			So(r.ProxyRequest().Path, ShouldEqual, "/products")
+			r.RawPath = "/prod"
+			So(r.ProxyRequest().Path, ShouldEqual, "/")
+		})
+	})
+
+	Convey("NewAPIGatewayV2HTTPResponse()", t, func() {
+		Convey("Should move Set-Cookie headers to cookies and join multi-value headers", func() {
+			res := NewAPIGatewayV2HTTPResponse(APIGatewayProxyResponse{
+				StatusCode: 200,
+				Headers:    map[string]string{"Content-Type": "text/plain"},
+				MultiValueHeaders: map[string][]string{
+					"Set-Cookie": {"a=1", "b=2"},
+					"Vary":       {"Accept", "Origin"},
+				},
+				Body: "ok",
+			})
+			So(res.StatusCode, ShouldEqual, 200)
+			So(res.Cookies, ShouldResemble, []string{"a=1", "b=2"})
+			So(res.Headers["Vary"], ShouldEqual, "Accept,Origin")
+			So(res.Headers["Content-Type"], ShouldEqual, "text/plain")
+			So(res.Headers, ShouldNotContainKey, "Set-Cookie")
+		})
+	})
+
+	Convey("HTTPAPILambdaHandler()", t, func() {
+		Convey("Should route HTTP API requests to the same handlers", func() {
+			res, err := testRouter.HTTPAPILambdaHandler(context.Background(), &HandlerDependencies{}, req)
+			So(err, ShouldBeNil)
+			So(res.StatusCode, ShouldEqual, 200)
+			So(res.Body, ShouldEqual, `{"id":"123","session":"abc","tags":["a","b"]}`)
+			So(res.Cookies, ShouldResemble, []string{"seen=1"})
+		})
+	})
+
+	Convey("Handlers should detect and decode HTTP API events", t, func() {
+		evt := map[string]interface{}{
+			"version":        "2.0",
+			"routeKey":       "GET /users/{id}",
+			"rawPath":        "/users/456",
+			"rawQueryString": "",
+			"headers":        map[string]interface{}{"accept": "application/json"},
+			"requestContext": map[string]interface{}{
+				"stage":     "$default",
+				"timeEpoch": 1583348638390,
+				"http": map[string]interface{}{
+					"method": "GET",
+					"path":   "/users/456",
+				},
+			},
+			"cookies":         []interface{}{"session=xyz"},
+			"isBase64Encoded": false,
+		}
+		So(getType(evt), ShouldEqual, "APIGatewayV2HTTPRequest")
+
+		h := Handlers{Router: testRouter}
+		res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, evt)
+		So(err, ShouldBeNil)
+		So(res, ShouldHaveSameTypeAs, APIGatewayV2HTTPResponse{})
+		So(res.(APIGatewayV2HTTPResponse).Body, ShouldEqual, `{"id":"456","session":"xyz","tags":null}`)
+	})
+}
@@ -0,0 +1,342 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	// KafkaEventSourceMSK is the event source of Amazon MSK events
+	KafkaEventSourceMSK = "aws:kafka"
+	// KafkaEventSourceSelfManaged is the event source of self-managed Apache Kafka events
+	KafkaEventSourceSelfManaged = "SelfManagedKafka"
+)
+
+// The AWS Lambda events package (at the version used) has no Kafka event types, so they are defined here.
+// https://docs.aws.amazon.com/lambda/latest/dg/with-msk.html
+
+// KafkaEvent is an Amazon MSK or self-managed Apache Kafka event. Records are keyed by "topic-partition".
+type KafkaEvent struct {
+	EventSource      string                   `json:"eventSource"`
+	EventSourceArn   string                   `json:"eventSourceArn,omitempty"`
+	BootstrapServers string                   `json:"bootstrapServers"`
+	Records          map[string][]KafkaRecord `json:"records"`
+}
+
+// KafkaRecord is a Kafka message. The key and value are base64 encoded in the event, which JSON decoding into []byte takes care of.
+type KafkaRecord struct {
+	Topic         string                        `json:"topic"`
+	Partition     int64                         `json:"partition"`
+	Offset        int64                         `json:"offset"`
+	Timestamp     int64                         `json:"timestamp"`
+	TimestampType string                        `json:"timestampType"`
+	Key           []byte                        `json:"key,omitempty"`
+	Value         []byte                        `json:"value,omitempty"`
+	Headers       []map[string]KafkaHeaderValue `json:"headers,omitempty"`
+}
+
+// KafkaHeaderValue is the value of a Kafka record header. Lambda sends header values as arrays of (Java, so possibly
+// negative) byte values rather than base64 strings.
+type KafkaHeaderValue []byte
+
+// UnmarshalJSON decodes an array of signed or unsigned byte values
+func (v *KafkaHeaderValue) UnmarshalJSON(b []byte) error {
+	var ints []int
+	if err := json.Unmarshal(b, &ints); err != nil {
+		return err
+	}
+	*v = make(KafkaHeaderValue, len(ints))
+	for i, n := range ints {
+		if n < -128 || n > 255 {
+			return fmt.Errorf("kafka header byte value out of range: %d", n)
+		}
+		(*v)[i] = byte(n)
+	}
+	return nil
+}
+
+// KafkaRouter struct provides an interface to handle Amazon MSK and self-managed Apache Kafka events (routers can be for a specific topic or all topics)
+// https://docs.aws.amazon.com/lambda/latest/dg/with-msk.html
+// https://docs.aws.amazon.com/lambda/latest/dg/with-kafka.html
+type KafkaRouter struct {
+	handlers map[string]KafkaHandler
+	// handlerKeys are the keys of handlers in the order they were registered, which is the order they're tried in
+	handlerKeys []string
+	Topic       string
+	Tracer      TraceStrategy
+}
+
+// KafkaHandler handles routed records. Like the KinesisRouter, the handler function receives each matching record
+// (not the entire event). Topic is a glob match. If Header is set, the value of that record header is glob matched against Value.
+type KafkaHandler struct {
+	Handler func(context.Context, *HandlerDependencies, *KafkaRecord) error
+	Topic   string
+	Header  string
+	Value   string
+}
+
+func init() {
+	// Kafka events have an "eventSource" of "aws:kafka" (MSK) or "SelfManagedKafka" and "records" keyed by topic partition
+	RegisterEventType(EventType{
+		Name:     "KafkaEvent",
+		Priority: 2400,
+		Detect: func(evt map[string]interface{}) bool {
+			source, _ := evt["eventSource"].(string)
+			return (source == KafkaEventSourceMSK || source == KafkaEventSourceSelfManaged) && keyInMap("records", evt)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e KafkaEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.KafkaRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.KafkaRouter.LambdaHandler(ctx, d, evt.(KafkaEvent))
+		},
+	})
+}
+
+// LambdaHandler handles Kafka events. Records are handled in order, partition by partition. If a handler returns an
+// error, the rest of that partition's records are skipped and the record is reported as a batch item failure (its ID,
+// see KafkaRecord.ID()). Records from other partitions are still handled.
+func (r *KafkaRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt KafkaEvent) (BatchItemFailuresResponse, error) {
+	res := BatchItemFailuresResponse{BatchItemFailures: []BatchItemFailure{}}
+
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return res, errors.New("no handlers registered for KafkaRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	failedPartitions := map[string]bool{}
+	for _, record := range evt.OrderedRecords() {
+		record := record
+		partition := record.TopicPartition()
+
+		// If there are no handlers registered, the topic doesn't match (if a topic was defined for the router)
+		// or an earlier record from the same partition failed
+		if r.handlers == nil || (r.Topic != "" && r.Topic != record.Topic) || failedPartitions[partition] {
+			continue
+		}
+
+		if err := r.handleRecord(ctx, d, &record); err != nil {
+			d.Tracer.Record("annotation",
+				map[string]interface{}{
+					"KafkaTopic":     record.Topic,
+					"KafkaPartition": record.Partition,
+					"KafkaOffset":    record.Offset,
+					"Error":          err.Error(),
+				},
+			)
+			failedPartitions[partition] = true
+			res.BatchItemFailures = append(res.BatchItemFailures, BatchItemFailure{ItemIdentifier: record.ID()})
+		}
+	}
+
+	return res, nil
+}
+
+// handleRecord calls each handler matching the record, or the fallthrough handler if none match
+func (r *KafkaRouter) handleRecord(ctx context.Context, d *HandlerDependencies, record *KafkaRecord) error {
+	annotations := map[string]interface{}{
+		"KafkaTopic":     record.Topic,
+		"KafkaPartition": record.Partition,
+		"KafkaOffset":    record.Offset,
+	}
+
+	handled := false
+	for _, k := range r.handlerKeys {
+		handler := r.handlers[k]
+		if k == "_" || !kafkaHandlerMatch(handler, record) {
+			continue
+		}
+		handled = true
+		d.Tracer.Record("annotation", annotations)
+		err := d.Tracer.Capture(ctx, "KafkaHandler", func(ctx1 context.Context) error {
+			return handler.Handler(ctx1, d, record)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Otherwise, use the catch all (router "fallthrough" equivalent) handler.
+	// The application can inspect the record and make a decision on what to do, if anything.
+	// This is optional.
+	if !handled {
+		// It's possible that the KafkaRouter wasn't created with NewKafkaRouter, so check for this still.
+		if handler, ok := r.handlers["_"]; ok {
+			annotations["FallthroughHandler"] = true
+			d.Tracer.Record("annotation", annotations)
+			return d.Tracer.Capture(ctx, "KafkaHandler", func(ctx1 context.Context) error {
+				return handler.Handler(ctx1, d, record)
+			})
+		}
+	}
+	return nil
+}
+
+// kafkaHandlerMatch checks a handler's topic and header globs against a record (empty matches all)
+func kafkaHandlerMatch(handler KafkaHandler, record *KafkaRecord) bool {
+	if !globMatch(handler.Topic, record.Topic) {
+		return false
+	}
+	if handler.Header != "" {
+		v, ok := record.Header(handler.Header)
+		if !ok || !globMatch(handler.Value, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Listen will start a Kafka event listener that handles incoming records
+func (r *KafkaRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewKafkaRouter simply returns a new KafkaRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewKafkaRouter(rootHandler ...func(context.Context, *HandlerDependencies, *KafkaRecord) error) *KafkaRouter {
+	// The catch all is optional, if not provided, an empty handler is still called and it returns nothing.
+	handler := KafkaHandler{
+		Handler: func(context.Context, *HandlerDependencies, *KafkaRecord) error {
+			return nil
+		},
+	}
+	if len(rootHandler) > 0 {
+		handler = KafkaHandler{
+			Handler: rootHandler[0],
+		}
+	}
+	return &KafkaRouter{
+		handlers: map[string]KafkaHandler{
+			"_": handler,
+		},
+	}
+}
+
+// NewKafkaRouterForTopic is the same as NewKafkaRouter except it's for a specific topic (you could also set the Topic field after using the other function)
+func NewKafkaRouterForTopic(topic string, rootHandler ...func(context.Context, *HandlerDependencies, *KafkaRecord) error) *KafkaRouter {
+	r := NewKafkaRouter(rootHandler...)
+	// Just convenience
+	r.Topic = topic
+	return r
+}
+
+// Handle will register a handler for a given topic glob match. An empty string will match any topic.
+func (r *KafkaRouter) Handle(topic string, handler func(context.Context, *HandlerDependencies, *KafkaRecord) error) {
+	r.addHandler(KafkaHandler{
+		Handler: handler,
+		Topic:   topic,
+	})
+}
+
+// HandleHeader will register a handler for a given topic and a record header value glob match.
+func (r *KafkaRouter) HandleHeader(topic string, header string, value string, handler func(context.Context, *HandlerDependencies, *KafkaRecord) error) {
+	r.addHandler(KafkaHandler{
+		Handler: handler,
+		Topic:   topic,
+		Header:  header,
+		Value:   value,
+	})
+}
+
+// addHandler registers a KafkaHandler keyed by its matching rules
+func (r *KafkaRouter) addHandler(h KafkaHandler) {
+	if r.handlers == nil {
+		r.handlers = make(map[string]KafkaHandler)
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(h.Topic)
+	buffer.WriteString(":")
+	buffer.WriteString(h.Header)
+	buffer.WriteString(":")
+	buffer.WriteString(h.Value)
+	k := buffer.String()
+	buffer.Reset()
+	if _, ok := r.handlers[k]; !ok {
+		r.handlerKeys = append(r.handlerKeys, k)
+	}
+	r.handlers[k] = h
+}
+
+// OrderedRecords returns the event's records as a single slice, ordered by topic, partition and then offset
+func (evt *KafkaEvent) OrderedRecords() []KafkaRecord {
+	records := []KafkaRecord{}
+	for _, partitionRecords := range evt.Records {
+		records = append(records, partitionRecords...)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Topic != records[j].Topic {
+			return records[i].Topic < records[j].Topic
+		}
+		if records[i].Partition != records[j].Partition {
+			return records[i].Partition < records[j].Partition
+		}
+		return records[i].Offset < records[j].Offset
+	})
+	return records
+}
+
+// TopicPartition returns the "topic-partition" the record came from (how records are keyed in the event)
+func (r *KafkaRecord) TopicPartition() string {
+	return r.Topic + "-" + strconv.FormatInt(r.Partition, 10)
+}
+
+// ID returns an identifier for the record, "topic-partition:offset", used to report batch item failures
+func (r *KafkaRecord) ID() string {
+	return r.TopicPartition() + ":" + strconv.FormatInt(r.Offset, 10)
+}
+
+// Header returns the (first) value of a record header as a string and false if the header does not exist
+func (r *KafkaRecord) Header(key string) (string, bool) {
+	for _, h := range r.Headers {
+		if v, ok := h[key]; ok {
+			return string(v), true
+		}
+	}
+	return "", false
+}
+
+// UnmarshalValue will decode the record's value as JSON into v
+func (r *KafkaRecord) UnmarshalValue(v interface{}) error {
+	return json.Unmarshal(r.Value, v)
+}
+
+// ValueField returns the string value of a field in the record's JSON value (dot notation for nested fields)
+// and false if the value is not a JSON object or the field does not exist.
+func (r *KafkaRecord) ValueField(field string) (string, bool) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(r.Value, &m); err != nil {
+		return "", false
+	}
+	return lookupField(m, field)
+}
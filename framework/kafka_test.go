@@ -0,0 +1,139 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKafkaRouter(t *testing.T) {
+	newRecord := func(topic string, partition int64, offset int64, value string, headers ...map[string]KafkaHeaderValue) KafkaRecord {
+		return KafkaRecord{Topic: topic, Partition: partition, Offset: offset, Value: []byte(value), Headers: headers}
+	}
+	evt := KafkaEvent{
+		EventSource: KafkaEventSourceMSK,
+		Records: map[string][]KafkaRecord{
+			"orders-1": {
+				newRecord("orders", 1, 7, `{"id":"c"}`),
+				newRecord("orders", 1, 8, `{"id":"fail"}`),
+				newRecord("orders", 1, 9, `{"id":"skipped"}`),
+			},
+			"orders-0": {
+				newRecord("orders", 0, 3, `{"id":"a"}`, map[string]KafkaHeaderValue{"type": KafkaHeaderValue("refund")}),
+				newRecord("orders", 0, 4, `{"id":"b"}`),
+			},
+			"clicks-0": {
+				newRecord("clicks", 0, 1, `{}`),
+			},
+		},
+	}
+
+	var handled []string
+	var fallthroughs []string
+	router := NewKafkaRouter(func(ctx context.Context, d *HandlerDependencies, record *KafkaRecord) error {
+		fallthroughs = append(fallthroughs, record.ID())
+		return nil
+	})
+	router.Tracer = &errorTraceStrategy{}
+	router.Handle("order*", func(ctx context.Context, d *HandlerDependencies, record *KafkaRecord) error {
+		id, _ := record.ValueField("id")
+		if id == "fail" {
+			return errors.New("failed")
+		}
+		handled = append(handled, id)
+		return nil
+	})
+	router.HandleHeader("orders", "type", "ref*", func(ctx context.Context, d *HandlerDependencies, record *KafkaRecord) error {
+		handled = append(handled, "refund")
+		return nil
+	})
+
+	Convey("KafkaRouter", t, func() {
+		handled = []string{}
+		fallthroughs = []string{}
+
+		Convey("Should flatten records in order", func() {
+			var ids []string
+			for _, record := range evt.OrderedRecords() {
+				ids = append(ids, record.ID())
+			}
+			So(ids, ShouldResemble, []string{"clicks-0:1", "orders-0:3", "orders-0:4", "orders-1:7", "orders-1:8", "orders-1:9"})
+		})
+
+		Convey("Should route records and report the failed record of a partition", func() {
+			res, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(err, ShouldBeNil)
+			So(res.BatchItemFailures, ShouldResemble, []BatchItemFailure{{ItemIdentifier: "orders-1:8"}})
+			// Matching handlers are called in the order they were added
+			So(handled, ShouldResemble, []string{"a", "refund", "b", "c"})
+			So(fallthroughs, ShouldResemble, []string{"clicks-0:1"})
+		})
+
+		Convey("Should only handle records for the router's topic", func() {
+			r := NewKafkaRouterForTopic("clicks")
+			r.Tracer = &errorTraceStrategy{}
+			r.handlers = router.handlers
+			r.handlerKeys = router.handlerKeys
+			res, err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(err, ShouldBeNil)
+			So(res.BatchItemFailures, ShouldBeEmpty)
+			So(handled, ShouldBeEmpty)
+			So(fallthroughs, ShouldResemble, []string{"clicks-0:1"})
+		})
+	})
+
+	Convey("Handlers should detect and decode Kafka events", t, func() {
+		raw := `{
+			"eventSource": "SelfManagedKafka",
+			"bootstrapServers": "b-2.demo-cluster-1.a1bcde.c1.kafka.us-east-1.amazonaws.com:9092",
+			"records": {
+				"orders-0": [{
+					"topic": "orders",
+					"partition": 0,
+					"offset": 15,
+					"timestamp": 1545084650987,
+					"timestampType": "CREATE_TIME",
+					"key": "` + base64.StdEncoding.EncodeToString([]byte("order-1")) + `",
+					"value": "` + base64.StdEncoding.EncodeToString([]byte(`{"id":"fail"}`)) + `",
+					"headers": [{"type": [114, 101, 102, 117, 110, 100, -61, -87]}]
+				}]
+			}
+		}`
+		var m map[string]interface{}
+		So(json.Unmarshal([]byte(raw), &m), ShouldBeNil)
+		So(getType(m), ShouldEqual, "KafkaEvent")
+
+		var decoded KafkaEvent
+		So(DecodeEventJSON(m, &decoded), ShouldBeNil)
+		record := decoded.Records["orders-0"][0]
+		So(string(record.Key), ShouldEqual, "order-1")
+		header, ok := record.Header("type")
+		So(ok, ShouldBeTrue)
+		So(header, ShouldEqual, "refundé")
+
+		handled = []string{}
+		h := Handlers{KafkaRouter: router}
+		res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, m)
+		So(err, ShouldBeNil)
+		b, _ := json.Marshal(res)
+		So(string(b), ShouldEqual, `{"batchItemFailures":[{"itemIdentifier":"orders-0:15"}]}`)
+	})
+}
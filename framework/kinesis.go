@@ -0,0 +1,288 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// KinesisRouter struct provides an interface to handle Kinesis Data Streams events (routers can be for a specific stream or all streams)
+// https://docs.aws.amazon.com/lambda/latest/dg/with-kinesis.html
+type KinesisRouter struct {
+	handlers map[string]KinesisHandler
+	// handlerKeys are the keys of handlers in the order they were registered, which is the order they're tried in
+	handlerKeys []string
+	Stream      string
+	Tracer      TraceStrategy
+}
+
+// KinesisHandler handles routed records. Like the DynamoDBStreamRouter, the handler function receives each matching
+// record (not the entire event). Stream and PartitionKey are glob matches. If Field is set, the record data is decoded
+// as JSON and the value at Field (dot notation for nested fields) is glob matched against Value.
+type KinesisHandler struct {
+	Handler      func(context.Context, *HandlerDependencies, *KinesisEventRecord) error
+	Stream       string
+	PartitionKey string
+	Field        string
+	Value        string
+}
+
+// BatchItemFailure identifies a record that failed processing in a batch
+type BatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// BatchItemFailuresResponse is returned by handlers for event sources that support partial batch responses.
+// The event source mapping needs to have "ReportBatchItemFailures" enabled for Lambda to use it.
+// https://docs.aws.amazon.com/lambda/latest/dg/with-kinesis.html#services-kinesis-batchfailurereporting
+type BatchItemFailuresResponse struct {
+	BatchItemFailures []BatchItemFailure `json:"batchItemFailures"`
+}
+
+func init() {
+	// Kinesis Data Streams have "Records" with an eventSource of "aws:kinesis"
+	RegisterEventType(EventType{
+		Name:     "KinesisEvent",
+		Priority: 1000,
+		Detect: func(evt map[string]interface{}) bool {
+			record := firstRecord(evt)
+			return record != nil && record["eventSource"] == "aws:kinesis"
+		},
+		// Record data is base64 encoded, which JSON decoding into []byte takes care of
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e KinesisEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.KinesisRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.KinesisRouter.LambdaHandler(ctx, d, evt.(KinesisEvent))
+		},
+	})
+}
+
+// LambdaHandler handles Kinesis Data Streams events. Each batch comes from a single shard and records are handled in order.
+// If a handler returns an error, processing stops and the record's sequence number is reported as a batch item failure.
+// Lambda will then retry the batch starting from that record, instead of retrying the records that were handled successfully.
+func (r *KinesisRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt KinesisEvent) (BatchItemFailuresResponse, error) {
+	res := BatchItemFailuresResponse{BatchItemFailures: []BatchItemFailure{}}
+
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return res, errors.New("no handlers registered for KinesisRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	for i := range evt.Records {
+		record := KinesisEventRecord(evt.Records[i])
+		streamName := record.StreamName()
+
+		// If there are no handlers registered or the stream doesn't match (if a stream was defined for the router)
+		if r.handlers == nil || (r.Stream != "" && r.Stream != streamName) {
+			continue
+		}
+
+		if err := r.handleRecord(ctx, d, &record, streamName); err != nil {
+			d.Tracer.Record("annotation",
+				map[string]interface{}{
+					"KinesisStream":         streamName,
+					"KinesisSequenceNumber": record.Kinesis.SequenceNumber,
+					"Error":                 err.Error(),
+				},
+			)
+			res.BatchItemFailures = append(res.BatchItemFailures, BatchItemFailure{ItemIdentifier: record.Kinesis.SequenceNumber})
+			return res, nil
+		}
+	}
+
+	return res, nil
+}
+
+// handleRecord calls each handler matching the record, or the fallthrough handler if none match
+func (r *KinesisRouter) handleRecord(ctx context.Context, d *HandlerDependencies, record *KinesisEventRecord, streamName string) error {
+	annotations := map[string]interface{}{
+		"KinesisStream":         streamName,
+		"KinesisPartitionKey":   record.Kinesis.PartitionKey,
+		"KinesisSequenceNumber": record.Kinesis.SequenceNumber,
+	}
+
+	handled := false
+	for _, k := range r.handlerKeys {
+		handler := r.handlers[k]
+		if k == "_" || !kinesisHandlerMatch(handler, streamName, record) {
+			continue
+		}
+		handled = true
+		d.Tracer.Record("annotation", annotations)
+		err := d.Tracer.Capture(ctx, "KinesisHandler", func(ctx1 context.Context) error {
+			return handler.Handler(ctx1, d, record)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Otherwise, use the catch all (router "fallthrough" equivalent) handler.
+	// The application can inspect the record and make a decision on what to do, if anything.
+	// This is optional.
+	if !handled {
+		// It's possible that the KinesisRouter wasn't created with NewKinesisRouter, so check for this still.
+		if handler, ok := r.handlers["_"]; ok {
+			annotations["FallthroughHandler"] = true
+			d.Tracer.Record("annotation", annotations)
+			return d.Tracer.Capture(ctx, "KinesisHandler", func(ctx1 context.Context) error {
+				return handler.Handler(ctx1, d, record)
+			})
+		}
+	}
+	return nil
+}
+
+// kinesisHandlerMatch checks a handler's stream, partition key and field globs against a record (empty matches all)
+func kinesisHandlerMatch(handler KinesisHandler, streamName string, record *KinesisEventRecord) bool {
+	if !globMatch(handler.Stream, streamName) || !globMatch(handler.PartitionKey, record.Kinesis.PartitionKey) {
+		return false
+	}
+	if handler.Field != "" {
+		v, ok := record.DataField(handler.Field)
+		if !ok || !globMatch(handler.Value, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Listen will start a Kinesis event listener that handles incoming records
+func (r *KinesisRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewKinesisRouter simply returns a new KinesisRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewKinesisRouter(rootHandler ...func(context.Context, *HandlerDependencies, *KinesisEventRecord) error) *KinesisRouter {
+	// The catch all is optional, if not provided, an empty handler is still called and it returns nothing.
+	handler := KinesisHandler{
+		Handler: func(context.Context, *HandlerDependencies, *KinesisEventRecord) error {
+			return nil
+		},
+	}
+	if len(rootHandler) > 0 {
+		handler = KinesisHandler{
+			Handler: rootHandler[0],
+		}
+	}
+	return &KinesisRouter{
+		handlers: map[string]KinesisHandler{
+			"_": handler,
+		},
+	}
+}
+
+// NewKinesisRouterForStream is the same as NewKinesisRouter except it's for a specific stream (you could also set the Stream field after using the other function)
+func NewKinesisRouterForStream(stream string, rootHandler ...func(context.Context, *HandlerDependencies, *KinesisEventRecord) error) *KinesisRouter {
+	r := NewKinesisRouter(rootHandler...)
+	// Just convenience
+	r.Stream = stream
+	return r
+}
+
+// Handle will register a handler for a given stream name and partition key glob match.
+// An empty string for either will match any stream or partition key.
+func (r *KinesisRouter) Handle(stream string, partitionKey string, handler func(context.Context, *HandlerDependencies, *KinesisEventRecord) error) {
+	r.addHandler(KinesisHandler{
+		Handler:      handler,
+		Stream:       stream,
+		PartitionKey: partitionKey,
+	})
+}
+
+// HandleField will register a handler for a given stream name and a JSON field value glob match.
+// The record data must be a JSON object, nested fields can be matched using dot notation (ie. "detail.type").
+func (r *KinesisRouter) HandleField(stream string, field string, value string, handler func(context.Context, *HandlerDependencies, *KinesisEventRecord) error) {
+	r.addHandler(KinesisHandler{
+		Handler: handler,
+		Stream:  stream,
+		Field:   field,
+		Value:   value,
+	})
+}
+
+// addHandler registers a KinesisHandler keyed by its matching rules
+func (r *KinesisRouter) addHandler(h KinesisHandler) {
+	if r.handlers == nil {
+		r.handlers = make(map[string]KinesisHandler)
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(h.Stream)
+	buffer.WriteString(":")
+	buffer.WriteString(h.PartitionKey)
+	buffer.WriteString(":")
+	buffer.WriteString(h.Field)
+	buffer.WriteString(":")
+	buffer.WriteString(h.Value)
+	k := buffer.String()
+	buffer.Reset()
+	if _, ok := r.handlers[k]; !ok {
+		r.handlerKeys = append(r.handlerKeys, k)
+	}
+	r.handlers[k] = h
+}
+
+// GetStreamNameFromARN will get the Kinesis stream name given a stream ARN string
+// ie. arn:aws:kinesis:us-east-1:123456789012:stream/example-stream
+func GetStreamNameFromARN(arn string) string {
+	p := strings.Split(arn, "/")
+	if len(p) > 1 {
+		return p[1]
+	}
+	return ""
+}
+
+// StreamName returns the name of the stream the record came from
+func (r *KinesisEventRecord) StreamName() string {
+	return GetStreamNameFromARN(r.EventSourceArn)
+}
+
+// Data returns the record's data, which has already been base64 decoded
+func (r *KinesisEventRecord) Data() []byte {
+	return r.Kinesis.Data
+}
+
+// UnmarshalData will decode the record's data as JSON into v
+func (r *KinesisEventRecord) UnmarshalData(v interface{}) error {
+	return json.Unmarshal(r.Kinesis.Data, v)
+}
+
+// DataField returns the string value of a field in the record's JSON data (dot notation for nested fields)
+// and false if the data is not a JSON object or the field does not exist.
+func (r *KinesisEventRecord) DataField(field string) (string, bool) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(r.Kinesis.Data, &m); err != nil {
+		return "", false
+	}
+	return lookupField(m, field)
+}
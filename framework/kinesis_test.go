@@ -0,0 +1,206 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	events "github.com/aws/aws-lambda-go/events"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKinesisRouter(t *testing.T) {
+
+	// Fake event
+	newRecord := func(seq string, partitionKey string, data string) events.KinesisEventRecord {
+		return events.KinesisEventRecord{
+			EventID:        "shardId-000000000000:" + seq,
+			EventName:      "aws:kinesis:record",
+			EventSource:    "aws:kinesis",
+			EventSourceArn: "arn:aws:kinesis:us-east-1:123456789012:stream/example-stream",
+			Kinesis: events.KinesisRecord{
+				Data:           []byte(data),
+				PartitionKey:   partitionKey,
+				SequenceNumber: seq,
+			},
+		}
+	}
+	evt := KinesisEvent{
+		Records: []events.KinesisEventRecord{
+			newRecord("1", "user-1", `{"type":"signup","user":{"plan":"pro"}}`),
+			newRecord("2", "user-2", `{"type":"login","user":{"plan":"free"}}`),
+			newRecord("3", "order-1", `not json`),
+		},
+	}
+
+	Convey("NewKinesisRouterForStream()", t, func() {
+
+		Convey("Should create a new KinesisRouter for a specific stream", func() {
+			r := NewKinesisRouterForStream("example-stream")
+			So(r, ShouldNotBeNil)
+			So(r.Stream, ShouldEqual, "example-stream")
+		})
+
+		Convey("Should handle any record with a fall through handler", func() {
+			count := 0
+			r := NewKinesisRouterForStream("example-stream", func(ctx context.Context, d *HandlerDependencies, record *KinesisEventRecord) error {
+				count++
+				return nil
+			})
+			r.Tracer = NoTraceStrategy{}
+			res, err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+			So(res.BatchItemFailures, ShouldBeEmpty)
+		})
+
+		Convey("Should not handle records from other streams", func() {
+			count := 0
+			r := NewKinesisRouterForStream("other-stream", func(ctx context.Context, d *HandlerDependencies, record *KinesisEventRecord) error {
+				count++
+				return nil
+			})
+			r.Tracer = NoTraceStrategy{}
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(count, ShouldEqual, 0)
+		})
+	})
+
+	Convey("Handle()", t, func() {
+		Convey("Should route records by partition key", func() {
+			var keys []string
+			r := NewKinesisRouter()
+			r.Tracer = NoTraceStrategy{}
+			r.Handle("example-*", "user-*", func(ctx context.Context, d *HandlerDependencies, record *KinesisEventRecord) error {
+				keys = append(keys, record.Kinesis.PartitionKey)
+				return nil
+			})
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(keys, ShouldResemble, []string{"user-1", "user-2"})
+		})
+	})
+
+	Convey("HandleField()", t, func() {
+		Convey("Should route records by a JSON field value", func() {
+			var seqs []string
+			r := NewKinesisRouter()
+			r.Tracer = NoTraceStrategy{}
+			r.HandleField("", "user.plan", "pro", func(ctx context.Context, d *HandlerDependencies, record *KinesisEventRecord) error {
+				seqs = append(seqs, record.Kinesis.SequenceNumber)
+				return nil
+			})
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(seqs, ShouldResemble, []string{"1"})
+		})
+	})
+
+	Convey("LambdaHandler()", t, func() {
+		Convey("Should call matching handlers in the order they were added", func() {
+			for i := 0; i < 10; i++ {
+				called := []string{}
+				r := NewKinesisRouter()
+				r.Tracer = NoTraceStrategy{}
+				r.HandleField("", "type", "signup", func(ctx context.Context, d *HandlerDependencies, record *KinesisEventRecord) error {
+					called = append(called, "field")
+					return nil
+				})
+				r.Handle("", "user-1", func(ctx context.Context, d *HandlerDependencies, record *KinesisEventRecord) error {
+					called = append(called, "partition key")
+					return nil
+				})
+				r.Handle("example-stream", "", func(ctx context.Context, d *HandlerDependencies, record *KinesisEventRecord) error {
+					called = append(called, "stream")
+					return nil
+				})
+				r.LambdaHandler(context.Background(), &HandlerDependencies{}, KinesisEvent{Records: evt.Records[:1]})
+				So(called, ShouldResemble, []string{"field", "partition key", "stream"})
+			}
+		})
+
+		Convey("Should report the first failed record as a batch item failure and stop", func() {
+			var seqs []string
+			r := NewKinesisRouter(func(ctx context.Context, d *HandlerDependencies, record *KinesisEventRecord) error {
+				seqs = append(seqs, record.Kinesis.SequenceNumber)
+				if record.Kinesis.SequenceNumber == "2" {
+					return errors.New("failed")
+				}
+				return nil
+			})
+			r.Tracer = &errorTraceStrategy{}
+			res, err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(err, ShouldBeNil)
+			So(seqs, ShouldResemble, []string{"1", "2"})
+			So(res.BatchItemFailures, ShouldResemble, []BatchItemFailure{{ItemIdentifier: "2"}})
+		})
+	})
+
+	Convey("KinesisEventRecord", t, func() {
+		r := KinesisEventRecord(evt.Records[0])
+
+		Convey("StreamName() should return the stream name from the ARN", func() {
+			So(r.StreamName(), ShouldEqual, "example-stream")
+		})
+
+		Convey("UnmarshalData() should decode JSON data", func() {
+			var data struct {
+				Type string `json:"type"`
+			}
+			So(r.UnmarshalData(&data), ShouldBeNil)
+			So(data.Type, ShouldEqual, "signup")
+		})
+
+		Convey("DataField() should return field values", func() {
+			v, ok := r.DataField("user.plan")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, "pro")
+			_, ok = r.DataField("user.missing")
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Handlers should detect and decode Kinesis events", t, func() {
+		So(getType(map[string]interface{}{"Records": []interface{}{
+			map[string]interface{}{"eventSource": "aws:kinesis"},
+		}}), ShouldEqual, "KinesisEvent")
+
+		var data string
+		router := NewKinesisRouter(func(ctx context.Context, d *HandlerDependencies, record *KinesisEventRecord) error {
+			data = string(record.Data())
+			return nil
+		})
+		router.Tracer = NoTraceStrategy{}
+		h := Handlers{KinesisRouter: router}
+		res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+			"Records": []interface{}{
+				map[string]interface{}{
+					"eventSource":    "aws:kinesis",
+					"eventSourceARN": "arn:aws:kinesis:us-east-1:123456789012:stream/example-stream",
+					"kinesis": map[string]interface{}{
+						"partitionKey":   "user-1",
+						"sequenceNumber": "1",
+						// "Hello, this is a test."
+						"data":                        "SGVsbG8sIHRoaXMgaXMgYSB0ZXN0Lg==",
+						"approximateArrivalTimestamp": 1545084650.987,
+					},
+				},
+			},
+		})
+		So(err, ShouldBeNil)
+		So(data, ShouldEqual, "Hello, this is a test.")
+		So(res, ShouldHaveSameTypeAs, BatchItemFailuresResponse{})
+	})
+}
@@ -0,0 +1,335 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// LogsControlMessageType is the message type CloudWatch Logs uses to check that a subscription's destination is reachable
+const LogsControlMessageType = "CONTROL_MESSAGE"
+
+// LogsSubscriptionRouter struct provides an interface to handle CloudWatch Logs subscription filter events
+// (routers can be for a specific log group or all log groups)
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/logs/SubscriptionFilters.html#LambdaFunctionExample
+type LogsSubscriptionRouter struct {
+	handlers map[string]LogsSubscriptionHandler
+	// handlerKeys are the keys of handlers in the order they were registered, which is the order they're called in
+	handlerKeys []string
+	LogGroup    string
+	Tracer      TraceStrategy
+}
+
+// LogsSubscriptionHandler handles routed log events. LogGroup, LogStream and SubscriptionFilter (the name of the
+// subscription filter that sent the events) are glob matches. Log events are then filtered by Message, a glob match, and
+// FilterPattern, which uses the CloudWatch Logs term syntax (see LogFilterPatternMatch). Empty values match anything.
+// The handler is called once with all of the matching log events, if there are any.
+type LogsSubscriptionHandler struct {
+	Handler            func(context.Context, *HandlerDependencies, *CloudwatchLogsData, []events.CloudwatchLogsLogEvent) error
+	LogGroup           string
+	LogStream          string
+	SubscriptionFilter string
+	Message            string
+	FilterPattern      string
+}
+
+func init() {
+	// CloudWatch Logs subscription events have their (gzipped and base64 encoded) data under "awslogs"
+	RegisterEventType(EventType{
+		Name:     "CloudwatchLogsEvent",
+		Priority: 2100,
+		Detect: func(evt map[string]interface{}) bool {
+			awslogs, ok := evt["awslogs"].(map[string]interface{})
+			return ok && keyInMap("data", awslogs)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e CloudwatchLogsEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.LogsSubscriptionRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return nil, h.LogsSubscriptionRouter.LambdaHandler(ctx, d, evt.(CloudwatchLogsEvent))
+		},
+	})
+}
+
+// LambdaHandler handles CloudWatch Logs subscription events. The data is decoded and each matching handler is called
+// with the log events it matches. Control messages, sent when a subscription filter is created, are ignored.
+func (r *LogsSubscriptionRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt CloudwatchLogsEvent) error {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return errors.New("no handlers registered for LogsSubscriptionRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	parsed, err := evt.AWSLogs.Parse()
+	if err != nil {
+		return err
+	}
+	data := CloudwatchLogsData(parsed)
+
+	// If there are no handlers registered or the log group doesn't match (if a log group was defined for the router)
+	if r.handlers == nil || data.MessageType == LogsControlMessageType || (r.LogGroup != "" && r.LogGroup != data.LogGroup) {
+		return nil
+	}
+
+	handled := false
+	for _, k := range r.handlerKeys {
+		handler := r.handlers[k]
+		if k == "_" || !logsSubscriptionHandlerMatch(handler, &data) {
+			continue
+		}
+		logEvents := filterLogEvents(handler, data.LogEvents)
+		if len(logEvents) == 0 {
+			continue
+		}
+		handled = true
+		d.Tracer.Record("annotation",
+			map[string]interface{}{
+				"LogGroup":      data.LogGroup,
+				"LogStream":     data.LogStream,
+				"LogEventCount": len(logEvents),
+			},
+		)
+		err = d.Tracer.Capture(ctx, "LogsSubscriptionHandler", func(ctx1 context.Context) error {
+			return handler.Handler(ctx1, d, &data, logEvents)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Otherwise, use the catch all (router "fallthrough" equivalent) handler with all of the log events.
+	// The application can inspect the log events and make a decision on what to do, if anything.
+	// This is optional.
+	if !handled {
+		// It's possible that the LogsSubscriptionRouter wasn't created with NewLogsSubscriptionRouter, so check for this still.
+		if handler, ok := r.handlers["_"]; ok {
+			d.Tracer.Record("annotation",
+				map[string]interface{}{
+					"LogGroup":           data.LogGroup,
+					"LogStream":          data.LogStream,
+					"LogEventCount":      len(data.LogEvents),
+					"FallthroughHandler": true,
+				},
+			)
+			err = d.Tracer.Capture(ctx, "LogsSubscriptionHandler", func(ctx1 context.Context) error {
+				return handler.Handler(ctx1, d, &data, data.LogEvents)
+			})
+		}
+	}
+
+	return err
+}
+
+// logsSubscriptionHandlerMatch checks a handler's log group, log stream and subscription filter globs (empty matches all)
+func logsSubscriptionHandlerMatch(handler LogsSubscriptionHandler, data *CloudwatchLogsData) bool {
+	if !globMatch(handler.LogGroup, data.LogGroup) || !globMatch(handler.LogStream, data.LogStream) {
+		return false
+	}
+	if handler.SubscriptionFilter == "" {
+		return true
+	}
+	for _, f := range data.SubscriptionFilters {
+		if globMatch(handler.SubscriptionFilter, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterLogEvents returns the log events matching a handler's message glob and filter pattern
+func filterLogEvents(handler LogsSubscriptionHandler, logEvents []events.CloudwatchLogsLogEvent) []events.CloudwatchLogsLogEvent {
+	if handler.Message == "" && handler.FilterPattern == "" {
+		return logEvents
+	}
+	var matched []events.CloudwatchLogsLogEvent
+	for _, e := range logEvents {
+		if globMatch(handler.Message, e.Message) && LogFilterPatternMatch(handler.FilterPattern, e.Message) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// LogFilterPatternMatch returns true if the message matches a CloudWatch Logs filter pattern using the term syntax.
+// Terms are separated by spaces and all must be in the message (ie. `ERROR timeout`). Phrases with spaces or symbols
+// can be quoted (ie. `"connection refused"`). Terms prefixed with ? match if any of them are in the message
+// (ie. `?ERROR ?WARN`) and terms prefixed with - must not be in the message (ie. `ERROR -retrying`).
+// Matching is case sensitive and an empty pattern matches everything. JSON and space-delimited patterns aren't supported.
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/logs/FilterAndPatternSyntax.html
+func LogFilterPatternMatch(pattern string, message string) bool {
+	anyMatched := false
+	hasAny := false
+	for _, term := range splitLogFilterPattern(pattern) {
+		switch {
+		case strings.HasPrefix(term, "?"):
+			hasAny = true
+			if strings.Contains(message, unquoteLogFilterTerm(term[1:])) {
+				anyMatched = true
+			}
+		case strings.HasPrefix(term, "-") && len(term) > 1:
+			if strings.Contains(message, unquoteLogFilterTerm(term[1:])) {
+				return false
+			}
+		default:
+			if !strings.Contains(message, unquoteLogFilterTerm(term)) {
+				return false
+			}
+		}
+	}
+	return !hasAny || anyMatched
+}
+
+// splitLogFilterPattern splits a filter pattern into terms on spaces, keeping quoted phrases together
+func splitLogFilterPattern(pattern string) []string {
+	var terms []string
+	var buffer bytes.Buffer
+	quoted := false
+	for _, c := range pattern {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			buffer.WriteRune(c)
+		case c == ' ' && !quoted:
+			if buffer.Len() > 0 {
+				terms = append(terms, buffer.String())
+				buffer.Reset()
+			}
+		default:
+			buffer.WriteRune(c)
+		}
+	}
+	if buffer.Len() > 0 {
+		terms = append(terms, buffer.String())
+	}
+	return terms
+}
+
+// unquoteLogFilterTerm removes the quotes around a quoted term
+func unquoteLogFilterTerm(term string) string {
+	if len(term) > 1 && strings.HasPrefix(term, `"`) && strings.HasSuffix(term, `"`) {
+		return term[1 : len(term)-1]
+	}
+	return term
+}
+
+// Listen will start a CloudWatch Logs subscription event listener that handles incoming log events
+func (r *LogsSubscriptionRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewLogsSubscriptionRouter simply returns a new LogsSubscriptionRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewLogsSubscriptionRouter(rootHandler ...func(context.Context, *HandlerDependencies, *CloudwatchLogsData, []events.CloudwatchLogsLogEvent) error) *LogsSubscriptionRouter {
+	// The catch all is optional, if not provided, an empty handler is still called and it returns nothing.
+	handler := LogsSubscriptionHandler{
+		Handler: func(context.Context, *HandlerDependencies, *CloudwatchLogsData, []events.CloudwatchLogsLogEvent) error {
+			return nil
+		},
+	}
+	if len(rootHandler) > 0 {
+		handler = LogsSubscriptionHandler{
+			Handler: rootHandler[0],
+		}
+	}
+	return &LogsSubscriptionRouter{
+		handlers: map[string]LogsSubscriptionHandler{
+			"_": handler,
+		},
+	}
+}
+
+// NewLogsSubscriptionRouterForLogGroup is the same as NewLogsSubscriptionRouter except it's for a specific log group (you could also set the LogGroup field after using the other function)
+func NewLogsSubscriptionRouterForLogGroup(logGroup string, rootHandler ...func(context.Context, *HandlerDependencies, *CloudwatchLogsData, []events.CloudwatchLogsLogEvent) error) *LogsSubscriptionRouter {
+	r := NewLogsSubscriptionRouter(rootHandler...)
+	// Just convenience
+	r.LogGroup = logGroup
+	return r
+}
+
+// Handle will register a handler for a given log group and log stream glob match.
+// An empty string for either will match any log group or log stream.
+func (r *LogsSubscriptionRouter) Handle(logGroup string, logStream string, handler func(context.Context, *HandlerDependencies, *CloudwatchLogsData, []events.CloudwatchLogsLogEvent) error) {
+	r.addHandler(LogsSubscriptionHandler{
+		Handler:   handler,
+		LogGroup:  logGroup,
+		LogStream: logStream,
+	})
+}
+
+// HandleMessage will register a handler for a given log group glob match and log event message glob match (ie. "*ERROR*")
+func (r *LogsSubscriptionRouter) HandleMessage(logGroup string, message string, handler func(context.Context, *HandlerDependencies, *CloudwatchLogsData, []events.CloudwatchLogsLogEvent) error) {
+	r.addHandler(LogsSubscriptionHandler{
+		Handler:  handler,
+		LogGroup: logGroup,
+		Message:  message,
+	})
+}
+
+// HandleFilterPattern will register a handler for a given log group glob match and CloudWatch Logs filter pattern (ie. `ERROR -retrying`)
+func (r *LogsSubscriptionRouter) HandleFilterPattern(logGroup string, filterPattern string, handler func(context.Context, *HandlerDependencies, *CloudwatchLogsData, []events.CloudwatchLogsLogEvent) error) {
+	r.addHandler(LogsSubscriptionHandler{
+		Handler:       handler,
+		LogGroup:      logGroup,
+		FilterPattern: filterPattern,
+	})
+}
+
+// HandleSubscriptionFilter will register a handler for a given log group glob match and subscription filter name glob match.
+// This is useful when more than one subscription filter sends log events to the same Lambda.
+func (r *LogsSubscriptionRouter) HandleSubscriptionFilter(logGroup string, subscriptionFilter string, handler func(context.Context, *HandlerDependencies, *CloudwatchLogsData, []events.CloudwatchLogsLogEvent) error) {
+	r.addHandler(LogsSubscriptionHandler{
+		Handler:            handler,
+		LogGroup:           logGroup,
+		SubscriptionFilter: subscriptionFilter,
+	})
+}
+
+// addHandler registers a LogsSubscriptionHandler keyed by its matching rules
+func (r *LogsSubscriptionRouter) addHandler(h LogsSubscriptionHandler) {
+	if r.handlers == nil {
+		r.handlers = make(map[string]LogsSubscriptionHandler)
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(h.LogGroup)
+	buffer.WriteString(":")
+	buffer.WriteString(h.LogStream)
+	buffer.WriteString(":")
+	buffer.WriteString(h.SubscriptionFilter)
+	buffer.WriteString(":")
+	buffer.WriteString(h.Message)
+	buffer.WriteString(":")
+	buffer.WriteString(h.FilterPattern)
+	k := buffer.String()
+	buffer.Reset()
+	if _, ok := r.handlers[k]; !ok {
+		r.handlerKeys = append(r.handlerKeys, k)
+	}
+	r.handlers[k] = h
+}
@@ -0,0 +1,174 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	events "github.com/aws/aws-lambda-go/events"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogsSubscriptionRouter(t *testing.T) {
+
+	encode := func(data events.CloudwatchLogsData) string {
+		b, _ := json.Marshal(data)
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(b)
+		zw.Close()
+		return base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+	newEvent := func(logGroup string, messageType string, messages ...string) CloudwatchLogsEvent {
+		data := events.CloudwatchLogsData{
+			Owner:               "123456789012",
+			LogGroup:            logGroup,
+			LogStream:           "2019/01/01/[$LATEST]abc",
+			SubscriptionFilters: []string{"errors"},
+			MessageType:         messageType,
+		}
+		for _, m := range messages {
+			data.LogEvents = append(data.LogEvents, events.CloudwatchLogsLogEvent{ID: m, Timestamp: 1546300800000, Message: m})
+		}
+		return CloudwatchLogsEvent{AWSLogs: events.CloudwatchLogsRawData{Data: encode(data)}}
+	}
+
+	var patternMatched []string
+	var messageMatched []string
+	var fellThrough []string
+	router := NewLogsSubscriptionRouter(func(ctx context.Context, d *HandlerDependencies, data *CloudwatchLogsData, logEvents []events.CloudwatchLogsLogEvent) error {
+		for _, e := range logEvents {
+			fellThrough = append(fellThrough, e.Message)
+		}
+		return nil
+	})
+	router.Tracer = &errorTraceStrategy{}
+	router.HandleFilterPattern("/aws/lambda/*", `ERROR -retrying`, func(ctx context.Context, d *HandlerDependencies, data *CloudwatchLogsData, logEvents []events.CloudwatchLogsLogEvent) error {
+		for _, e := range logEvents {
+			patternMatched = append(patternMatched, e.Message)
+		}
+		return nil
+	})
+	router.HandleMessage("/aws/lambda/*", "*timed out*", func(ctx context.Context, d *HandlerDependencies, data *CloudwatchLogsData, logEvents []events.CloudwatchLogsLogEvent) error {
+		for _, e := range logEvents {
+			messageMatched = append(messageMatched, e.Message)
+		}
+		return nil
+	})
+
+	Convey("LogFilterPatternMatch()", t, func() {
+		So(LogFilterPatternMatch("", "anything"), ShouldBeTrue)
+		So(LogFilterPatternMatch("ERROR timeout", "ERROR: timeout after 3s"), ShouldBeTrue)
+		So(LogFilterPatternMatch("ERROR timeout", "ERROR: connection refused"), ShouldBeFalse)
+		So(LogFilterPatternMatch(`"connection refused"`, "ERROR: connection refused"), ShouldBeTrue)
+		So(LogFilterPatternMatch(`"connection refused"`, "connection was refused"), ShouldBeFalse)
+		So(LogFilterPatternMatch("?ERROR ?WARN", "WARN: slow"), ShouldBeTrue)
+		So(LogFilterPatternMatch("?ERROR ?WARN", "INFO: ok"), ShouldBeFalse)
+		So(LogFilterPatternMatch("ERROR -retrying", "ERROR: failed, retrying"), ShouldBeFalse)
+		So(LogFilterPatternMatch("ERROR", "error"), ShouldBeFalse)
+	})
+
+	Convey("LogsSubscriptionRouter", t, func() {
+		patternMatched, messageMatched, fellThrough = nil, nil, nil
+
+		Convey("Should decode the data and route log events", func() {
+			err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("/aws/lambda/my-function", "DATA_MESSAGE",
+				"ERROR: failed", "ERROR: failed, retrying", "Task timed out after 3.00 seconds", "INFO: ok"))
+			So(err, ShouldBeNil)
+			So(patternMatched, ShouldResemble, []string{"ERROR: failed"})
+			So(messageMatched, ShouldResemble, []string{"Task timed out after 3.00 seconds"})
+			So(fellThrough, ShouldBeNil)
+		})
+
+		Convey("Should use the fallthrough handler when nothing matches", func() {
+			err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("/ecs/my-service", "DATA_MESSAGE", "ERROR: failed"))
+			So(err, ShouldBeNil)
+			So(patternMatched, ShouldBeNil)
+			So(fellThrough, ShouldResemble, []string{"ERROR: failed"})
+		})
+
+		Convey("HandleSubscriptionFilter() should route by subscription filter name", func() {
+			var filtered []string
+			var other []string
+			r := NewLogsSubscriptionRouter()
+			r.Tracer = &errorTraceStrategy{}
+			r.HandleSubscriptionFilter("", "err*", func(ctx context.Context, d *HandlerDependencies, data *CloudwatchLogsData, logEvents []events.CloudwatchLogsLogEvent) error {
+				filtered = append(filtered, logEvents[0].Message)
+				return nil
+			})
+			r.HandleSubscriptionFilter("/aws/lambda/*", "audit", func(ctx context.Context, d *HandlerDependencies, data *CloudwatchLogsData, logEvents []events.CloudwatchLogsLogEvent) error {
+				other = append(other, logEvents[0].Message)
+				return nil
+			})
+			err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("/aws/lambda/my-function", "DATA_MESSAGE", "ERROR: failed"))
+			So(err, ShouldBeNil)
+			So(filtered, ShouldResemble, []string{"ERROR: failed"})
+			So(other, ShouldBeNil)
+		})
+
+		Convey("Should call matching handlers in the order they were added and stop at an error", func() {
+			for i := 0; i < 10; i++ {
+				called := []string{}
+				r := NewLogsSubscriptionRouter()
+				r.Tracer = &errorTraceStrategy{}
+				for _, logGroup := range []string{"/aws/*", "*", "/aws/lambda/my-function", "/aws/lambda/*"} {
+					logGroup := logGroup
+					r.Handle(logGroup, "", func(ctx context.Context, d *HandlerDependencies, data *CloudwatchLogsData, logEvents []events.CloudwatchLogsLogEvent) error {
+						called = append(called, logGroup)
+						if logGroup == "/aws/lambda/my-function" {
+							return errors.New("failed")
+						}
+						return nil
+					})
+				}
+				err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("/aws/lambda/my-function", "DATA_MESSAGE", "ERROR: failed"))
+				So(err, ShouldNotBeNil)
+				So(called, ShouldResemble, []string{"/aws/*", "*", "/aws/lambda/my-function"})
+			}
+		})
+
+		Convey("Should ignore control messages", func() {
+			err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("testLogGroup", LogsControlMessageType, "CWL CONTROL MESSAGE: Checking health of destination Lambda."))
+			So(err, ShouldBeNil)
+			So(fellThrough, ShouldBeNil)
+		})
+
+		Convey("Should return an error for invalid data", func() {
+			err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, CloudwatchLogsEvent{AWSLogs: events.CloudwatchLogsRawData{Data: "not gzip"}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Handlers should detect and decode CloudWatch Logs events", t, func() {
+		patternMatched = nil
+		evt := map[string]interface{}{
+			"awslogs": map[string]interface{}{
+				"data": newEvent("/aws/lambda/my-function", "DATA_MESSAGE", "ERROR: detected").AWSLogs.Data,
+			},
+		}
+		So(getType(evt), ShouldEqual, "CloudwatchLogsEvent")
+
+		h := Handlers{LogsSubscriptionRouter: router}
+		_, err := h.eventHandler(context.Background(), &HandlerDependencies{}, evt)
+		So(err, ShouldBeNil)
+		So(patternMatched, ShouldResemble, []string{"ERROR: detected"})
+	})
+}
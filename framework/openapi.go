@@ -0,0 +1,328 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// OpenAPIVersion is the version of the OpenAPI specification documents are generated for
+	OpenAPIVersion = "3.0.3"
+	// OpenAPIFileEnvVar is the environment variable the aegis CLI sets when running an app to generate an OpenAPI
+	// document (`aegis openapi`). When it's set, Start() writes the document for the Router to that file and returns.
+	OpenAPIFileEnvVar = "AEGIS_OPENAPI_FILE"
+)
+
+// OpenAPIDocument is an OpenAPI 3 document, only the parts used to document a Router are defined
+// https://swagger.io/specification/
+type OpenAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components *OpenAPIComponents         `json:"components,omitempty"`
+}
+
+// OpenAPIInfo is the API's title, description and version
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// OpenAPIPathItem holds the operations for a path, keyed by lowercase method
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+// OpenAPIOperation is a route
+type OpenAPIOperation struct {
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	OperationID string                     `json:"operationId,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter is a path parameter
+type OpenAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIRequestBody is a request body, by content type
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse is a response, by content type
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType is the schema for a content type
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIComponents holds the schemas of named (struct) types, which are referenced by other schemas
+type OpenAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas,omitempty"`
+}
+
+// OpenAPISchema is a JSON schema, as used by OpenAPI
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+}
+
+// OpenAPI returns an OpenAPI 3 document for the routes handled by the Router. Routes are documented using their
+// metadata (see Describe()), request and response body schemas are generated from the types' JSON struct tags.
+// Note that catch-all params (*name) are documented as a single path param, OpenAPI has no way to describe them.
+func (r *Router) OpenAPI(info OpenAPIInfo) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info:    info,
+		Paths:   map[string]OpenAPIPathItem{},
+	}
+	schemas := openAPISchemas{schemas: map[reflect.Type]*OpenAPISchema{}, refs: map[reflect.Type][]*OpenAPISchema{}}
+
+	for _, rt := range r.Routes() {
+		path, params := openAPIPath(rt.Path)
+		op := &OpenAPIOperation{
+			Summary:     rt.Summary,
+			Description: rt.Description,
+			OperationID: rt.OperationID,
+			Tags:        rt.Tags,
+			Deprecated:  rt.Deprecated,
+			Parameters:  params,
+			Responses:   map[string]OpenAPIResponse{},
+		}
+		if rt.Request != nil {
+			op.RequestBody = &OpenAPIRequestBody{
+				Required: true,
+				Content:  openAPIContent(schemas.schema(reflect.TypeOf(rt.Request))),
+			}
+		}
+		for status, body := range rt.Responses {
+			res := OpenAPIResponse{Description: http.StatusText(status)}
+			if body != nil {
+				res.Content = openAPIContent(schemas.schema(reflect.TypeOf(body)))
+			}
+			op.Responses[strconv.Itoa(status)] = res
+		}
+		// At least one response is required
+		if len(op.Responses) == 0 {
+			op.Responses["200"] = OpenAPIResponse{Description: http.StatusText(200)}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = OpenAPIPathItem{}
+		}
+		doc.Paths[path][strings.ToLower(rt.Method)] = op
+	}
+
+	if len(schemas.schemas) > 0 {
+		doc.Components = &OpenAPIComponents{Schemas: schemas.components()}
+	}
+	return doc
+}
+
+// writeOpenAPIFile writes the OpenAPI document for the Router to the file named by OpenAPIFileEnvVar, if it's set.
+// It returns true if the variable was set.
+func writeOpenAPIFile(r *Router) bool {
+	file := os.Getenv(OpenAPIFileEnvVar)
+	if file == "" {
+		return false
+	}
+	doc := &OpenAPIDocument{OpenAPI: OpenAPIVersion, Paths: map[string]OpenAPIPathItem{}}
+	if r != nil {
+		doc = r.OpenAPI(OpenAPIInfo{})
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(file, b, 0644)
+	}
+	if err != nil {
+		Log.Errorf("Could not write the OpenAPI document: %s", err)
+	}
+	return true
+}
+
+// openAPIPath returns the OpenAPI path (ie. /posts/{id}) and path params for a Router path (ie. /posts/:id)
+func openAPIPath(path string) (string, []OpenAPIParameter) {
+	params := []OpenAPIParameter{}
+	components := strings.Split(path, "/")
+	for i, component := range components {
+		if component == "" || (component[0] != ':' && component[0] != '*') {
+			continue
+		}
+		// newNode() already parsed (and validated) the component
+		n := newNode(component, path)
+		schema := &OpenAPISchema{Type: "string"}
+		if n.pattern != nil {
+			schema.Pattern = n.pattern.String()
+		}
+		params = append(params, OpenAPIParameter{Name: n.paramName, In: "path", Required: true, Schema: schema})
+		components[i] = "{" + n.paramName + "}"
+	}
+	return strings.Join(components, "/"), params
+}
+
+// openAPIContent returns the content for a JSON body with the given schema
+func openAPIContent(schema *OpenAPISchema) map[string]OpenAPIMediaType {
+	return map[string]OpenAPIMediaType{
+		MIMEApplicationJSON: {Schema: schema},
+	}
+}
+
+// openAPISchemas are the schemas of named struct types, which are referenced instead of repeated. The references are
+// only set by components(), once all of the types are known, since types with the same name need different names.
+type openAPISchemas struct {
+	schemas map[reflect.Type]*OpenAPISchema
+	refs    map[reflect.Type][]*OpenAPISchema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema for a type, using the same field names and types as encoding/json
+func (s openAPISchemas) schema(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return &OpenAPISchema{Type: "integer"}
+	case reflect.Int32, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		// encoding/json encodes []byte as a base64 string
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: s.schema(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		ref := &OpenAPISchema{}
+		s.refs[t] = append(s.refs[t], ref)
+		if _, ok := s.schemas[t]; !ok {
+			// Set before building the schema, so recursive types reference it
+			s.schemas[t] = &OpenAPISchema{}
+			*s.schemas[t] = *s.structSchema(t)
+		}
+		return ref
+	}
+	// Interfaces could be anything
+	return &OpenAPISchema{}
+}
+
+// components returns the schemas by component name and sets the references to them. The name is the type's name,
+// unless types from different packages have the same name (ie. api.Error and store.Error). Those are qualified by
+// their package path, ie. github.com.example.api.Error.
+func (s openAPISchemas) components() map[string]*OpenAPISchema {
+	types := map[string]int{}
+	for t := range s.schemas {
+		types[t.Name()]++
+	}
+	components := make(map[string]*OpenAPISchema, len(s.schemas))
+	for t, schema := range s.schemas {
+		name := t.Name()
+		if types[name] > 1 {
+			name = strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + name
+		}
+		components[name] = schema
+		for _, ref := range s.refs[t] {
+			ref.Ref = "#/components/schemas/" + name
+		}
+	}
+	return components
+}
+
+// structSchema returns the object schema for a struct type. Fields without omitempty are required.
+func (s openAPISchemas) structSchema(t reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		// Like encoding/json, the fields of embedded structs are promoted
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			embedded := s.structSchema(fieldType)
+			for k, v := range embedded.Properties {
+				if _, ok := schema.Properties[k]; !ok {
+					schema.Properties[k] = v
+				}
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = s.schema(field.Type)
+		if !strings.Contains(tag, ",omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
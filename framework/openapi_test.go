@@ -0,0 +1,164 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type openAPITestAuthor struct {
+	Name    string             `json:"name"`
+	Manager *openAPITestAuthor `json:"manager,omitempty"`
+}
+
+type openAPITestTimestamps struct {
+	Created time.Time `json:"created"`
+}
+
+type openAPITestPost struct {
+	openAPITestTimestamps
+	ID      int64             `json:"id"`
+	Title   string            `json:"title"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	Author  openAPITestAuthor `json:"author"`
+	Secret  string            `json:"-"`
+	private string
+}
+
+func TestOpenAPI(t *testing.T) {
+	handler := func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) error {
+		return nil
+	}
+	router := NewRouter(handler)
+	router.URIVersion = "/v1"
+	router.GET("/posts", handler)
+	router.POST("/posts", handler)
+	router.GET("/posts/:id{[0-9]+}", handler)
+	router.GET("/files/*path", handler)
+
+	router.Describe("POST", "/posts", RouteMeta{
+		Summary:     "Create a post",
+		OperationID: "createPost",
+		Tags:        []string{"posts"},
+		Request:     openAPITestPost{},
+		Responses:   map[int]interface{}{201: &openAPITestPost{}, 400: nil},
+	})
+	router.Describe("GET", "/posts", RouteMeta{
+		Responses: map[int]interface{}{200: []openAPITestPost{}},
+	})
+
+	Convey("OpenAPI()", t, func() {
+		doc := router.OpenAPI(OpenAPIInfo{Title: "Blog", Version: "1.0.0"})
+
+		Convey("Should document each route by path and method", func() {
+			So(doc.OpenAPI, ShouldEqual, OpenAPIVersion)
+			So(doc.Info.Title, ShouldEqual, "Blog")
+			So(doc.Paths, ShouldContainKey, "/v1/posts")
+			So(doc.Paths["/v1/posts"], ShouldContainKey, "get")
+			So(doc.Paths["/v1/posts"], ShouldContainKey, "post")
+
+			op := doc.Paths["/v1/posts"]["post"]
+			So(op.Summary, ShouldEqual, "Create a post")
+			So(op.OperationID, ShouldEqual, "createPost")
+			So(op.Tags, ShouldResemble, []string{"posts"})
+			So(op.Responses, ShouldContainKey, "201")
+			So(op.Responses["201"].Description, ShouldEqual, "Created")
+			So(op.Responses["201"].Content[MIMEApplicationJSON].Schema.Ref, ShouldEqual, "#/components/schemas/openAPITestPost")
+			So(op.Responses["400"].Content, ShouldBeNil)
+			So(op.RequestBody.Content[MIMEApplicationJSON].Schema.Ref, ShouldEqual, "#/components/schemas/openAPITestPost")
+
+			list := doc.Paths["/v1/posts"]["get"].Responses["200"].Content[MIMEApplicationJSON].Schema
+			So(list.Type, ShouldEqual, "array")
+			So(list.Items.Ref, ShouldEqual, "#/components/schemas/openAPITestPost")
+		})
+
+		Convey("Should document path params", func() {
+			So(doc.Paths, ShouldContainKey, "/v1/posts/{id}")
+			params := doc.Paths["/v1/posts/{id}"]["get"].Parameters
+			So(params, ShouldHaveLength, 1)
+			So(params[0].Name, ShouldEqual, "id")
+			So(params[0].In, ShouldEqual, "path")
+			So(params[0].Schema.Pattern, ShouldEqual, "^(?:[0-9]+)$")
+			So(doc.Paths, ShouldContainKey, "/v1/files/{path}")
+			So(doc.Paths["/v1/files/{path}"]["get"].Responses, ShouldContainKey, "200")
+		})
+
+		Convey("Should generate schemas from JSON struct tags", func() {
+			post := doc.Components.Schemas["openAPITestPost"]
+			So(post.Type, ShouldEqual, "object")
+			So(post.Properties["created"].Format, ShouldEqual, "date-time")
+			So(post.Properties["id"].Format, ShouldEqual, "int64")
+			So(post.Properties["tags"].Items.Type, ShouldEqual, "string")
+			So(post.Properties["meta"].AdditionalProperties.Type, ShouldEqual, "string")
+			So(post.Properties["author"].Ref, ShouldEqual, "#/components/schemas/openAPITestAuthor")
+			So(post.Properties, ShouldNotContainKey, "Secret")
+			So(post.Properties, ShouldNotContainKey, "private")
+			So(post.Required, ShouldResemble, []string{"created", "id", "title", "author"})
+
+			author := doc.Components.Schemas["openAPITestAuthor"]
+			So(author.Properties["manager"].Ref, ShouldEqual, "#/components/schemas/openAPITestAuthor")
+		})
+
+		Convey("Should qualify the names of types with the same name from different packages", func() {
+			type URL struct {
+				Link string `json:"link"`
+			}
+			urlRouter := NewRouter(handler)
+			urlRouter.POST("/links", handler)
+			urlRouter.Describe("POST", "/links", RouteMeta{
+				Request:   url.URL{},
+				Responses: map[int]interface{}{201: URL{}},
+			})
+			urlDoc := urlRouter.OpenAPI(OpenAPIInfo{Title: "Links", Version: "1.0.0"})
+
+			op := urlDoc.Paths["/links"]["post"]
+			So(op.RequestBody.Content[MIMEApplicationJSON].Schema.Ref, ShouldEqual, "#/components/schemas/net.url.URL")
+			So(op.Responses["201"].Content[MIMEApplicationJSON].Schema.Ref, ShouldEqual, "#/components/schemas/github.com.tmaiaroto.aegis.framework.URL")
+			So(urlDoc.Components.Schemas["net.url.URL"].Properties, ShouldContainKey, "Host")
+			So(urlDoc.Components.Schemas["github.com.tmaiaroto.aegis.framework.URL"].Properties, ShouldContainKey, "link")
+			So(urlDoc.Components.Schemas, ShouldNotContainKey, "URL")
+			// url.URL references url.Userinfo, which has no other type with its name
+			So(urlDoc.Components.Schemas, ShouldContainKey, "Userinfo")
+		})
+	})
+
+	Convey("writeOpenAPIFile()", t, func() {
+		Convey("Should only write the document when the environment variable is set", func() {
+			So(writeOpenAPIFile(router), ShouldBeFalse)
+
+			f, err := ioutil.TempFile("", "aegis_openapi_test")
+			So(err, ShouldBeNil)
+			f.Close()
+			defer os.Remove(f.Name())
+			os.Setenv(OpenAPIFileEnvVar, f.Name())
+			defer os.Unsetenv(OpenAPIFileEnvVar)
+
+			So(writeOpenAPIFile(router), ShouldBeTrue)
+			b, _ := ioutil.ReadFile(f.Name())
+			var doc OpenAPIDocument
+			So(json.Unmarshal(b, &doc), ShouldBeNil)
+			So(doc.Paths, ShouldContainKey, "/v1/posts/{id}")
+		})
+	})
+}
@@ -18,10 +18,15 @@ package framework
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -35,10 +40,34 @@ const (
 	post    = "POST"
 	put     = "PUT"
 	patch   = "PATCH"
-	delete  = "DELETE"
+	del     = "DELETE"
 	options = "OPTIONS"
 )
 
+// RoutesFileEnvVar is the environment variable the aegis CLI sets when running an app to find the Router's routes,
+// ie. to deploy an API Gateway resource for each route. When it's set, Start() writes the routes to that file and returns.
+const RoutesFileEnvVar = "AEGIS_ROUTES_FILE"
+
+// Route is a route handled by a Router, see Routes()
+type Route struct {
+	Method string
+	Path   string
+	RouteMeta
+}
+
+// RouteMeta describes a route for API documentation, see Describe() and OpenAPI()
+type RouteMeta struct {
+	Summary     string
+	Description string
+	OperationID string
+	Tags        []string
+	Deprecated  bool
+	// Request is a value of the request body's type, ie. CreatePostRequest{}
+	Request interface{}
+	// Responses are values of the response body types by status code, ie. map[int]interface{}{200: Post{}, 404: nil}
+	Responses map[int]interface{}
+}
+
 // RouteHandler is similar to "net/http" Handler, except there is no response writer.
 // Instead the *APIGatewayProxyResponse is manipulated and returned directly.
 type RouteHandler func(context.Context, *HandlerDependencies, *APIGatewayProxyRequest, *APIGatewayProxyResponse, url.Values) error
@@ -58,13 +87,45 @@ type Router struct {
 	URIVersion     string
 	GatewayPort    string
 	Tracer         TraceStrategy
+	// CORS, if set, adds CORS headers to responses and answers preflight requests, see CORSConfig
+	CORS *CORSConfig
+	// Route groups share the tree with the Router they were created from, see Group()
+	prefix          string
+	groupMiddleware []Middleware
+	groups          []*Router
+	root            *Router
 }
 
 var (
 	// ErrNameNotProvided is thrown when a name is not provided
 	ErrNameNotProvided = errors.New("no name was provided in the HTTP body")
+	// ErrMethodNotAllowed is the response body error when a path has routes, but not for the request method
+	ErrMethodNotAllowed = errors.New("method not allowed")
 )
 
+func init() {
+	// API Gateway Lambda Proxy requests are handled by Router
+	RegisterEventType(EventType{
+		Name:     "APIGatewayProxyRequest",
+		Priority: 100,
+		Detect: func(evt map[string]interface{}) bool {
+			return keyInMap("httpMethod", evt) && keyInMap("path", evt)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e APIGatewayProxyRequest
+			// The event contains no time/date, should decode just fine
+			err := DecodeEvent(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.Router != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.Router.LambdaHandler(ctx, d, evt.(APIGatewayProxyRequest))
+		},
+	})
+}
+
 // NewRouter creates a new router. Take the root/fall through route
 // like how the default mux works. Only difference is in this case,
 // you have to specific one.
@@ -74,7 +135,12 @@ func NewRouter(rootHandler RouteHandler) *Router {
 }
 
 // Use will set middleware on the Router that gets used by all handled routes.
+// On a route group, the middleware is used by the group's routes that are handled after calling Use.
 func (r *Router) Use(middleware ...Middleware) {
+	if r.root != nil {
+		r.groupMiddleware = append(r.groupMiddleware, middleware...)
+		return
+	}
 	r.middleware = append(r.middleware, middleware...)
 }
 
@@ -89,7 +155,7 @@ func (r *Router) Handle(method, path string, handler RouteHandler, middleware ..
 	if path[0] != '/' {
 		panic("Path has to start with a /.")
 	}
-	r.tree.addNode(method, r.URIVersion+path, handler, middleware...)
+	r.tree.addNode(method, r.groupPath(path), handler, r.routeMiddleware(middleware)...)
 }
 
 // GET same as Handle only the method is already implied.
@@ -124,7 +190,170 @@ func (r *Router) PATCH(path string, handler RouteHandler, middleware ...Middlewa
 
 // DELETE same as Handle only the method is already implied.
 func (r *Router) DELETE(path string, handler RouteHandler, middleware ...Middleware) {
-	r.Handle(delete, path, handler, middleware...)
+	r.Handle(del, path, handler, middleware...)
+}
+
+// Describe sets the metadata for a handled route, which is used to document it (see OpenAPI()).
+// The path is the same one given to Handle(), so on a route group it doesn't include the group's prefix.
+func (r *Router) Describe(method, path string, meta RouteMeta) {
+	fullPath := r.groupPath(path)
+	n := r.tree.find(fullPath)
+	if n == nil || n.methods[method] == nil {
+		panic(fmt.Sprintf("%s %s is not handled", method, fullPath))
+	}
+	n.methods[method].meta = meta
+}
+
+// Routes returns the routes handled by the Router, sorted by path and method. On a route group, only the group's
+// routes are returned. Paths include the URI version and use the same syntax given to Handle(), ie. /posts/:id
+func (r *Router) Routes() []Route {
+	prefix := r.URIVersion + r.prefix
+	routes := []Route{}
+	r.tree.walk("", func(method string, path string, rt *route) {
+		if r.root != nil && path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			return
+		}
+		routes = append(routes, Route{Method: method, Path: path, RouteMeta: rt.meta})
+	})
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
+}
+
+// writeRoutesFile writes the methods and paths of the Router's routes as JSON to the file named by RoutesFileEnvVar,
+// if it's set. It returns true if the variable was set, in which case the app should not listen for events.
+func writeRoutesFile(r *Router) bool {
+	file := os.Getenv(RoutesFileEnvVar)
+	if file == "" {
+		return false
+	}
+	routes := []map[string]string{}
+	if r != nil {
+		for _, rt := range r.Routes() {
+			routes = append(routes, map[string]string{"method": rt.Method, "path": rt.Path})
+		}
+	}
+	b, err := json.Marshal(routes)
+	if err == nil {
+		err = ioutil.WriteFile(file, b, 0644)
+	}
+	if err != nil {
+		Log.Errorf("Could not write the routes: %s", err)
+	}
+	return true
+}
+
+// writeCLIFiles writes the files the aegis CLI asked for when running the app (see writeRoutesFile and
+// writeOpenAPIFile). It returns true if any were asked for, in which case the app should not listen for events.
+func writeCLIFiles(r *Router) bool {
+	routes := writeRoutesFile(r)
+	openAPI := writeOpenAPIFile(r)
+	return routes || openAPI
+}
+
+// Group returns a route group, a child Router that shares this Router's routes. Routes handled by the group are
+// prefixed with the given path and use the group's middleware before their own. Groups can also have their own
+// not found handler, see NotFound(). Groups can be nested.
+func (r *Router) Group(prefix string, middleware ...Middleware) *Router {
+	if prefix == "" || prefix[0] != '/' {
+		panic("Group prefix has to start with a /.")
+	}
+	root := r.rootRouter()
+	g := &Router{
+		tree:       r.tree,
+		URIVersion: r.URIVersion,
+		prefix:     r.prefix + strings.TrimRight(prefix, "/"),
+		root:       root,
+	}
+	g.groupMiddleware = append(g.groupMiddleware, r.groupMiddleware...)
+	g.groupMiddleware = append(g.groupMiddleware, middleware...)
+	root.groups = append(root.groups, g)
+	return g
+}
+
+// Mount adds all of the routes handled by another Router under the given prefix, so an API can be split across
+// packages. The other Router's middleware (added with Use()) is used by its routes, after any group middleware.
+// Its root handler becomes the not found handler for the prefix. Note that standard middleware (added with
+// UseStandard()) is not mounted and routes handled by the other Router after calling Mount are not added.
+func (r *Router) Mount(prefix string, sub *Router) {
+	g := r.Group(prefix, sub.middleware...)
+	g.rootHandler = sub.rootHandler
+
+	// The sub-router's paths already include its own URIVersion
+	sub.tree.walk("", func(method string, path string, rt *route) {
+		mounted := *rt
+		mounted.middleware = g.routeMiddleware(rt.middleware)
+		g.tree.addRoute(method, g.groupPath(path), &mounted)
+	})
+
+	// Keep the not found handlers of the sub-router's groups
+	for _, subGroup := range sub.groups {
+		if subGroup.rootHandler == nil {
+			continue
+		}
+		mountedGroup := g.Group(subGroup.URIVersion+subGroup.prefix, subGroup.groupMiddleware...)
+		mountedGroup.rootHandler = subGroup.rootHandler
+	}
+}
+
+// NotFound sets the handler used when no route matches. On a route group, it is used for paths with the group's
+// prefix, after the group's middleware. The most specific group's handler is used, otherwise the Router's root handler.
+func (r *Router) NotFound(handler RouteHandler) {
+	r.rootHandler = handler
+}
+
+// rootRouter returns the Router that route groups were created from
+func (r *Router) rootRouter() *Router {
+	if r.root != nil {
+		return r.root
+	}
+	return r
+}
+
+// groupPath returns the full path for a route handled by the Router, including the URI version and group prefix
+func (r *Router) groupPath(path string) string {
+	// The group's prefix itself
+	if path == "/" && r.prefix != "" {
+		path = ""
+	}
+	return r.URIVersion + r.prefix + path
+}
+
+// routeMiddleware returns the group middleware followed by the route's middleware
+func (r *Router) routeMiddleware(middleware []Middleware) []Middleware {
+	if len(r.groupMiddleware) == 0 {
+		return middleware
+	}
+	m := make([]Middleware, 0, len(r.groupMiddleware)+len(middleware))
+	m = append(m, r.groupMiddleware...)
+	return append(m, middleware...)
+}
+
+// notFoundHandler returns the handler (and its middleware) for a path no route matches. That is the not found handler
+// of the route group with the longest matching prefix, or the root handler.
+func (r *Router) notFoundHandler(path string) (RouteHandler, []Middleware) {
+	root := r.rootRouter()
+	var found *Router
+	for _, g := range root.groups {
+		if g.rootHandler == nil {
+			continue
+		}
+		prefix := g.URIVersion + g.prefix
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if found == nil || len(prefix) > len(found.URIVersion+found.prefix) {
+			found = g
+		}
+	}
+	if found != nil {
+		return found.rootHandler, found.groupMiddleware
+	}
+	return root.rootHandler, nil
 }
 
 // runMiddleware loops over the slice of middleware and call to each of the middleware handlers.
@@ -175,16 +404,20 @@ func runStandardMiddleware(ctx context.Context, req *APIGatewayProxyRequest, mid
 
 // LambdaHandler is a native AWS Lambda Go handler function (no more shim).
 func (r *Router) LambdaHandler(ctx context.Context, d *HandlerDependencies, req APIGatewayProxyRequest) (APIGatewayProxyResponse, error) {
-	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
-	if r.Tracer != nil {
-		d.Tracer = r.Tracer
-	}
-
 	// If an incoming event can be matched to this router, but the router has no registered handlers
 	// or if one hasn't been added to aegis.Handlers{}.
 	if r == nil {
 		return APIGatewayProxyResponse{}, errors.New("no handlers registered for Router")
 	}
+	// A route group shares the root Router's routes, but not its not found handler or middleware
+	if r.root != nil {
+		return r.root.LambdaHandler(ctx, d, req)
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
 
 	// url.Values are typically used for qureystring parameters.
 	// However, this router uses them for path params.
@@ -211,8 +444,21 @@ func (r *Router) LambdaHandler(ctx context.Context, d *HandlerDependencies, req
 	}
 
 	// use the Path and HTTPMethod from the event to figure out the route
-	node, _ := r.tree.traverse(strings.Split(req.Path, "/")[1:], params)
-	if handler := node.methods[req.HTTPMethod]; handler != nil {
+	var handler *route
+	var methods map[string]*route
+	headFromGet := false
+	if node := r.tree.match(strings.Split(req.Path, "/")[1:], params); node != nil {
+		methods = node.methods
+		handler = node.methods[req.HTTPMethod]
+		// HEAD requests are served by the GET handler when there is no HEAD route, the body is then removed
+		if handler == nil && req.HTTPMethod == head {
+			handler = node.methods[get]
+			headFromGet = handler != nil
+		}
+	}
+	r.CORS.setHeaders(&req, &res)
+
+	if handler != nil {
 		// Middleware must return true in order to continue.
 		// If it returns false, it will catch and halt everything.
 		if !runMiddleware(ctx, d, &req, &res, params, handler.middleware...) {
@@ -239,8 +485,22 @@ func (r *Router) LambdaHandler(ctx context.Context, d *HandlerDependencies, req
 		// TODO: look at environment variable to see if XRay was disabled (env var on lambda or when running local server)
 		// Then just call handler and not the xray part above.
 		// handler.handler(ctx, &req, &res, params)
+	} else if len(methods) > 0 {
+		// The path has routes, just not for this method
+		allow := allowHeader(methods)
+		res.SetHeader(HeaderAllow, allow)
+		if req.HTTPMethod == options {
+			r.CORS.setPreflightHeaders(&req, &res, allow)
+			res.SetStatus(204)
+		} else {
+			res.Error(405, ErrMethodNotAllowed)
+		}
 	} else {
-		r.rootHandler(ctx, d, &req, &res, params)
+		handler, middleware := r.notFoundHandler(req.Path)
+		if !runMiddleware(ctx, d, &req, &res, params, middleware...) {
+			return res, nil
+		}
+		handler(ctx, d, &req, &res, params)
 	}
 
 	// Returning an error from this handler is how AWS Lambda works, but when dealing with API Gateway, it doesn't make for
@@ -254,10 +514,19 @@ func (r *Router) LambdaHandler(ctx context.Context, d *HandlerDependencies, req
 		// At least for now, the response will be of the intended type and should contain something somewhat useful.
 		res.Error(500, err)
 	}
+	if headFromGet {
+		res.Body = ""
+		res.IsBase64Encoded = false
+	}
 	return res, nil
 }
 
 // Listen will start the internal router and listen for Lambda events to forward to registered routes.
 func (r *Router) Listen() {
+	r = r.rootRouter()
+	// The aegis CLI runs the app to find its routes (`aegis openapi` and `aegis deploy`)
+	if writeCLIFiles(r) {
+		return
+	}
 	lambda.Start(r.LambdaHandler)
 }
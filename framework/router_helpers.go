@@ -0,0 +1,57 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// globMatch returns true if the pattern is empty or if the value matches the glob pattern
+func globMatch(pattern string, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	g, err := glob.Compile(pattern)
+	return err == nil && g.Match(value)
+}
+
+// lookupField returns the string value of a (dot notation) field within a map
+func lookupField(m map[string]interface{}, field string) (string, bool) {
+	var v interface{} = m
+	for _, part := range strings.Split(field, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if v, ok = obj[part]; !ok {
+			return "", false
+		}
+	}
+	switch val := v.(type) {
+	case string:
+		return val, true
+	case nil:
+		return "", true
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(val)
+		return string(b), true
+	default:
+		return fmt.Sprint(val), true
+	}
+}
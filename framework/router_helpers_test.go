@@ -0,0 +1,79 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRouterHelpers(t *testing.T) {
+
+	Convey("globMatch()", t, func() {
+		Convey("Should match anything with an empty pattern", func() {
+			So(globMatch("", "anything"), ShouldBeTrue)
+		})
+
+		Convey("Should match glob patterns", func() {
+			So(globMatch("orders-*", "orders-1"), ShouldBeTrue)
+			So(globMatch("orders-*", "clicks-1"), ShouldBeFalse)
+		})
+
+		Convey("Should not match with an invalid pattern", func() {
+			So(globMatch("[", "["), ShouldBeFalse)
+		})
+	})
+
+	Convey("lookupField()", t, func() {
+		m := map[string]interface{}{
+			"type":  "signup",
+			"count": float64(2),
+			"user":  map[string]interface{}{"plan": "pro"},
+			"empty": nil,
+		}
+
+		Convey("Should return string values of top level and nested fields", func() {
+			v, ok := lookupField(m, "type")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, "signup")
+
+			v, ok = lookupField(m, "user.plan")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, "pro")
+
+			v, ok = lookupField(m, "count")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, "2")
+
+			v, ok = lookupField(m, "user")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, `{"plan":"pro"}`)
+		})
+
+		Convey("Should return an empty string for null fields", func() {
+			v, ok := lookupField(m, "empty")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, "")
+		})
+
+		Convey("Should return false for missing fields", func() {
+			_, ok := lookupField(m, "user.name")
+			So(ok, ShouldBeFalse)
+			_, ok = lookupField(m, "type.name")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
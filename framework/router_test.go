@@ -16,7 +16,9 @@ package framework
 
 import (
 	"context"
+	"io/ioutil"
 	"net/url"
+	"os"
 	"strings"
 	"testing"
 
@@ -103,3 +105,241 @@ func TestRouter(t *testing.T) {
 	})
 
 }
+
+func TestRouterGroups(t *testing.T) {
+	respond := func(body string) RouteHandler {
+		return func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) error {
+			res.StatusCode = 200
+			res.Body = body + params.Get("id")
+			return nil
+		}
+	}
+	notFound := func(body string) RouteHandler {
+		return func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) error {
+			res.StatusCode = 404
+			res.Body = body
+			return nil
+		}
+	}
+	var calls []string
+	track := func(name string, next bool) Middleware {
+		return func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) bool {
+			calls = append(calls, name)
+			if !next {
+				res.StatusCode = 401
+			}
+			return next
+		}
+	}
+	serve := func(r *Router, method string, path string, headers ...map[string]string) APIGatewayProxyResponse {
+		req := APIGatewayProxyRequest{HTTPMethod: method, Path: path}
+		if len(headers) > 0 {
+			req.Headers = headers[0]
+		}
+		res, err := r.LambdaHandler(context.Background(), &HandlerDependencies{Tracer: &NoTraceStrategy{}}, req)
+		So(err, ShouldBeNil)
+		return res
+	}
+
+	router := NewRouter(notFound("root not found"))
+	router.URIVersion = "/v1"
+	router.GET("/", respond("home"))
+
+	admin := router.Group("/admin", track("admin", true))
+	admin.GET("/", respond("admin"))
+	admin.GET("/users/:id", respond("user "), track("route", true))
+	admin.NotFound(notFound("admin not found"))
+
+	reports := admin.Group("/reports/", track("reports", false))
+	reports.GET("/daily", respond("daily"))
+
+	billing := NewRouter(notFound("billing not found"))
+	billing.Use(track("billing", true))
+	billing.GET("/invoices/:id", respond("invoice "))
+	billing.Group("/internal").NotFound(notFound("internal not found"))
+	router.Mount("/billing", billing)
+
+	Convey("Route groups", t, func() {
+		calls = []string{}
+
+		Convey("Should prefix routes and use group middleware before route middleware", func() {
+			So(serve(router, "GET", "/v1/").Body, ShouldEqual, "home")
+			So(serve(router, "GET", "/v1/admin").Body, ShouldEqual, "admin")
+			So(serve(router, "GET", "/v1/admin/users/7").Body, ShouldEqual, "user 7")
+			So(calls, ShouldResemble, []string{"admin", "admin", "route"})
+		})
+
+		Convey("Should use the middleware of parent groups", func() {
+			res := serve(router, "GET", "/v1/admin/reports/daily")
+			So(res.StatusCode, ShouldEqual, 401)
+			So(calls, ShouldResemble, []string{"admin", "reports"})
+		})
+
+		Convey("Should use the most specific not found handler", func() {
+			So(serve(router, "GET", "/v1/admin/nope").Body, ShouldEqual, "admin not found")
+			So(calls, ShouldResemble, []string{"admin"})
+			So(serve(router, "GET", "/v1/administrator").Body, ShouldEqual, "root not found")
+			So(serve(router, "GET", "/nope").Body, ShouldEqual, "root not found")
+		})
+
+		Convey("Should mount another router's routes and not found handlers", func() {
+			So(serve(router, "GET", "/v1/billing/invoices/3").Body, ShouldEqual, "invoice 3")
+			So(calls, ShouldResemble, []string{"billing"})
+			So(serve(router, "GET", "/v1/billing/nope").Body, ShouldEqual, "billing not found")
+			So(serve(router, "GET", "/v1/billing/internal/nope").Body, ShouldEqual, "internal not found")
+		})
+
+		Convey("Should handle requests with the root Router when a group's LambdaHandler is used", func() {
+			So(serve(reports, "GET", "/v1/admin/reports/daily").StatusCode, ShouldEqual, 401)
+			So(calls, ShouldResemble, []string{"admin", "reports"})
+			So(serve(reports, "GET", "/v1/").Body, ShouldEqual, "home")
+			So(serve(reports, "GET", "/nope").Body, ShouldEqual, "root not found")
+			So(serve(admin, "GET", "/v1/admin/nope").Body, ShouldEqual, "admin not found")
+		})
+	})
+}
+
+func TestRouterMethods(t *testing.T) {
+	respond := func(body string) RouteHandler {
+		return func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) error {
+			res.SetHeader("X-Handler", body)
+			res.StatusCode = 200
+			res.Body = body
+			return nil
+		}
+	}
+	serve := func(r *Router, method string, path string, headers ...map[string]string) APIGatewayProxyResponse {
+		req := APIGatewayProxyRequest{HTTPMethod: method, Path: path}
+		if len(headers) > 0 {
+			req.Headers = headers[0]
+		}
+		res, err := r.LambdaHandler(context.Background(), &HandlerDependencies{Tracer: &NoTraceStrategy{}}, req)
+		So(err, ShouldBeNil)
+		return res
+	}
+
+	router := NewRouter(func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) error {
+		res.StatusCode = 404
+		return nil
+	})
+	router.GET("/posts/:id", respond("get"))
+	router.PUT("/posts/:id", respond("put"))
+	router.DELETE("/posts/:id", respond("delete"))
+	router.POST("/uploads", respond("upload"))
+	router.OPTIONS("/uploads", respond("options"))
+
+	Convey("Router methods", t, func() {
+		Convey("Should respond with a 405 and an Allow header when the path has no route for the method", func() {
+			res := serve(router, "POST", "/posts/1")
+			So(res.StatusCode, ShouldEqual, 405)
+			So(res.Body, ShouldEqual, ErrMethodNotAllowed.Error())
+			So(res.Headers[HeaderAllow], ShouldEqual, "DELETE, GET, HEAD, OPTIONS, PUT")
+			So(serve(router, "GET", "/uploads").Headers[HeaderAllow], ShouldEqual, "OPTIONS, POST")
+			So(serve(router, "POST", "/nope").StatusCode, ShouldEqual, 404)
+		})
+
+		Convey("Should serve HEAD requests with the GET handler and no body", func() {
+			res := serve(router, "HEAD", "/posts/1")
+			So(res.StatusCode, ShouldEqual, 200)
+			So(res.Headers["X-Handler"], ShouldEqual, "get")
+			So(res.Body, ShouldEqual, "")
+		})
+
+		Convey("Should answer OPTIONS requests unless there is an OPTIONS route", func() {
+			res := serve(router, "OPTIONS", "/posts/1")
+			So(res.StatusCode, ShouldEqual, 204)
+			So(res.Headers[HeaderAllow], ShouldEqual, "DELETE, GET, HEAD, OPTIONS, PUT")
+			So(res.Headers, ShouldNotContainKey, HeaderAccessControlAllowOrigin)
+			So(serve(router, "OPTIONS", "/uploads").Body, ShouldEqual, "options")
+		})
+
+		Convey("Should answer preflight requests and set CORS headers for allowed origins", func() {
+			router.CORS = &CORSConfig{
+				AllowOrigins:  []string{"https://example.com"},
+				ExposeHeaders: []string{"X-Handler"},
+				MaxAge:        600,
+			}
+			defer func() { router.CORS = nil }()
+
+			preflight := serve(router, "OPTIONS", "/posts/1", map[string]string{
+				"origin":                         "https://example.com",
+				"access-control-request-method":  "PUT",
+				"access-control-request-headers": "Content-Type",
+			})
+			So(preflight.StatusCode, ShouldEqual, 204)
+			So(preflight.Headers[HeaderAccessControlAllowOrigin], ShouldEqual, "https://example.com")
+			So(preflight.Headers[HeaderVary], ShouldEqual, HeaderOrigin)
+			So(preflight.Headers[HeaderAccessControlAllowMethods], ShouldEqual, "DELETE, GET, HEAD, OPTIONS, PUT")
+			So(preflight.Headers[HeaderAccessControlAllowHeaders], ShouldEqual, "Content-Type")
+			So(preflight.Headers[HeaderAccessControlMaxAge], ShouldEqual, "600")
+
+			res := serve(router, "GET", "/posts/1", map[string]string{"Origin": "https://example.com"})
+			So(res.Body, ShouldEqual, "get")
+			So(res.Headers[HeaderAccessControlAllowOrigin], ShouldEqual, "https://example.com")
+			So(res.Headers[HeaderAccessControlExposeHeaders], ShouldEqual, "X-Handler")
+
+			other := serve(router, "OPTIONS", "/posts/1", map[string]string{"Origin": "https://other.com"})
+			So(other.StatusCode, ShouldEqual, 204)
+			So(other.Headers, ShouldNotContainKey, HeaderAccessControlAllowOrigin)
+			So(other.Headers, ShouldNotContainKey, HeaderAccessControlAllowMethods)
+		})
+
+		Convey("Should only use a wildcard origin without credentials", func() {
+			router.CORS = &CORSConfig{AllowOrigins: []string{"*"}}
+			defer func() { router.CORS = nil }()
+			origin := map[string]string{"Origin": "https://example.com"}
+
+			So(serve(router, "GET", "/posts/1", origin).Headers[HeaderAccessControlAllowOrigin], ShouldEqual, "*")
+			router.CORS.AllowCredentials = true
+			res := serve(router, "GET", "/posts/1", origin)
+			So(res.Headers[HeaderAccessControlAllowOrigin], ShouldEqual, "https://example.com")
+			So(res.Headers[HeaderAccessControlAllowCredentials], ShouldEqual, "true")
+		})
+	})
+}
+
+func TestRouterRoutes(t *testing.T) {
+	handler := func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) error {
+		return nil
+	}
+	router := NewRouter(handler)
+	router.POST("/posts", handler)
+	router.GET("/posts", handler)
+	admin := router.Group("/admin")
+	admin.GET("/users/:id", handler)
+
+	Convey("Routes()", t, func() {
+		Convey("Should return the handled routes sorted by path and method", func() {
+			admin.Describe("GET", "/users/:id", RouteMeta{Summary: "Get a user"})
+			So(router.Routes(), ShouldResemble, []Route{
+				{Method: "GET", Path: "/admin/users/:id", RouteMeta: RouteMeta{Summary: "Get a user"}},
+				{Method: "GET", Path: "/posts"},
+				{Method: "POST", Path: "/posts"},
+			})
+		})
+
+		Convey("Should only return a group's routes", func() {
+			So(admin.Routes(), ShouldHaveLength, 1)
+		})
+
+		Convey("Should write the routes when the aegis CLI asks for them", func() {
+			So(writeRoutesFile(router), ShouldBeFalse)
+
+			f, err := ioutil.TempFile("", "aegis_routes_test")
+			So(err, ShouldBeNil)
+			f.Close()
+			defer os.Remove(f.Name())
+			os.Setenv(RoutesFileEnvVar, f.Name())
+			defer os.Unsetenv(RoutesFileEnvVar)
+
+			So(writeCLIFiles(router), ShouldBeTrue)
+			b, _ := ioutil.ReadFile(f.Name())
+			So(string(b), ShouldEqual, `[{"method":"GET","path":"/admin/users/:id"},{"method":"GET","path":"/posts"},{"method":"POST","path":"/posts"}]`)
+		})
+
+		Convey("Should panic when describing a route that isn't handled", func() {
+			So(func() { router.Describe("PUT", "/posts", RouteMeta{}) }, ShouldPanic)
+			So(func() { router.Describe("GET", "/nope", RouteMeta{}) }, ShouldPanic)
+		})
+	})
+}
@@ -35,13 +35,25 @@ type RPCRouter struct {
 // RPCHandler is similar to and other router/handler but it returns a map[string]interface{} in addition to an error
 type RPCHandler func(context.Context, *HandlerDependencies, map[string]interface{}) (map[string]interface{}, error)
 
+func init() {
+	// Much like tasks, remote procedure calls are named with an `_rpcName` key
+	RegisterEventType(EventType{
+		Name:     "AegisRPC",
+		Priority: 600,
+		Detect: func(evt map[string]interface{}) bool {
+			return keyInMap("_rpcName", evt)
+		},
+		Handled: func(h *Handlers) bool {
+			return h.RPCRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.RPCRouter.LambdaHandler(ctx, d, evt.(map[string]interface{}))
+		},
+	})
+}
+
 // LambdaHandler is a native AWS Lambda Go handler function. Handles a remote procedure call (invocation via SDK with a special event format).
 func (r *RPCRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt map[string]interface{}) (map[string]interface{}, error) {
-	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
-	if r.Tracer != nil {
-		d.Tracer = r.Tracer
-	}
-
 	var err error
 	var response map[string]interface{}
 	// If an incoming event can be matched to this router, but the router has no registered handlers
@@ -50,6 +62,11 @@ func (r *RPCRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, e
 		return response, errors.New("no handlers registered for RPCRouter")
 	}
 
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
 	handled := false
 	procedureName := ""
 	if name, ok := evt["_rpcName"]; ok {
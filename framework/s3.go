@@ -41,18 +41,43 @@ type S3ObjectHandler struct {
 	// Key     string <-- not needed, the router's handlers map has the key match in its keys
 }
 
+func init() {
+	// S3 events have "Records" with an "s3" key
+	RegisterEventType(EventType{
+		Name:     "S3Event",
+		Priority: 200,
+		Detect: func(evt map[string]interface{}) bool {
+			record := firstRecord(evt)
+			return record != nil && keyInMap("s3", record)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e S3Event
+			// Event time format: 2018-04-02T17:09:32.273Z (handled by the default DecodeEvent() hook)
+			err := DecodeEvent(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.S3ObjectRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return nil, h.S3ObjectRouter.LambdaHandler(ctx, d, evt.(S3Event))
+		},
+	})
+}
+
 // LambdaHandler handles S3 events.
 func (r *S3ObjectRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt S3Event) error {
-	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
-	if r.Tracer != nil {
-		d.Tracer = r.Tracer
-	}
-
 	// If an incoming event can be matched to this router, but the router has no registered handlers
 	// or if one hasn't been added to aegis.Handlers{}.
 	if r == nil {
 		return errors.New("no handlers registered for S3ObjectRouter")
 	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
 	var err error
 	handled := false
 
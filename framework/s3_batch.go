@@ -0,0 +1,280 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	// S3BatchResultSucceeded is the result code for tasks that succeeded
+	S3BatchResultSucceeded = "Succeeded"
+	// S3BatchResultTemporaryFailure is the result code for tasks that failed, but should be retried
+	S3BatchResultTemporaryFailure = "TemporaryFailure"
+	// S3BatchResultPermanentFailure is the result code for tasks that failed and should not be retried
+	S3BatchResultPermanentFailure = "PermanentFailure"
+	// S3BatchEventName is the event name of the S3Event passed to S3Event handlers registered with HandleS3Event()
+	S3BatchEventName = "aws:s3batch"
+)
+
+// The AWS Lambda events package (at the version used) has no S3 Batch Operations types, so they are defined here.
+// https://docs.aws.amazon.com/AmazonS3/latest/dev/batch-ops-invoke-lambda.html
+
+// S3BatchJobEvent is an S3 Batch Operations invocation of a Lambda function
+type S3BatchJobEvent struct {
+	InvocationSchemaVersion string           `json:"invocationSchemaVersion"`
+	InvocationID            string           `json:"invocationId"`
+	Job                     S3BatchJob       `json:"job"`
+	Tasks                   []S3BatchJobTask `json:"tasks"`
+}
+
+// S3BatchJob is the job the invocation is for, UserArguments are only sent with invocation schema version 2.0
+type S3BatchJob struct {
+	ID            string            `json:"id"`
+	UserArguments map[string]string `json:"userArguments,omitempty"`
+}
+
+// S3BatchJobTask is a single object to process. S3BucketArn is sent with invocation schema version 1.0 and S3Bucket with 2.0.
+type S3BatchJobTask struct {
+	TaskID      string `json:"taskId"`
+	S3Key       string `json:"s3Key"`
+	S3VersionID string `json:"s3VersionId"`
+	S3BucketArn string `json:"s3BucketArn,omitempty"`
+	S3Bucket    string `json:"s3Bucket,omitempty"`
+}
+
+// S3BatchJobResponse is the response to an S3 Batch Operations invocation, with a result for each task
+type S3BatchJobResponse struct {
+	InvocationSchemaVersion string                 `json:"invocationSchemaVersion"`
+	TreatMissingKeysAs      string                 `json:"treatMissingKeysAs"`
+	InvocationID            string                 `json:"invocationId"`
+	Results                 []S3BatchJobTaskResult `json:"results"`
+}
+
+// S3BatchJobTaskResult is the result of a task. The result string is included in the job's completion report.
+type S3BatchJobTaskResult struct {
+	TaskID       string `json:"taskId"`
+	ResultCode   string `json:"resultCode"`
+	ResultString string `json:"resultString"`
+}
+
+// S3BatchTemporaryFailure is an error that results in a TemporaryFailure result code, S3 will retry the task.
+// Any other error returned by a handler results in a PermanentFailure.
+type S3BatchTemporaryFailure struct {
+	Err error
+}
+
+// Error returns the error message
+func (e S3BatchTemporaryFailure) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e S3BatchTemporaryFailure) Unwrap() error {
+	return e.Err
+}
+
+// S3BatchRouter struct provides an interface to handle S3 Batch Operations invocations (routers can be for a specific bucket or all buckets)
+// https://docs.aws.amazon.com/AmazonS3/latest/dev/batch-ops-invoke-lambda.html
+type S3BatchRouter struct {
+	handlers    []S3BatchHandler
+	rootHandler S3BatchHandler
+	Bucket      string
+	Tracer      TraceStrategy
+}
+
+// S3BatchHandler handles routed tasks. Bucket and Key are glob matches against the task's bucket name and object key.
+// Only one handler handles each task; the first one registered that matches. The handler function returns a result string
+// for the job's completion report.
+type S3BatchHandler struct {
+	Handler func(context.Context, *HandlerDependencies, *S3BatchJobTask) (string, error)
+	Bucket  string
+	Key     string
+}
+
+func init() {
+	// S3 Batch Operations invocations have an "invocationSchemaVersion", a "job" and "tasks"
+	RegisterEventType(EventType{
+		Name:     "S3BatchJobEvent",
+		Priority: 2200,
+		Detect: func(evt map[string]interface{}) bool {
+			return keyInMap("invocationSchemaVersion", evt) && keyInMap("job", evt) && keyInMap("tasks", evt)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e S3BatchJobEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.S3BatchRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.S3BatchRouter.LambdaHandler(ctx, d, evt.(S3BatchJobEvent))
+		},
+	})
+}
+
+// LambdaHandler handles S3 Batch Operations invocations. Each task gets a result; Succeeded if the handler returns no
+// error, TemporaryFailure if it returns an S3BatchTemporaryFailure, otherwise PermanentFailure. Tasks without a matching
+// handler are a PermanentFailure.
+func (r *S3BatchRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt S3BatchJobEvent) (S3BatchJobResponse, error) {
+	res := S3BatchJobResponse{
+		InvocationSchemaVersion: evt.InvocationSchemaVersion,
+		TreatMissingKeysAs:      S3BatchResultPermanentFailure,
+		InvocationID:            evt.InvocationID,
+		Results:                 make([]S3BatchJobTaskResult, 0, len(evt.Tasks)),
+	}
+
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return res, errors.New("no handlers registered for S3BatchRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	for i := range evt.Tasks {
+		task := evt.Tasks[i]
+		result := S3BatchJobTaskResult{TaskID: task.TaskID, ResultCode: S3BatchResultSucceeded}
+
+		resultString, err := r.handleTask(ctx, d, &task)
+		result.ResultString = resultString
+		if err != nil {
+			result.ResultCode = S3BatchResultPermanentFailure
+			var temporary S3BatchTemporaryFailure
+			if errors.As(err, &temporary) {
+				result.ResultCode = S3BatchResultTemporaryFailure
+			}
+			if result.ResultString == "" {
+				result.ResultString = err.Error()
+			}
+		}
+		res.Results = append(res.Results, result)
+	}
+
+	return res, nil
+}
+
+// handleTask calls the first handler matching the task, or the fallthrough handler if none match
+func (r *S3BatchRouter) handleTask(ctx context.Context, d *HandlerDependencies, task *S3BatchJobTask) (string, error) {
+	bucket := task.BucketName()
+	// If a bucket was defined for the router, tasks for other buckets are not handled
+	if r.Bucket != "" && r.Bucket != bucket {
+		return "", errors.New("no handler for bucket " + bucket)
+	}
+
+	handler := r.rootHandler
+	fallthroughHandler := true
+	for _, h := range r.handlers {
+		if globMatch(h.Bucket, bucket) && globMatch(h.Key, task.S3Key) {
+			handler = h
+			fallthroughHandler = false
+			break
+		}
+	}
+	if handler.Handler == nil {
+		return "", errors.New("no handler for " + bucket + "/" + task.S3Key)
+	}
+
+	d.Tracer.Record("annotation",
+		map[string]interface{}{
+			"S3Bucket":           bucket,
+			"S3ObjectKey":        task.S3Key,
+			"S3BatchTaskID":      task.TaskID,
+			"FallthroughHandler": fallthroughHandler,
+		},
+	)
+	var resultString string
+	err := d.Tracer.Capture(ctx, "S3BatchHandler", func(ctx1 context.Context) error {
+		var err error
+		resultString, err = handler.Handler(ctx1, d, task)
+		return err
+	})
+	return resultString, err
+}
+
+// Listen will start an S3 Batch Operations event listener that handles incoming tasks
+func (r *S3BatchRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewS3BatchRouter simply returns a new S3BatchRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewS3BatchRouter(rootHandler ...func(context.Context, *HandlerDependencies, *S3BatchJobTask) (string, error)) *S3BatchRouter {
+	r := &S3BatchRouter{}
+	if len(rootHandler) > 0 {
+		r.rootHandler = S3BatchHandler{
+			Handler: rootHandler[0],
+		}
+	}
+	return r
+}
+
+// NewS3BatchRouterForBucket is the same as NewS3BatchRouter except it's for a specific bucket (you could also set the Bucket field after using the other function)
+func NewS3BatchRouterForBucket(bucket string, rootHandler ...func(context.Context, *HandlerDependencies, *S3BatchJobTask) (string, error)) *S3BatchRouter {
+	r := NewS3BatchRouter(rootHandler...)
+	// Just convenience
+	r.Bucket = bucket
+	return r
+}
+
+// Handle will register a handler for a given bucket and object key glob match. An empty string for either will match anything.
+func (r *S3BatchRouter) Handle(bucket string, keyMatch string, handler func(context.Context, *HandlerDependencies, *S3BatchJobTask) (string, error)) {
+	r.handlers = append(r.handlers, S3BatchHandler{
+		Handler: handler,
+		Bucket:  bucket,
+		Key:     keyMatch,
+	})
+}
+
+// HandleS3Event will register a handler written for S3ObjectRouter, so the same code can process existing objects.
+// The handler receives an S3Event with a single record for the task's object, with an event name of S3BatchEventName.
+func (r *S3BatchRouter) HandleS3Event(bucket string, keyMatch string, handler func(context.Context, *HandlerDependencies, *S3Event) error) {
+	r.Handle(bucket, keyMatch, func(ctx context.Context, d *HandlerDependencies, task *S3BatchJobTask) (string, error) {
+		evt := task.S3Event()
+		return "", handler(ctx, d, &evt)
+	})
+}
+
+// BucketName returns the name of the task's bucket
+func (t *S3BatchJobTask) BucketName() string {
+	if t.S3Bucket != "" {
+		return t.S3Bucket
+	}
+	return strings.TrimPrefix(t.S3BucketArn, "arn:aws:s3:::")
+}
+
+// S3Event returns an S3Event with a single record for the task's object, the event name is S3BatchEventName
+func (t *S3BatchJobTask) S3Event() S3Event {
+	record := events.S3EventRecord{
+		EventSource: "aws:s3",
+		EventName:   S3BatchEventName,
+	}
+	record.S3.Bucket.Name = t.BucketName()
+	record.S3.Bucket.Arn = t.S3BucketArn
+	if record.S3.Bucket.Arn == "" {
+		record.S3.Bucket.Arn = "arn:aws:s3:::" + record.S3.Bucket.Name
+	}
+	record.S3.Object.Key = t.S3Key
+	record.S3.Object.VersionID = t.S3VersionID
+	return S3Event{Records: []events.S3EventRecord{record}}
+}
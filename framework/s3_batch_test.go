@@ -0,0 +1,124 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestS3BatchRouter(t *testing.T) {
+	newEvent := func(keys ...string) S3BatchJobEvent {
+		evt := S3BatchJobEvent{InvocationSchemaVersion: "1.0", InvocationID: "invocation", Job: S3BatchJob{ID: "job"}}
+		for i, k := range keys {
+			evt.Tasks = append(evt.Tasks, S3BatchJobTask{
+				TaskID:      fmt.Sprintf("task%d", i),
+				S3Key:       k,
+				S3VersionID: "1",
+				S3BucketArn: "arn:aws:s3:::photos",
+			})
+		}
+		return evt
+	}
+
+	var handled []string
+	router := NewS3BatchRouter()
+	router.Tracer = &errorTraceStrategy{}
+	router.Handle("", "throttled/*", func(ctx context.Context, d *HandlerDependencies, task *S3BatchJobTask) (string, error) {
+		return "", S3BatchTemporaryFailure{Err: errors.New("slow down")}
+	})
+	router.Handle("photos", "*.jpg", func(ctx context.Context, d *HandlerDependencies, task *S3BatchJobTask) (string, error) {
+		return "resized " + task.S3Key, nil
+	})
+	router.HandleS3Event("photo*", "*.png", func(ctx context.Context, d *HandlerDependencies, evt *S3Event) error {
+		handled = append(handled, evt.Records[0].S3.Bucket.Name+"/"+evt.Records[0].S3.Object.Key)
+		return errors.New("png is not supported")
+	})
+
+	Convey("S3BatchRouter", t, func() {
+		Convey("Should build a result for each task", func() {
+			handled = []string{}
+			res, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent("a.jpg", "throttled/b.jpg", "c.png", "d.txt"))
+			So(err, ShouldBeNil)
+			So(res.InvocationSchemaVersion, ShouldEqual, "1.0")
+			So(res.InvocationID, ShouldEqual, "invocation")
+			So(res.TreatMissingKeysAs, ShouldEqual, S3BatchResultPermanentFailure)
+			So(res.Results, ShouldHaveLength, 4)
+
+			So(res.Results[0], ShouldResemble, S3BatchJobTaskResult{TaskID: "task0", ResultCode: S3BatchResultSucceeded, ResultString: "resized a.jpg"})
+			// The first matching handler is used, even though "*.jpg" would also match
+			So(res.Results[1], ShouldResemble, S3BatchJobTaskResult{TaskID: "task1", ResultCode: S3BatchResultTemporaryFailure, ResultString: "slow down"})
+			So(res.Results[2], ShouldResemble, S3BatchJobTaskResult{TaskID: "task2", ResultCode: S3BatchResultPermanentFailure, ResultString: "png is not supported"})
+			So(res.Results[3].ResultCode, ShouldEqual, S3BatchResultPermanentFailure)
+			So(handled, ShouldResemble, []string{"photos/c.png"})
+		})
+
+		Convey("Should use the root handler and the router's bucket", func() {
+			r := NewS3BatchRouterForBucket("photos", func(ctx context.Context, d *HandlerDependencies, task *S3BatchJobTask) (string, error) {
+				return "", fmt.Errorf("wrapped: %w", S3BatchTemporaryFailure{Err: errors.New("busy")})
+			})
+			r.Tracer = &errorTraceStrategy{}
+			evt := newEvent("a.txt")
+			evt.Tasks = append(evt.Tasks, S3BatchJobTask{TaskID: "other", S3Key: "a.txt", S3Bucket: "other"})
+			res, err := r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(err, ShouldBeNil)
+			So(res.Results[0].ResultCode, ShouldEqual, S3BatchResultTemporaryFailure)
+			So(res.Results[0].ResultString, ShouldEqual, "wrapped: busy")
+			So(res.Results[1].ResultCode, ShouldEqual, S3BatchResultPermanentFailure)
+		})
+
+		Convey("Should build an S3Event for a task", func() {
+			task := S3BatchJobTask{S3Key: "a.jpg", S3VersionID: "2", S3Bucket: "photos"}
+			So(task.BucketName(), ShouldEqual, "photos")
+			evt := task.S3Event()
+			So(evt.Records, ShouldHaveLength, 1)
+			So(evt.Records[0].EventName, ShouldEqual, S3BatchEventName)
+			So(evt.Records[0].S3.Bucket.Arn, ShouldEqual, "arn:aws:s3:::photos")
+			So(evt.Records[0].S3.Object.VersionID, ShouldEqual, "2")
+		})
+	})
+
+	Convey("Handlers should detect and decode S3 Batch Operations events", t, func() {
+		evt := map[string]interface{}{
+			"invocationSchemaVersion": "1.0",
+			"invocationId":            "YXNkbGZqYWRmaiBhc2RmdW9hZHNmZGpmaGFzbGtkaGZza2RmaAo",
+			"job": map[string]interface{}{
+				"id": "f3cc4f60-61f6-4a2b-8a21-d07600c373ce",
+			},
+			"tasks": []interface{}{
+				map[string]interface{}{
+					"taskId":      "dGFza2lkZ29lc2hlcmUK",
+					"s3Key":       "customerImage1.jpg",
+					"s3VersionId": "1",
+					"s3BucketArn": "arn:aws:s3:::photos",
+				},
+			},
+		}
+		So(getType(evt), ShouldEqual, "S3BatchJobEvent")
+
+		h := Handlers{S3BatchRouter: router}
+		res, err := h.eventHandler(context.Background(), &HandlerDependencies{}, evt)
+		So(err, ShouldBeNil)
+
+		b, _ := json.Marshal(res)
+		So(string(b), ShouldEqual, `{"invocationSchemaVersion":"1.0","treatMissingKeysAs":"PermanentFailure","invocationId":"YXNkbGZqYWRmaiBhc2RmdW9hZHNmZGpmaGFzbGtkaGZza2RmaAo",`+
+			`"results":[{"taskId":"dGFza2lkZ29lc2hlcmUK","resultCode":"Succeeded","resultString":"resized customerImage1.jpg"}]}`)
+	})
+}
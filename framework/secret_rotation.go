@@ -0,0 +1,390 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+const (
+	// SecretRotationStepCreate is the step that creates the new version of the secret, labeled AWSPENDING
+	SecretRotationStepCreate = "createSecret"
+	// SecretRotationStepSet is the step that sets the pending secret in the database or service
+	SecretRotationStepSet = "setSecret"
+	// SecretRotationStepTest is the step that tests the pending secret against the database or service
+	SecretRotationStepTest = "testSecret"
+	// SecretRotationStepFinish is the step that moves the AWSCURRENT label to the new version
+	SecretRotationStepFinish = "finishSecret"
+
+	// SecretVersionStageCurrent labels the current version of a secret
+	SecretVersionStageCurrent = "AWSCURRENT"
+	// SecretVersionStagePending labels the version of a secret being rotated in
+	SecretVersionStagePending = "AWSPENDING"
+	// SecretVersionStagePrevious labels the last version of a secret
+	SecretVersionStagePrevious = "AWSPREVIOUS"
+)
+
+// ErrSecretVersionNotFound is returned when a version of a secret with a given stage does not exist
+var ErrSecretVersionNotFound = errors.New("secret version not found")
+
+// The AWS Lambda events package (at the version used) has no Secrets Manager rotation event type, so it is defined here.
+// https://docs.aws.amazon.com/secretsmanager/latest/userguide/rotating-secrets-lambda-function-overview.html
+
+// SecretRotationEvent is a Secrets Manager rotation step invocation. The client request token is the new version's ID.
+type SecretRotationEvent struct {
+	Step               string `json:"Step"`
+	SecretID           string `json:"SecretId"`
+	ClientRequestToken string `json:"ClientRequestToken"`
+}
+
+// SecretRotation is passed to rotation handlers, it has the event and helpers for the version stage bookkeeping
+type SecretRotation struct {
+	SecretRotationEvent
+	SecretsManager secretsmanageriface.SecretsManagerAPI
+}
+
+// SecretRotationRouter struct provides an interface to handle Secrets Manager rotation steps by secret ARN or name
+// https://docs.aws.amazon.com/secretsmanager/latest/userguide/rotating-secrets.html
+type SecretRotationRouter struct {
+	handlers    []SecretRotationHandler
+	rootHandler SecretRotationHandler
+	// SecretsManager is the client used by the router and the helpers, one is created from the AWS session if not set
+	SecretsManager secretsmanageriface.SecretsManagerAPI
+	Tracer         TraceStrategy
+}
+
+// SecretRotationHandler handles routed rotation steps. Step is the rotation step, an empty string handles all steps.
+// Secret is a glob match against the secret's ARN and name.
+type SecretRotationHandler struct {
+	Handler func(context.Context, *HandlerDependencies, *SecretRotation) error
+	Step    string
+	Secret  string
+}
+
+func init() {
+	// Rotation events have a "Step", "SecretId" and "ClientRequestToken"
+	RegisterEventType(EventType{
+		Name:     "SecretRotationEvent",
+		Priority: 2300,
+		Detect: func(evt map[string]interface{}) bool {
+			return keyInMap("Step", evt) && keyInMap("SecretId", evt) && keyInMap("ClientRequestToken", evt)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e SecretRotationEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.SecretRotationRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return nil, h.SecretRotationRouter.LambdaHandler(ctx, d, evt.(SecretRotationEvent))
+		},
+	})
+}
+
+// LambdaHandler handles Secrets Manager rotation steps. Before calling a handler, the router checks that rotation is
+// enabled and the version being rotated in is labeled AWSPENDING. If the version is already AWSCURRENT, the step is
+// skipped (Secrets Manager retries steps). Without a finishSecret handler, the router finishes the rotation itself.
+func (r *SecretRotationRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt SecretRotationEvent) error {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return errors.New("no handlers registered for SecretRotationRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	if r.SecretsManager == nil {
+		sess, err := session.NewSession()
+		if err != nil {
+			return err
+		}
+		r.SecretsManager = secretsmanager.New(sess)
+	}
+
+	rotation := &SecretRotation{SecretRotationEvent: evt, SecretsManager: r.SecretsManager}
+	current, err := rotation.validate(ctx)
+	if err != nil || current {
+		return err
+	}
+
+	handler, fallthroughHandler := r.handler(&evt)
+	if handler.Handler == nil {
+		if evt.Step == SecretRotationStepFinish {
+			return rotation.Finish(ctx)
+		}
+		return fmt.Errorf("no handler for %s step of secret %s", evt.Step, evt.SecretID)
+	}
+
+	d.Tracer.Record("annotation",
+		map[string]interface{}{
+			"SecretRotationStep": evt.Step,
+			"SecretID":           evt.SecretID,
+			"FallthroughHandler": fallthroughHandler,
+		},
+	)
+	return d.Tracer.Capture(ctx, "SecretRotationHandler", func(ctx1 context.Context) error {
+		return handler.Handler(ctx1, d, rotation)
+	})
+}
+
+// handler returns the first handler matching the event's step and secret, or the root handler (true if so)
+func (r *SecretRotationRouter) handler(evt *SecretRotationEvent) (SecretRotationHandler, bool) {
+	name := GetSecretNameFromARN(evt.SecretID)
+	for _, h := range r.handlers {
+		if h.Step != "" && h.Step != evt.Step {
+			continue
+		}
+		if globMatch(h.Secret, evt.SecretID) || globMatch(h.Secret, name) {
+			return h, false
+		}
+	}
+	return r.rootHandler, true
+}
+
+// Listen will start a Secrets Manager rotation event listener that handles incoming rotation steps
+func (r *SecretRotationRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewSecretRotationRouter simply returns a new SecretRotationRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewSecretRotationRouter(rootHandler ...func(context.Context, *HandlerDependencies, *SecretRotation) error) *SecretRotationRouter {
+	r := &SecretRotationRouter{}
+	if len(rootHandler) > 0 {
+		r.rootHandler = SecretRotationHandler{
+			Handler: rootHandler[0],
+		}
+	}
+	return r
+}
+
+// Handle will register a handler for a given rotation step and secret ARN or name glob match. An empty string for either will match anything.
+func (r *SecretRotationRouter) Handle(step string, secretMatch string, handler func(context.Context, *HandlerDependencies, *SecretRotation) error) {
+	r.handlers = append(r.handlers, SecretRotationHandler{
+		Handler: handler,
+		Step:    step,
+		Secret:  secretMatch,
+	})
+}
+
+// CreateSecret is the same as Handle only the createSecret step is already implied.
+func (r *SecretRotationRouter) CreateSecret(secretMatch string, handler func(context.Context, *HandlerDependencies, *SecretRotation) error) {
+	r.Handle(SecretRotationStepCreate, secretMatch, handler)
+}
+
+// SetSecret is the same as Handle only the setSecret step is already implied.
+func (r *SecretRotationRouter) SetSecret(secretMatch string, handler func(context.Context, *HandlerDependencies, *SecretRotation) error) {
+	r.Handle(SecretRotationStepSet, secretMatch, handler)
+}
+
+// TestSecret is the same as Handle only the testSecret step is already implied.
+func (r *SecretRotationRouter) TestSecret(secretMatch string, handler func(context.Context, *HandlerDependencies, *SecretRotation) error) {
+	r.Handle(SecretRotationStepTest, secretMatch, handler)
+}
+
+// FinishSecret is the same as Handle only the finishSecret step is already implied.
+func (r *SecretRotationRouter) FinishSecret(secretMatch string, handler func(context.Context, *HandlerDependencies, *SecretRotation) error) {
+	r.Handle(SecretRotationStepFinish, secretMatch, handler)
+}
+
+// GetSecretNameFromARN will get the secret name given a secret ARN string, without the random suffix Secrets Manager adds
+// ie. arn:aws:secretsmanager:us-east-1:123456789012:secret:prod/db-AbCdEf
+func GetSecretNameFromARN(arn string) string {
+	p := strings.SplitN(arn, ":secret:", 2)
+	if len(p) < 2 {
+		return arn
+	}
+	name := p[1]
+	if i := strings.LastIndex(name, "-"); i > 0 && len(name)-i == 7 {
+		name = name[:i]
+	}
+	return name
+}
+
+// validate checks the version being rotated in, returning true if it is already the current version
+func (s *SecretRotation) validate(ctx context.Context) (bool, error) {
+	out, err := s.SecretsManager.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(s.SecretID),
+	})
+	if err != nil {
+		return false, err
+	}
+	if !aws.BoolValue(out.RotationEnabled) {
+		return false, fmt.Errorf("secret %s is not enabled for rotation", s.SecretID)
+	}
+	stages, ok := out.VersionIdsToStages[s.ClientRequestToken]
+	if !ok {
+		return false, fmt.Errorf("secret version %s has no stage for rotation of secret %s", s.ClientRequestToken, s.SecretID)
+	}
+	if hasSecretVersionStage(stages, SecretVersionStageCurrent) {
+		return true, nil
+	}
+	if !hasSecretVersionStage(stages, SecretVersionStagePending) {
+		return false, fmt.Errorf("secret version %s not set as AWSPENDING for rotation of secret %s", s.ClientRequestToken, s.SecretID)
+	}
+	return false, nil
+}
+
+// hasSecretVersionStage returns true if the stages include the given stage
+func hasSecretVersionStage(stages []*string, stage string) bool {
+	for _, s := range stages {
+		if aws.StringValue(s) == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentValue returns the secret string of the AWSCURRENT version
+func (s *SecretRotation) CurrentValue(ctx context.Context) (string, error) {
+	return s.value(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(s.SecretID),
+		VersionStage: aws.String(SecretVersionStageCurrent),
+	})
+}
+
+// PendingValue returns the secret string of the AWSPENDING version being rotated in,
+// ErrSecretVersionNotFound is returned if it hasn't been put yet (in the createSecret step)
+func (s *SecretRotation) PendingValue(ctx context.Context) (string, error) {
+	return s.value(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(s.SecretID),
+		VersionId:    aws.String(s.ClientRequestToken),
+		VersionStage: aws.String(SecretVersionStagePending),
+	})
+}
+
+// value gets a secret string, returning ErrSecretVersionNotFound if there is no such version
+func (s *SecretRotation) value(ctx context.Context, input *secretsmanager.GetSecretValueInput) (string, error) {
+	out, err := s.SecretsManager.GetSecretValueWithContext(ctx, input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+			return "", ErrSecretVersionNotFound
+		}
+		return "", err
+	}
+	return aws.StringValue(out.SecretString), nil
+}
+
+// UnmarshalCurrentValue will decode the AWSCURRENT version's secret string as JSON into v
+func (s *SecretRotation) UnmarshalCurrentValue(ctx context.Context, v interface{}) error {
+	val, err := s.CurrentValue(ctx)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(val), v)
+}
+
+// UnmarshalPendingValue will decode the AWSPENDING version's secret string as JSON into v
+func (s *SecretRotation) UnmarshalPendingValue(ctx context.Context, v interface{}) error {
+	val, err := s.PendingValue(ctx)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(val), v)
+}
+
+// PutPendingValue will put the new version of the secret, labeled AWSPENDING, using the client request token as the
+// version ID. If the pending version already exists (the step is being retried), it is left as is.
+func (s *SecretRotation) PutPendingValue(ctx context.Context, value string) error {
+	_, err := s.PendingValue(ctx)
+	if err != ErrSecretVersionNotFound {
+		return err
+	}
+	_, err = s.SecretsManager.PutSecretValueWithContext(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:           aws.String(s.SecretID),
+		ClientRequestToken: aws.String(s.ClientRequestToken),
+		SecretString:       aws.String(value),
+		VersionStages:      []*string{aws.String(SecretVersionStagePending)},
+	})
+	return err
+}
+
+// PutPendingJSON is the same as PutPendingValue except v is marshaled as JSON for the secret string
+func (s *SecretRotation) PutPendingJSON(ctx context.Context, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.PutPendingValue(ctx, string(b))
+}
+
+// RandomPassword returns a random password of the given length from Secrets Manager, excluding the given characters
+func (s *SecretRotation) RandomPassword(ctx context.Context, length int64, excludeCharacters string) (string, error) {
+	input := &secretsmanager.GetRandomPasswordInput{
+		PasswordLength: aws.Int64(length),
+	}
+	if excludeCharacters != "" {
+		input.ExcludeCharacters = aws.String(excludeCharacters)
+	}
+	out, err := s.SecretsManager.GetRandomPasswordWithContext(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.RandomPassword), nil
+}
+
+// Finish moves the AWSCURRENT label to the version being rotated in (the previous version becomes AWSPREVIOUS)
+// and removes its AWSPENDING label. The router does this for the finishSecret step when there is no handler for it.
+func (s *SecretRotation) Finish(ctx context.Context) error {
+	out, err := s.SecretsManager.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(s.SecretID),
+	})
+	if err != nil {
+		return err
+	}
+	currentVersion := ""
+	for version, stages := range out.VersionIdsToStages {
+		if hasSecretVersionStage(stages, SecretVersionStageCurrent) {
+			currentVersion = version
+			break
+		}
+	}
+
+	if currentVersion != s.ClientRequestToken {
+		input := &secretsmanager.UpdateSecretVersionStageInput{
+			SecretId:        aws.String(s.SecretID),
+			VersionStage:    aws.String(SecretVersionStageCurrent),
+			MoveToVersionId: aws.String(s.ClientRequestToken),
+		}
+		if currentVersion != "" {
+			input.RemoveFromVersionId = aws.String(currentVersion)
+		}
+		if _, err := s.SecretsManager.UpdateSecretVersionStageWithContext(ctx, input); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.SecretsManager.UpdateSecretVersionStageWithContext(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            aws.String(s.SecretID),
+		VersionStage:        aws.String(SecretVersionStagePending),
+		RemoveFromVersionId: aws.String(s.ClientRequestToken),
+	})
+	return err
+}
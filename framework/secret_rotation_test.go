@@ -0,0 +1,191 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mockSecretsManager keeps versions of a single secret in memory
+type mockSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	rotationEnabled bool
+	values          map[string]string
+	stages          map[string][]*string
+}
+
+func (m *mockSecretsManager) DescribeSecretWithContext(ctx aws.Context, input *secretsmanager.DescribeSecretInput, opts ...request.Option) (*secretsmanager.DescribeSecretOutput, error) {
+	return &secretsmanager.DescribeSecretOutput{
+		ARN:                input.SecretId,
+		RotationEnabled:    aws.Bool(m.rotationEnabled),
+		VersionIdsToStages: m.stages,
+	}, nil
+}
+
+func (m *mockSecretsManager) GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	for version, stages := range m.stages {
+		if input.VersionId != nil && *input.VersionId != version {
+			continue
+		}
+		if v, ok := m.values[version]; ok && hasSecretVersionStage(stages, aws.StringValue(input.VersionStage)) {
+			return &secretsmanager.GetSecretValueOutput{VersionId: aws.String(version), SecretString: aws.String(v)}, nil
+		}
+	}
+	return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil)
+}
+
+func (m *mockSecretsManager) PutSecretValueWithContext(ctx aws.Context, input *secretsmanager.PutSecretValueInput, opts ...request.Option) (*secretsmanager.PutSecretValueOutput, error) {
+	m.values[*input.ClientRequestToken] = *input.SecretString
+	m.stages[*input.ClientRequestToken] = input.VersionStages
+	return &secretsmanager.PutSecretValueOutput{}, nil
+}
+
+func (m *mockSecretsManager) GetRandomPasswordWithContext(ctx aws.Context, input *secretsmanager.GetRandomPasswordInput, opts ...request.Option) (*secretsmanager.GetRandomPasswordOutput, error) {
+	return &secretsmanager.GetRandomPasswordOutput{RandomPassword: aws.String("random")}, nil
+}
+
+func (m *mockSecretsManager) UpdateSecretVersionStageWithContext(ctx aws.Context, input *secretsmanager.UpdateSecretVersionStageInput, opts ...request.Option) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
+	stage := aws.StringValue(input.VersionStage)
+	if input.RemoveFromVersionId != nil {
+		var stages []*string
+		for _, s := range m.stages[*input.RemoveFromVersionId] {
+			if *s != stage {
+				stages = append(stages, s)
+			}
+		}
+		m.stages[*input.RemoveFromVersionId] = stages
+	}
+	if input.MoveToVersionId != nil {
+		m.stages[*input.MoveToVersionId] = append(m.stages[*input.MoveToVersionId], input.VersionStage)
+		if stage == SecretVersionStageCurrent && input.RemoveFromVersionId != nil {
+			m.stages[*input.RemoveFromVersionId] = append(m.stages[*input.RemoveFromVersionId], aws.String(SecretVersionStagePrevious))
+		}
+	}
+	return &secretsmanager.UpdateSecretVersionStageOutput{}, nil
+}
+
+func TestSecretRotationRouter(t *testing.T) {
+	secretARN := "arn:aws:secretsmanager:us-east-1:123456789012:secret:prod/db-AbCdEf"
+	newEvent := func(step string) SecretRotationEvent {
+		return SecretRotationEvent{Step: step, SecretID: secretARN, ClientRequestToken: "v2"}
+	}
+
+	Convey("SecretRotationRouter", t, func() {
+		sm := &mockSecretsManager{
+			rotationEnabled: true,
+			values:          map[string]string{"v1": `{"password":"old"}`},
+			stages: map[string][]*string{
+				"v1": {aws.String(SecretVersionStageCurrent)},
+				"v2": {aws.String(SecretVersionStagePending)},
+			},
+		}
+		steps := []string{}
+		router := NewSecretRotationRouter()
+		router.Tracer = &errorTraceStrategy{}
+		router.SecretsManager = sm
+		router.CreateSecret("prod/*", func(ctx context.Context, d *HandlerDependencies, s *SecretRotation) error {
+			steps = append(steps, s.Step)
+			var current map[string]string
+			if err := s.UnmarshalCurrentValue(ctx, &current); err != nil {
+				return err
+			}
+			password, err := s.RandomPassword(ctx, 32, "/@\"")
+			if err != nil {
+				return err
+			}
+			current["password"] = password
+			return s.PutPendingJSON(ctx, current)
+		})
+		checkPending := func(ctx context.Context, d *HandlerDependencies, s *SecretRotation) error {
+			steps = append(steps, s.Step)
+			_, err := s.PendingValue(ctx)
+			return err
+		}
+		router.SetSecret("arn:aws:secretsmanager:*", checkPending)
+		router.TestSecret("", checkPending)
+
+		Convey("Should rotate a secret through each step", func() {
+			for _, step := range []string{SecretRotationStepCreate, SecretRotationStepSet, SecretRotationStepTest, SecretRotationStepFinish} {
+				So(router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(step)), ShouldBeNil)
+			}
+			// There is no finishSecret handler, so the router finishes the rotation
+			So(steps, ShouldResemble, []string{SecretRotationStepCreate, SecretRotationStepSet, SecretRotationStepTest})
+			So(sm.values["v2"], ShouldEqual, `{"password":"random"}`)
+			So(hasSecretVersionStage(sm.stages["v2"], SecretVersionStageCurrent), ShouldBeTrue)
+			So(hasSecretVersionStage(sm.stages["v2"], SecretVersionStagePending), ShouldBeFalse)
+			So(hasSecretVersionStage(sm.stages["v1"], SecretVersionStagePrevious), ShouldBeTrue)
+			So(hasSecretVersionStage(sm.stages["v1"], SecretVersionStageCurrent), ShouldBeFalse)
+
+			Convey("Should skip steps for a version that is already current", func() {
+				So(router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(SecretRotationStepCreate)), ShouldBeNil)
+				So(steps, ShouldHaveLength, 3)
+			})
+		})
+
+		Convey("Should return an error for a step without a handler", func() {
+			r := NewSecretRotationRouter()
+			r.Tracer = &errorTraceStrategy{}
+			r.SecretsManager = sm
+			So(r.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(SecretRotationStepCreate)), ShouldNotBeNil)
+		})
+
+		Convey("Should return an error if the version is not pending or rotation is not enabled", func() {
+			So(router.LambdaHandler(context.Background(), &HandlerDependencies{}, SecretRotationEvent{Step: SecretRotationStepCreate, SecretID: secretARN, ClientRequestToken: "v3"}), ShouldNotBeNil)
+			sm.rotationEnabled = false
+			So(router.LambdaHandler(context.Background(), &HandlerDependencies{}, newEvent(SecretRotationStepCreate)), ShouldNotBeNil)
+			So(steps, ShouldBeEmpty)
+		})
+
+		Convey("Should return ErrSecretVersionNotFound for a pending value that hasn't been put", func() {
+			s := &SecretRotation{SecretRotationEvent: newEvent(SecretRotationStepSet), SecretsManager: sm}
+			_, err := s.PendingValue(context.Background())
+			So(err, ShouldEqual, ErrSecretVersionNotFound)
+		})
+
+		Convey("Should get the secret name from an ARN", func() {
+			So(GetSecretNameFromARN(secretARN), ShouldEqual, "prod/db")
+			So(GetSecretNameFromARN("prod/db"), ShouldEqual, "prod/db")
+		})
+	})
+
+	Convey("Handlers should detect and decode Secrets Manager rotation events", t, func() {
+		evt := map[string]interface{}{
+			"Step":               "createSecret",
+			"SecretId":           secretARN,
+			"ClientRequestToken": "v2",
+		}
+		So(getType(evt), ShouldEqual, "SecretRotationEvent")
+
+		called := false
+		router := NewSecretRotationRouter(func(ctx context.Context, d *HandlerDependencies, s *SecretRotation) error {
+			called = true
+			return nil
+		})
+		router.Tracer = &errorTraceStrategy{}
+		router.SecretsManager = &mockSecretsManager{rotationEnabled: true, stages: map[string][]*string{"v2": {aws.String(SecretVersionStagePending)}}}
+		h := Handlers{SecretRotationRouter: router}
+		_, err := h.eventHandler(context.Background(), &HandlerDependencies{}, evt)
+		So(err, ShouldBeNil)
+		So(called, ShouldBeTrue)
+	})
+}
@@ -33,18 +33,42 @@ type SESRouter struct {
 // SESHandler handles incoming SES e-mail message events
 type SESHandler func(context.Context, *HandlerDependencies, *SimpleEmailEvent) error
 
+func init() {
+	// Similar to S3 is SES which also has "Records" but instead of "s3" it has "ses"
+	RegisterEventType(EventType{
+		Name:     "SimpleEmailEvent",
+		Priority: 300,
+		Detect: func(evt map[string]interface{}) bool {
+			record := firstRecord(evt)
+			return record != nil && keyInMap("ses", record)
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e SimpleEmailEvent
+			err := DecodeEvent(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.SESRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return nil, h.SESRouter.LambdaHandler(ctx, d, evt.(SimpleEmailEvent))
+		},
+	})
+}
+
 // LambdaHandler handles SES received e-mail events.
 func (r *SESRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt SimpleEmailEvent) error {
-	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
-	if r.Tracer != nil {
-		d.Tracer = r.Tracer
-	}
-
 	// If an incoming event can be matched to this router, but the router has no registered handlers
 	// or if one hasn't been added to aegis.Handlers{}.
 	if r == nil {
 		return errors.New("no handlers registered for SESRouter")
 	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
 	var err error
 	var g glob.Glob
 	handled := false
@@ -0,0 +1,275 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// SNSRouter struct provides an interface to handle SNS notification events (routers can be for a specific topic or all topics)
+// https://docs.aws.amazon.com/lambda/latest/dg/with-sns.html
+type SNSRouter struct {
+	handlers map[string]SNSHandler
+	// handlerKeys are the keys of handlers in the order they were registered, which is the order they're tried in
+	handlerKeys []string
+	Topic       string
+	Tracer      TraceStrategy
+}
+
+// SNSHandler handles routed notifications. Topic is a glob match against either the topic name or ARN, Subject is a glob
+// match against the notification subject and AttributeValue is a glob match against the string value of the AttributeName
+// message attribute. Empty values match anything.
+type SNSHandler struct {
+	Handler        func(context.Context, *HandlerDependencies, *SNSEventRecord) error
+	Topic          string
+	Subject        string
+	AttributeName  string
+	AttributeValue string
+}
+
+func init() {
+	// SNS notifications have "Records" with an EventSource of "aws:sns" (note the capitalization differs from other sources)
+	RegisterEventType(EventType{
+		Name:     "SNSEvent",
+		Priority: 1100,
+		Detect: func(evt map[string]interface{}) bool {
+			record := firstRecord(evt)
+			return record != nil && record["EventSource"] == "aws:sns"
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e SNSEvent
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.SNSRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return nil, h.SNSRouter.LambdaHandler(ctx, d, evt.(SNSEvent))
+		},
+	})
+}
+
+// LambdaHandler handles SNS notification events. SNS currently delivers one notification per invocation,
+// but each record is handled in case that ever changes.
+func (r *SNSRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt SNSEvent) error {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return errors.New("no handlers registered for SNSRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	var err error
+
+	for i := range evt.Records {
+		record := SNSEventRecord(evt.Records[i])
+		topicName := record.TopicName()
+
+		// If there are no handlers registered or the topic doesn't match (if a topic was defined for the router)
+		if r.handlers == nil || (r.Topic != "" && r.Topic != topicName && r.Topic != record.SNS.TopicArn) {
+			continue
+		}
+
+		handled := false
+		for _, k := range r.handlerKeys {
+			handler := r.handlers[k]
+			if k == "_" || !snsHandlerMatch(handler, &record) {
+				continue
+			}
+			handled = true
+			d.Tracer.Record("annotation",
+				map[string]interface{}{
+					"SNSTopic":     topicName,
+					"SNSSubject":   record.SNS.Subject,
+					"SNSMessageID": record.SNS.MessageID,
+				},
+			)
+			err = d.Tracer.Capture(ctx, "SNSHandler", func(ctx1 context.Context) error {
+				return handler.Handler(ctx1, d, &record)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// Otherwise, use the catch all (router "fallthrough" equivalent) handler.
+		// The application can inspect the notification and make a decision on what to do, if anything.
+		// This is optional.
+		if !handled {
+			// It's possible that the SNSRouter wasn't created with NewSNSRouter, so check for this still.
+			if handler, ok := r.handlers["_"]; ok {
+				d.Tracer.Record("annotation",
+					map[string]interface{}{
+						"SNSTopic":           topicName,
+						"SNSSubject":         record.SNS.Subject,
+						"SNSMessageID":       record.SNS.MessageID,
+						"FallthroughHandler": true,
+					},
+				)
+				err = d.Tracer.Capture(ctx, "SNSHandler", func(ctx1 context.Context) error {
+					return handler.Handler(ctx1, d, &record)
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return err
+}
+
+// snsHandlerMatch checks a handler's topic, subject and message attribute globs against a record (empty matches all)
+func snsHandlerMatch(handler SNSHandler, record *SNSEventRecord) bool {
+	if handler.Topic != "" && !globMatch(handler.Topic, record.TopicName()) && !globMatch(handler.Topic, record.SNS.TopicArn) {
+		return false
+	}
+	if !globMatch(handler.Subject, record.SNS.Subject) {
+		return false
+	}
+	if handler.AttributeName != "" {
+		v, ok := record.MessageAttribute(handler.AttributeName)
+		if !ok || !globMatch(handler.AttributeValue, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Listen will start an SNS event listener that handles incoming notifications
+func (r *SNSRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewSNSRouter simply returns a new SNSRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewSNSRouter(rootHandler ...func(context.Context, *HandlerDependencies, *SNSEventRecord) error) *SNSRouter {
+	// The catch all is optional, if not provided, an empty handler is still called and it returns nothing.
+	handler := SNSHandler{
+		Handler: func(context.Context, *HandlerDependencies, *SNSEventRecord) error {
+			return nil
+		},
+	}
+	if len(rootHandler) > 0 {
+		handler = SNSHandler{
+			Handler: rootHandler[0],
+		}
+	}
+	return &SNSRouter{
+		handlers: map[string]SNSHandler{
+			"_": handler,
+		},
+	}
+}
+
+// NewSNSRouterForTopic is the same as NewSNSRouter except it's for a specific topic name or ARN (you could also set the Topic field after using the other function)
+func NewSNSRouterForTopic(topic string, rootHandler ...func(context.Context, *HandlerDependencies, *SNSEventRecord) error) *SNSRouter {
+	r := NewSNSRouter(rootHandler...)
+	// Just convenience
+	r.Topic = topic
+	return r
+}
+
+// Handle will register a handler for a given topic name or ARN and subject glob match.
+// An empty string for either will match any topic or subject.
+func (r *SNSRouter) Handle(topic string, subject string, handler func(context.Context, *HandlerDependencies, *SNSEventRecord) error) {
+	r.addHandler(SNSHandler{
+		Handler: handler,
+		Topic:   topic,
+		Subject: subject,
+	})
+}
+
+// HandleAttribute will register a handler for a given topic name or ARN and a message attribute value glob match.
+func (r *SNSRouter) HandleAttribute(topic string, attrName string, attrValue string, handler func(context.Context, *HandlerDependencies, *SNSEventRecord) error) {
+	r.addHandler(SNSHandler{
+		Handler:        handler,
+		Topic:          topic,
+		AttributeName:  attrName,
+		AttributeValue: attrValue,
+	})
+}
+
+// addHandler registers an SNSHandler keyed by its matching rules
+func (r *SNSRouter) addHandler(h SNSHandler) {
+	if r.handlers == nil {
+		r.handlers = make(map[string]SNSHandler)
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(h.Topic)
+	buffer.WriteString(":")
+	buffer.WriteString(h.Subject)
+	buffer.WriteString(":")
+	buffer.WriteString(h.AttributeName)
+	buffer.WriteString(":")
+	buffer.WriteString(h.AttributeValue)
+	k := buffer.String()
+	buffer.Reset()
+	if _, ok := r.handlers[k]; !ok {
+		r.handlerKeys = append(r.handlerKeys, k)
+	}
+	r.handlers[k] = h
+}
+
+// GetTopicNameFromARN will get the SNS topic name given a topic ARN string
+// ie. arn:aws:sns:us-east-1:123456789012:example-topic
+func GetTopicNameFromARN(arn string) string {
+	p := strings.Split(arn, ":")
+	return p[len(p)-1]
+}
+
+// TopicName returns the name of the topic the notification was published to
+func (r *SNSEventRecord) TopicName() string {
+	return GetTopicNameFromARN(r.SNS.TopicArn)
+}
+
+// MessageAttribute returns the string value of a message attribute and false if it does not exist.
+// SNS always provides a string representation of the value, binary values are base64 strings.
+func (r *SNSEventRecord) MessageAttribute(name string) (string, bool) {
+	attr, ok := r.SNS.MessageAttributes[name]
+	if !ok {
+		return "", false
+	}
+	if m, ok := attr.(map[string]interface{}); ok {
+		if v, ok := m["Value"]; ok {
+			return fmt.Sprint(v), true
+		}
+		return "", false
+	}
+	return fmt.Sprint(attr), true
+}
+
+// UnmarshalMessage will decode the notification's message body as JSON into v
+func (r *SNSEventRecord) UnmarshalMessage(v interface{}) error {
+	return json.Unmarshal([]byte(r.SNS.Message), v)
+}
+
+// MessageJSON returns the notification's message body decoded as a JSON object
+func (r *SNSEventRecord) MessageJSON() (map[string]interface{}, error) {
+	var m map[string]interface{}
+	err := r.UnmarshalMessage(&m)
+	return m, err
+}
@@ -0,0 +1,178 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"testing"
+
+	events "github.com/aws/aws-lambda-go/events"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSNSRouter(t *testing.T) {
+
+	// Fake event
+	evt := SNSEvent{
+		Records: []events.SNSEventRecord{
+			{
+				EventSource: "aws:sns",
+				SNS: events.SNSEntity{
+					MessageID: "95df01b4-ee98-5cb9-9903-4c221d41eb5e",
+					TopicArn:  "arn:aws:sns:us-east-1:123456789012:example-topic",
+					Subject:   "order created",
+					Message:   `{"orderId":"123","total":42.5}`,
+					MessageAttributes: map[string]interface{}{
+						"priority": map[string]interface{}{"Type": "String", "Value": "high"},
+					},
+				},
+			},
+		},
+	}
+
+	Convey("NewSNSRouterForTopic()", t, func() {
+
+		Convey("Should create a new SNSRouter for a specific topic", func() {
+			r := NewSNSRouterForTopic("example-topic")
+			So(r, ShouldNotBeNil)
+			So(r.Topic, ShouldEqual, "example-topic")
+		})
+
+		Convey("Should handle any notification with a fall through handler", func() {
+			handled := false
+			r := NewSNSRouterForTopic("arn:aws:sns:us-east-1:123456789012:example-topic", func(ctx context.Context, d *HandlerDependencies, record *SNSEventRecord) error {
+				handled = true
+				return nil
+			})
+			r.Tracer = NoTraceStrategy{}
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(handled, ShouldBeTrue)
+		})
+
+		Convey("Should not handle notifications from other topics", func() {
+			handled := false
+			r := NewSNSRouterForTopic("other-topic", func(ctx context.Context, d *HandlerDependencies, record *SNSEventRecord) error {
+				handled = true
+				return nil
+			})
+			r.Tracer = NoTraceStrategy{}
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(handled, ShouldBeFalse)
+		})
+	})
+
+	Convey("Handle()", t, func() {
+		Convey("Should route notifications by topic and subject", func() {
+			handled := false
+			other := false
+			r := NewSNSRouter()
+			r.Tracer = NoTraceStrategy{}
+			r.Handle("example-*", "order *", func(ctx context.Context, d *HandlerDependencies, record *SNSEventRecord) error {
+				handled = true
+				return nil
+			})
+			r.Handle("", "user *", func(ctx context.Context, d *HandlerDependencies, record *SNSEventRecord) error {
+				other = true
+				return nil
+			})
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(handled, ShouldBeTrue)
+			So(other, ShouldBeFalse)
+		})
+
+		Convey("Should call matching handlers in the order they were added", func() {
+			for i := 0; i < 10; i++ {
+				called := []string{}
+				r := NewSNSRouter()
+				r.Tracer = NoTraceStrategy{}
+				for _, subject := range []string{"order *", "*", "order created"} {
+					subject := subject
+					r.Handle("", subject, func(ctx context.Context, d *HandlerDependencies, record *SNSEventRecord) error {
+						called = append(called, subject)
+						return nil
+					})
+				}
+				r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+				So(called, ShouldResemble, []string{"order *", "*", "order created"})
+			}
+		})
+	})
+
+	Convey("HandleAttribute()", t, func() {
+		Convey("Should route notifications by message attribute value", func() {
+			handled := false
+			r := NewSNSRouter()
+			r.Tracer = NoTraceStrategy{}
+			r.HandleAttribute("arn:aws:sns:*:example-topic", "priority", "high", func(ctx context.Context, d *HandlerDependencies, record *SNSEventRecord) error {
+				handled = true
+				return nil
+			})
+			r.LambdaHandler(context.Background(), &HandlerDependencies{}, evt)
+			So(handled, ShouldBeTrue)
+		})
+	})
+
+	Convey("SNSEventRecord", t, func() {
+		r := SNSEventRecord(evt.Records[0])
+
+		Convey("TopicName() should return the topic name from the ARN", func() {
+			So(r.TopicName(), ShouldEqual, "example-topic")
+		})
+
+		Convey("MessageAttribute() should return attribute values", func() {
+			v, ok := r.MessageAttribute("priority")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, "high")
+			_, ok = r.MessageAttribute("missing")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("MessageJSON() should decode the message body", func() {
+			m, err := r.MessageJSON()
+			So(err, ShouldBeNil)
+			So(m["orderId"], ShouldEqual, "123")
+			So(m["total"], ShouldEqual, 42.5)
+		})
+	})
+
+	Convey("Handlers should detect and decode SNS events", t, func() {
+		So(getType(map[string]interface{}{"Records": []interface{}{
+			map[string]interface{}{"EventSource": "aws:sns"},
+		}}), ShouldEqual, "SNSEvent")
+
+		var subject string
+		router := NewSNSRouter(func(ctx context.Context, d *HandlerDependencies, record *SNSEventRecord) error {
+			subject = record.SNS.Subject
+			return nil
+		})
+		router.Tracer = NoTraceStrategy{}
+		h := Handlers{SNSRouter: router}
+		_, err := h.eventHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+			"Records": []interface{}{
+				map[string]interface{}{
+					"EventSource": "aws:sns",
+					"Sns": map[string]interface{}{
+						"TopicArn":  "arn:aws:sns:us-east-1:123456789012:example-topic",
+						"Subject":   "example subject",
+						"Message":   "example message",
+						"Timestamp": "1970-01-01T00:00:00.000Z",
+					},
+				},
+			},
+		})
+		So(err, ShouldBeNil)
+		So(subject, ShouldEqual, "example subject")
+	})
+}
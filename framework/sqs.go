@@ -37,18 +37,42 @@ type SQSHandler struct {
 	AttributeStrValue string
 }
 
+func init() {
+	// SQS is similar to S3 and SES, it has an eventSource that helps a lot
+	RegisterEventType(EventType{
+		Name:     "SQSEvent",
+		Priority: 400,
+		Detect: func(evt map[string]interface{}) bool {
+			record := firstRecord(evt)
+			return record != nil && record["eventSource"] == "aws:sqs"
+		},
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e SQSEvent
+			err := DecodeEvent(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.SQSRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return nil, h.SQSRouter.LambdaHandler(ctx, d, evt.(SQSEvent))
+		},
+	})
+}
+
 // LambdaHandler handles SQS events.
 func (r *SQSRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt SQSEvent) error {
-	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
-	if r.Tracer != nil {
-		d.Tracer = r.Tracer
-	}
-
 	// If an incoming event can be matched to this router, but the router has no registered handlers
 	// or if one hasn't been added to aegis.Handlers{}.
 	if r == nil {
 		return errors.New("no handlers registered for SQSRouter")
 	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
 	var err error
 	handled := false
 
@@ -0,0 +1,310 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sfn/sfniface"
+)
+
+const (
+	// DefaultStepFunctionsStateField is the event field with the state name, set it in the state's Parameters
+	// ie. "_stateName.$": "$$.State.Name"
+	DefaultStepFunctionsStateField = "_stateName"
+	// StepFunctionsTaskTokenField is the event field with the task token for the .waitForTaskToken callback pattern
+	// ie. "_taskToken.$": "$$.Task.Token"
+	StepFunctionsTaskTokenField = "_taskToken"
+)
+
+// ErrTaskTokenPending can be returned by a handler to leave a task waiting for a callback; the router will not send
+// the task's success or failure. Something else must (ie. after a human approval), using the task token.
+var ErrTaskTokenPending = errors.New("task token pending")
+
+// StepFunctionsTask is a Step Functions task state invocation. Input is the state input, without the state name
+// and task token fields.
+type StepFunctionsTask struct {
+	StateName string
+	TaskToken string
+	Input     map[string]interface{}
+	sfn       sfniface.SFNAPI
+	sent      bool
+}
+
+// StepFunctionsRouter struct provides an interface to handle Step Functions task states by state name
+// https://docs.aws.amazon.com/step-functions/latest/dg/connect-lambda.html
+type StepFunctionsRouter struct {
+	handlers map[string]StepFunctionsHandler
+	// StateField is the event field with the state name, use NewStepFunctionsRouterForStateField() to change it
+	StateField string
+	// HeartbeatInterval, if set, is how often heartbeats are sent for tasks with a task token while the handler runs
+	HeartbeatInterval time.Duration
+	// SFN is the client used to send task results and heartbeats, one is created from the AWS session if not set
+	SFN    sfniface.SFNAPI
+	Tracer TraceStrategy
+}
+
+// StepFunctionsHandler handles routed task states and returns the state output
+type StepFunctionsHandler func(context.Context, *HandlerDependencies, *StepFunctionsTask) (interface{}, error)
+
+func init() {
+	// Like tasks and remote procedure calls, task states are named, but the state machine sets the name
+	RegisterEventType(EventType{
+		Name:     "StepFunctionsTask",
+		Priority: 2500,
+		// The state name field can be changed on the StepFunctionsRouter
+		DetectFor: func(h *Handlers, evt map[string]interface{}) bool {
+			stateField := DefaultStepFunctionsStateField
+			if h != nil && h.StepFunctionsRouter != nil && h.StepFunctionsRouter.StateField != "" {
+				stateField = h.StepFunctionsRouter.StateField
+			}
+			_, ok := evt[stateField].(string)
+			return ok
+		},
+		Handled: func(h *Handlers) bool {
+			return h.StepFunctionsRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.StepFunctionsRouter.LambdaHandler(ctx, d, evt.(map[string]interface{}))
+		},
+	})
+}
+
+// LambdaHandler handles Step Functions task states, returning the handler's output as the state output. Errors are
+// returned as is; Lambda names them after their Go type (see StepFunctionsErrorName), which is what retry and catch
+// clauses match on. If the event has a task token (the .waitForTaskToken pattern), the output or error is also sent
+// to Step Functions, unless the handler already sent it or returned ErrTaskTokenPending.
+func (r *StepFunctionsRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt map[string]interface{}) (interface{}, error) {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return nil, errors.New("no handlers registered for StepFunctionsRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	task := r.newTask(evt)
+	handler, ok := r.handlers[task.StateName]
+	fallthroughHandler := !ok
+	if !ok {
+		// It's possible that the StepFunctionsRouter wasn't created with NewStepFunctionsRouter, so check for this still.
+		if handler, ok = r.handlers["_"]; !ok {
+			return nil, fmt.Errorf("no handler for state %s", task.StateName)
+		}
+	}
+
+	if task.TaskToken != "" && r.SFN == nil {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		r.SFN = sfn.New(sess)
+	}
+	task.sfn = r.SFN
+
+	d.Tracer.Record("annotation",
+		map[string]interface{}{
+			"StepFunctionsState": task.StateName,
+			"FallthroughHandler": fallthroughHandler,
+		},
+	)
+
+	var output interface{}
+	err := d.Tracer.Capture(ctx, "StepFunctionsHandler", func(ctx1 context.Context) error {
+		if task.TaskToken != "" && r.HeartbeatInterval > 0 {
+			stop := task.startHeartbeats(ctx1, r.HeartbeatInterval)
+			defer stop()
+		}
+		var err error
+		output, err = handler(ctx1, d, task)
+		return err
+	})
+
+	if task.TaskToken == "" || task.sent || errors.Is(err, ErrTaskTokenPending) {
+		if errors.Is(err, ErrTaskTokenPending) {
+			err = nil
+		}
+		return output, err
+	}
+	if err != nil {
+		if sendErr := task.SendFailure(ctx, err); sendErr != nil {
+			return nil, sendErr
+		}
+		return nil, err
+	}
+	return output, task.SendSuccess(ctx, output)
+}
+
+// newTask returns the task for an event, the state name and task token fields are removed from the input
+func (r *StepFunctionsRouter) newTask(evt map[string]interface{}) *StepFunctionsTask {
+	stateField := r.StateField
+	if stateField == "" {
+		stateField = DefaultStepFunctionsStateField
+	}
+	task := &StepFunctionsTask{Input: make(map[string]interface{}, len(evt))}
+	for k, v := range evt {
+		switch k {
+		case stateField:
+			task.StateName, _ = v.(string)
+		case StepFunctionsTaskTokenField:
+			task.TaskToken, _ = v.(string)
+		default:
+			task.Input[k] = v
+		}
+	}
+	return task
+}
+
+// Listen will start a Step Functions listener that handles incoming task states
+func (r *StepFunctionsRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewStepFunctionsRouter simply returns a new StepFunctionsRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewStepFunctionsRouter(rootHandler ...StepFunctionsHandler) *StepFunctionsRouter {
+	// The catch all is optional, if not provided, an empty handler is still called and it returns nothing.
+	handler := func(context.Context, *HandlerDependencies, *StepFunctionsTask) (interface{}, error) {
+		return nil, nil
+	}
+	if len(rootHandler) > 0 {
+		handler = rootHandler[0]
+	}
+	return &StepFunctionsRouter{
+		handlers: map[string]StepFunctionsHandler{
+			"_": handler,
+		},
+		StateField: DefaultStepFunctionsStateField,
+	}
+}
+
+// NewStepFunctionsRouterForStateField is the same as NewStepFunctionsRouter except the state name is in the given
+// event field. Handlers with this router will then detect task states by that field instead of the default one.
+func NewStepFunctionsRouterForStateField(stateField string, rootHandler ...StepFunctionsHandler) *StepFunctionsRouter {
+	r := NewStepFunctionsRouter(rootHandler...)
+	r.StateField = stateField
+	return r
+}
+
+// Handle will register a handler for a given state name
+func (r *StepFunctionsRouter) Handle(stateName string, handler StepFunctionsHandler) {
+	if r.handlers == nil {
+		r.handlers = make(map[string]StepFunctionsHandler)
+	}
+	r.handlers[stateName] = handler
+}
+
+// UnmarshalInput will decode the state input into v (using JSON struct tags)
+func (t *StepFunctionsTask) UnmarshalInput(v interface{}) error {
+	return remarshal(t.Input, v)
+}
+
+// SendSuccess sends the task's output to Step Functions (.waitForTaskToken callback pattern)
+func (t *StepFunctionsTask) SendSuccess(ctx context.Context, output interface{}) error {
+	t.sent = true
+	return SendTaskSuccess(ctx, t.sfn, t.TaskToken, output)
+}
+
+// SendFailure sends the task's failure to Step Functions (.waitForTaskToken callback pattern)
+func (t *StepFunctionsTask) SendFailure(ctx context.Context, err error) error {
+	t.sent = true
+	return SendTaskFailure(ctx, t.sfn, t.TaskToken, err)
+}
+
+// SendHeartbeat tells Step Functions the task is still in progress, so it doesn't time out (the state's HeartbeatSeconds)
+func (t *StepFunctionsTask) SendHeartbeat(ctx context.Context) error {
+	return SendTaskHeartbeat(ctx, t.sfn, t.TaskToken)
+}
+
+// startHeartbeats sends a heartbeat at each interval until the returned function is called. Heartbeats stop early if the
+// task has timed out, since the task token is no longer valid then.
+func (t *StepFunctionsTask) startHeartbeats(ctx context.Context, interval time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := t.SendHeartbeat(ctx); err != nil {
+					Log.Errorf("Could not send the Step Functions task heartbeat: %s", err)
+					if aerr, ok := err.(awserr.Error); ok && aerr.Code() == sfn.ErrCodeTaskTimedOut {
+						return
+					}
+				}
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// SendTaskSuccess sends the output for a task token to Step Functions, output is marshaled as JSON
+func SendTaskSuccess(ctx context.Context, svc sfniface.SFNAPI, taskToken string, output interface{}) error {
+	b, err := json.Marshal(output)
+	if err != nil {
+		return err
+	}
+	_, err = svc.SendTaskSuccessWithContext(ctx, &sfn.SendTaskSuccessInput{
+		TaskToken: aws.String(taskToken),
+		Output:    aws.String(string(b)),
+	})
+	return err
+}
+
+// SendTaskFailure sends a failure for a task token to Step Functions. The error name is the same one Lambda would use
+// (see StepFunctionsErrorName), so retry and catch clauses match either way. The cause is the error message.
+func SendTaskFailure(ctx context.Context, svc sfniface.SFNAPI, taskToken string, err error) error {
+	_, sendErr := svc.SendTaskFailureWithContext(ctx, &sfn.SendTaskFailureInput{
+		TaskToken: aws.String(taskToken),
+		Error:     aws.String(StepFunctionsErrorName(err)),
+		Cause:     aws.String(err.Error()),
+	})
+	return sendErr
+}
+
+// SendTaskHeartbeat sends a heartbeat for a task token to Step Functions
+func SendTaskHeartbeat(ctx context.Context, svc sfniface.SFNAPI, taskToken string) error {
+	_, err := svc.SendTaskHeartbeatWithContext(ctx, &sfn.SendTaskHeartbeatInput{
+		TaskToken: aws.String(taskToken),
+	})
+	return err
+}
+
+// StepFunctionsErrorName returns the name of an error as Step Functions sees it, which is what retry and catch clauses
+// (ErrorEquals) match on. Lambda names errors after their Go type, so define an error type for each error a state
+// machine should handle differently, ie. `type CardDeclined struct{...}` is matched with "CardDeclined".
+func StepFunctionsErrorName(err error) string {
+	t := reflect.TypeOf(err)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
@@ -0,0 +1,208 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sfn/sfniface"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mockSFN records the task results and heartbeats sent
+type mockSFN struct {
+	sfniface.SFNAPI
+	mu           sync.Mutex
+	success      *sfn.SendTaskSuccessInput
+	failure      *sfn.SendTaskFailureInput
+	heartbeats   int
+	heartbeatErr error
+}
+
+func (m *mockSFN) SendTaskSuccessWithContext(ctx aws.Context, input *sfn.SendTaskSuccessInput, opts ...request.Option) (*sfn.SendTaskSuccessOutput, error) {
+	m.success = input
+	return &sfn.SendTaskSuccessOutput{}, nil
+}
+
+func (m *mockSFN) SendTaskFailureWithContext(ctx aws.Context, input *sfn.SendTaskFailureInput, opts ...request.Option) (*sfn.SendTaskFailureOutput, error) {
+	m.failure = input
+	return &sfn.SendTaskFailureOutput{}, nil
+}
+
+func (m *mockSFN) SendTaskHeartbeatWithContext(ctx aws.Context, input *sfn.SendTaskHeartbeatInput, opts ...request.Option) (*sfn.SendTaskHeartbeatOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.heartbeats++
+	return &sfn.SendTaskHeartbeatOutput{}, m.heartbeatErr
+}
+
+// CardDeclined is a typed error a state machine can retry or catch
+type CardDeclined struct {
+	Reason string
+}
+
+func (e *CardDeclined) Error() string {
+	return "card declined: " + e.Reason
+}
+
+func TestStepFunctionsRouter(t *testing.T) {
+	type charge struct {
+		OrderID string  `json:"orderId"`
+		Amount  float64 `json:"amount"`
+	}
+
+	router := NewStepFunctionsRouter()
+	router.Tracer = &errorTraceStrategy{}
+	router.Handle("ChargeCard", func(ctx context.Context, d *HandlerDependencies, task *StepFunctionsTask) (interface{}, error) {
+		var c charge
+		if err := task.UnmarshalInput(&c); err != nil {
+			return nil, err
+		}
+		if c.Amount > 100 {
+			return nil, &CardDeclined{Reason: "insufficient funds"}
+		}
+		return map[string]interface{}{"orderId": c.OrderID, "charged": true}, nil
+	})
+	router.Handle("WaitForApproval", func(ctx context.Context, d *HandlerDependencies, task *StepFunctionsTask) (interface{}, error) {
+		return nil, ErrTaskTokenPending
+	})
+	router.Handle("WaitForReview", func(ctx context.Context, d *HandlerDependencies, task *StepFunctionsTask) (interface{}, error) {
+		return nil, fmt.Errorf("review requested: %w", ErrTaskTokenPending)
+	})
+	router.Handle("Slow", func(ctx context.Context, d *HandlerDependencies, task *StepFunctionsTask) (interface{}, error) {
+		time.Sleep(35 * time.Millisecond)
+		return "done", nil
+	})
+
+	Convey("StepFunctionsRouter", t, func() {
+		svc := &mockSFN{}
+		router.SFN = svc
+
+		Convey("Should map state input and return the output", func() {
+			out, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+				"_stateName": "ChargeCard",
+				"orderId":    "123",
+				"amount":     10.5,
+			})
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, map[string]interface{}{"orderId": "123", "charged": true})
+			So(svc.success, ShouldBeNil)
+		})
+
+		Convey("Should return typed errors", func() {
+			_, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+				"_stateName": "ChargeCard",
+				"amount":     500,
+			})
+			So(err, ShouldNotBeNil)
+			So(StepFunctionsErrorName(err), ShouldEqual, "CardDeclined")
+		})
+
+		Convey("Should send the output or failure for a task token", func() {
+			_, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+				"_stateName": "ChargeCard",
+				"_taskToken": "token1",
+				"orderId":    "123",
+				"amount":     10,
+			})
+			So(err, ShouldBeNil)
+			So(*svc.success.TaskToken, ShouldEqual, "token1")
+			So(*svc.success.Output, ShouldEqual, `{"charged":true,"orderId":"123"}`)
+
+			_, err = router.LambdaHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+				"_stateName": "ChargeCard",
+				"_taskToken": "token2",
+				"amount":     500,
+			})
+			So(err, ShouldNotBeNil)
+			So(*svc.failure.TaskToken, ShouldEqual, "token2")
+			So(*svc.failure.Error, ShouldEqual, "CardDeclined")
+			So(*svc.failure.Cause, ShouldEqual, "card declined: insufficient funds")
+		})
+
+		Convey("Should leave a pending task token alone", func() {
+			_, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+				"_stateName": "WaitForApproval",
+				"_taskToken": "token",
+			})
+			So(err, ShouldBeNil)
+			So(svc.success, ShouldBeNil)
+			So(svc.failure, ShouldBeNil)
+
+			_, err = router.LambdaHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+				"_stateName": "WaitForReview",
+				"_taskToken": "token",
+			})
+			So(err, ShouldBeNil)
+			So(svc.success, ShouldBeNil)
+			So(svc.failure, ShouldBeNil)
+		})
+
+		Convey("Should send heartbeats while the handler runs", func() {
+			router.HeartbeatInterval = 10 * time.Millisecond
+			defer func() { router.HeartbeatInterval = 0 }()
+			_, err := router.LambdaHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+				"_stateName": "Slow",
+				"_taskToken": "token",
+			})
+			So(err, ShouldBeNil)
+			svc.mu.Lock()
+			defer svc.mu.Unlock()
+			So(svc.heartbeats, ShouldBeGreaterThanOrEqualTo, 2)
+			So(*svc.success.Output, ShouldEqual, `"done"`)
+		})
+
+		Convey("Should stop sending heartbeats when the task timed out", func() {
+			svc.heartbeatErr = awserr.New(sfn.ErrCodeTaskTimedOut, "Task Timed Out", nil)
+			router.HeartbeatInterval = 10 * time.Millisecond
+			defer func() { router.HeartbeatInterval = 0 }()
+			router.LambdaHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{
+				"_stateName": "Slow",
+				"_taskToken": "token",
+			})
+			svc.mu.Lock()
+			defer svc.mu.Unlock()
+			So(svc.heartbeats, ShouldEqual, 1)
+		})
+	})
+
+	Convey("Handlers should detect Step Functions task states", t, func() {
+		So(getType(map[string]interface{}{"_stateName": "ChargeCard"}), ShouldEqual, "StepFunctionsTask")
+
+		r := NewStepFunctionsRouterForStateField("state")
+		r.Tracer = &errorTraceStrategy{}
+		r.Handle("ChargeCard", router.handlers["ChargeCard"])
+		h := Handlers{StepFunctionsRouter: r}
+		evtType, _ := detectEventType(&h, map[string]interface{}{"state": "ChargeCard"})
+		So(evtType.Name, ShouldEqual, "StepFunctionsTask")
+
+		out, err := h.eventHandler(context.Background(), &HandlerDependencies{}, map[string]interface{}{"state": "ChargeCard", "orderId": "1"})
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, map[string]interface{}{"orderId": "1", "charged": true})
+
+		// The state field only applies to Handlers with that router
+		So(getType(map[string]interface{}{"state": "ChargeCard"}), ShouldEqual, "")
+		evtType, _ = detectEventType(&Handlers{StepFunctionsRouter: NewStepFunctionsRouter()}, map[string]interface{}{"state": "ChargeCard"})
+		So(evtType.Name, ShouldEqual, "")
+	})
+}
@@ -31,18 +31,40 @@ type Tasker struct {
 // TaskHandler is similar to RouteHandler except there is no response or middleware
 type TaskHandler func(context.Context, *HandlerDependencies, map[string]interface{}) error
 
+func init() {
+	// The convention will be that tasks are named with a `_taskName` key.
+	// This is known as an "AegisTask" and gets handled by Tasker.
+	RegisterEventType(EventType{
+		Name:     "AegisTask",
+		Priority: 500,
+		Detect: func(evt map[string]interface{}) bool {
+			return keyInMap("_taskName", evt)
+		},
+		// Tasker takes a simple map[string]interface{} - not a struct (like some other events).
+		Handled: func(h *Handlers) bool {
+			return h.Tasker != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			// Task handlers have no return
+			h.Tasker.LambdaHandler(ctx, d, evt.(map[string]interface{}))
+			return nil, nil
+		},
+	})
+}
+
 // LambdaHandler is a native AWS Lambda Go handler function. Handles a CloudWatch event.
 func (t *Tasker) LambdaHandler(ctx context.Context, d *HandlerDependencies, evt map[string]interface{}) error {
-	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
-	if t.Tracer != nil {
-		d.Tracer = t.Tracer
-	}
-
 	// If an incoming event can be matched to this router, but the router has no registered handlers
 	// or if one hasn't been added to aegis.Handlers{}.
 	if t == nil {
 		return errors.New("no handlers registered for Tasker")
 	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if t.Tracer != nil {
+		d.Tracer = t.Tracer
+	}
+
 	var err error
 
 	handled := false
@@ -17,21 +17,32 @@
 package framework
 
 import (
+	"fmt"
 	"net/url"
+	"regexp"
+	"sort"
 	"strings"
 )
 
 // route is a handler for an HTTP verb, plus it's middleware (if any).
+// The tree is also used by CloudFrontRouter, in which case the "verb" is the CloudFront event type and the router
+// keeps its own handlers for the (otherwise empty) routes.
 type route struct {
 	handler    RouteHandler
 	middleware []Middleware
+	meta       RouteMeta
 }
 
 // node represents a struct of each node in the tree.
+// Path components can be static, named params (:name), named params constrained by a regular expression
+// (:name{[0-9]+}) or catch-alls (*name) which bind the remaining path and must be last.
 type node struct {
 	children     []*node
 	component    string
 	isNamedParam bool
+	isCatchAll   bool
+	paramName    string
+	pattern      *regexp.Regexp
 	methods      map[string]*route
 }
 
@@ -39,33 +50,137 @@ type node struct {
 // can be broken up into multiple components. Those nodes will have no
 // handler implemented and will fall through to the default handler.
 func (n *node) addNode(method, path string, handler RouteHandler, middleware ...Middleware) {
+	r := route{handler: handler}
+	r.middleware = append(r.middleware, middleware...)
+	n.addRoute(method, path, &r)
+}
+
+// addRoute adds a route to our tree, see addNode. It panics if the path is invalid, the method and path are
+// already handled or the path conflicts with another route (ie. /users/:id and /users/:name).
+func (n *node) addRoute(method, path string, r *route) {
 	components := strings.Split(path, "/")[1:]
-	count := len(components)
-
-	for {
-		aNode, component := n.traverse(components, nil)
-		if aNode.component == component && count == 1 { // update an existing node.
-			r := route{handler: handler}
-			r.middleware = append(r.middleware, middleware...)
-			aNode.methods[method] = &r
-			return
+	current := n
+	for i, component := range components {
+		child := current.child(component)
+		exists := child != nil
+		if !exists {
+			child = newNode(component, path)
+		}
+		// The catch-all node may already exist for another route, so this is checked either way
+		if child.isCatchAll && i != len(components)-1 {
+			panic(fmt.Sprintf("catch-all %s must be the last part of the path %s", component, path))
+		}
+		if !exists {
+			current.addChild(child, path)
+		}
+		current = child
+	}
+	if _, ok := current.methods[method]; ok {
+		panic(fmt.Sprintf("%s %s is already handled", method, path))
+	}
+	current.methods[method] = r
+}
+
+// newNode returns a node for a path component, parsing named params and catch-alls
+func newNode(component, path string) *node {
+	newNode := &node{component: component, methods: make(map[string]*route)}
+	if len(component) == 0 {
+		return newNode
+	}
+	switch component[0] {
+	case ':': // check if it is a named param.
+		newNode.isNamedParam = true
+		newNode.paramName = component[1:]
+		if i := strings.Index(component, "{"); i > 0 {
+			if !strings.HasSuffix(component, "}") {
+				panic(fmt.Sprintf("param %s in the path %s has an unterminated pattern", component, path))
+			}
+			pattern, err := regexp.Compile("^(?:" + component[i+1:len(component)-1] + ")$")
+			if err != nil {
+				panic(fmt.Sprintf("param %s in the path %s has an invalid pattern: %s", component, path, err))
+			}
+			newNode.paramName = component[1:i]
+			newNode.pattern = pattern
 		}
-		newNode := node{component: component, isNamedParam: false, methods: make(map[string]*route)}
+	case '*': // or a catch-all.
+		newNode.isCatchAll = true
+		newNode.paramName = component[1:]
+	}
+	if (newNode.isNamedParam || newNode.isCatchAll) && newNode.paramName == "" {
+		panic(fmt.Sprintf("param %s in the path %s has no name", component, path))
+	}
+	return newNode
+}
 
-		if len(component) > 0 && component[0] == ':' { // check if it is a named param.
-			newNode.isNamedParam = true
+// find returns the node for the exact path (not the node it would match), nil if the path has no node
+func (n *node) find(path string) *node {
+	current := n
+	for _, component := range strings.Split(path, "/")[1:] {
+		if current = current.child(component); current == nil {
+			return nil
 		}
-		if count == 1 { // this is the last component of the url resource, so it gets the handler.
-			r := route{handler: handler}
-			r.middleware = append(r.middleware, middleware...)
-			newNode.methods[method] = &r
+	}
+	return current
+}
+
+// child returns the child node for the exact path component (not the node it would match)
+func (n *node) child(component string) *node {
+	for _, child := range n.children {
+		if child.component == component {
+			return child
+		}
+	}
+	return nil
+}
+
+// addChild adds a child node, keeping children in the order they are matched. Static components come first, then
+// constrained named params (in the order they were added), then named params and lastly catch-alls. Panics if the
+// child conflicts with another, since only one of them could ever be matched.
+func (n *node) addChild(child *node, path string) {
+	for _, existing := range n.children {
+		conflict := false
+		switch {
+		case child.isCatchAll:
+			conflict = existing.isCatchAll
+		case child.isNamedParam && child.pattern == nil:
+			conflict = existing.isNamedParam && existing.pattern == nil
+		case child.isNamedParam:
+			conflict = existing.isNamedParam && existing.pattern != nil && existing.pattern.String() == child.pattern.String()
 		}
-		aNode.children = append(aNode.children, &newNode)
-		count--
-		if count == 0 {
-			break
+		if conflict {
+			panic(fmt.Sprintf("%s in the path %s conflicts with %s", child.component, path, existing.component))
 		}
 	}
+	n.children = append(n.children, child)
+	sort.SliceStable(n.children, func(i, j int) bool {
+		return n.children[i].precedence() < n.children[j].precedence()
+	})
+}
+
+// precedence is the order in which kinds of nodes are matched, lowest first
+func (n *node) precedence() int {
+	switch {
+	case n.isCatchAll:
+		return 3
+	case n.isNamedParam && n.pattern == nil:
+		return 2
+	case n.isNamedParam:
+		return 1
+	}
+	return 0
+}
+
+// matches returns true if the node matches a path component (catch-alls match anything)
+func (n *node) matches(component string) bool {
+	switch {
+	case n.isCatchAll:
+		return true
+	case n.isNamedParam && n.pattern != nil:
+		return n.pattern.MatchString(component)
+	case n.isNamedParam:
+		return true
+	}
+	return n.component == component
 }
 
 // traverse moves along the tree adding named params as it comes and across them.
@@ -74,9 +189,15 @@ func (n *node) traverse(components []string, params url.Values) (*node, string)
 	component := components[0]
 	if len(n.children) > 0 { // no children, then bail out.
 		for _, child := range n.children {
-			if component == child.component || child.isNamedParam {
+			if child.matches(component) {
+				if child.isCatchAll {
+					if params != nil {
+						params.Add(child.paramName, strings.Join(components, "/"))
+					}
+					return child, component
+				}
 				if child.isNamedParam && params != nil {
-					params.Add(child.component[1:], component)
+					params.Add(child.paramName, component)
 				}
 				next := components[1:]
 				if len(next) > 0 { // http://xkcd.com/1270/
@@ -88,3 +209,50 @@ func (n *node) traverse(components []string, params url.Values) (*node, string)
 	}
 	return n, component
 }
+
+// match returns the node matching all of the path components, adding named params as it comes across them.
+// Unlike traverse, nil is returned when only part of the path matches. A trailing slash is optional.
+// When a static component or param leads nowhere, the next possible match is tried (see addChild for the order).
+func (n *node) match(components []string, params url.Values) *node {
+	component := components[0]
+	next := components[1:]
+	for _, child := range n.children {
+		if !child.matches(component) {
+			continue
+		}
+		if child.isCatchAll {
+			if params != nil {
+				params.Add(child.paramName, strings.Join(components, "/"))
+			}
+			return child
+		}
+		var found *node
+		if len(next) > 0 {
+			found = child.match(next, params)
+		} else if len(child.methods) > 0 {
+			// A node without methods is only part of a longer route's path (ie. new in /users/new/edit)
+			found = child
+		}
+		if found != nil {
+			if child.isNamedParam && params != nil {
+				params.Add(child.paramName, component)
+			}
+			return found
+		}
+	}
+	if component == "" && len(next) == 0 && len(n.methods) > 0 {
+		return n
+	}
+	return nil
+}
+
+// walk calls fn for each route in the tree with the route's method and path.
+func (n *node) walk(path string, fn func(method, path string, r *route)) {
+	for _, child := range n.children {
+		p := path + "/" + child.component
+		for method, r := range child.methods {
+			fn(method, p, r)
+		}
+		child.walk(p, fn)
+	}
+}
@@ -59,3 +59,99 @@ func TestTrie(t *testing.T) {
 		})
 	})
 }
+
+func TestTrieMatch(t *testing.T) {
+	testHandler := func(ctx context.Context, d *HandlerDependencies, req *APIGatewayProxyRequest, res *APIGatewayProxyResponse, params url.Values) error {
+		return nil
+	}
+	tree := &node{component: "/", methods: make(map[string]*route)}
+	tree.addNode("GET", "/users/:id{[0-9]+}", testHandler)
+	tree.addNode("GET", "/users/:name", testHandler)
+	tree.addNode("GET", "/users/me", testHandler)
+	tree.addNode("GET", "/users/new/edit", testHandler)
+	tree.addNode("GET", "/users/:id{[0-9]+}/posts", testHandler)
+	tree.addNode("GET", "/files/*path", testHandler)
+	tree.addNode("GET", "/files/readme", testHandler)
+	tree.addNode("GET", "/files/:dir/index", testHandler)
+
+	match := func(path string) (string, url.Values) {
+		params := url.Values{}
+		n := tree.match(strings.Split(path, "/")[1:], params)
+		if n == nil {
+			return "", params
+		}
+		return n.component, params
+	}
+
+	Convey("match", t, func() {
+		Convey("Should match static components before params", func() {
+			component, params := match("/users/me")
+			So(component, ShouldEqual, "me")
+			So(params, ShouldBeEmpty)
+		})
+
+		Convey("Should match a param when a static component only leads to longer routes", func() {
+			component, params := match("/users/new")
+			So(component, ShouldEqual, ":name")
+			So(params.Get("name"), ShouldEqual, "new")
+
+			component, params = match("/users/new/edit")
+			So(component, ShouldEqual, "edit")
+			So(params, ShouldBeEmpty)
+		})
+
+		Convey("Should match constrained params before params", func() {
+			component, params := match("/users/42")
+			So(component, ShouldEqual, ":id{[0-9]+}")
+			So(params.Get("id"), ShouldEqual, "42")
+
+			component, params = match("/users/bob")
+			So(component, ShouldEqual, ":name")
+			So(params.Get("name"), ShouldEqual, "bob")
+
+			component, params = match("/users/42/posts")
+			So(component, ShouldEqual, "posts")
+			So(params.Get("id"), ShouldEqual, "42")
+		})
+
+		Convey("Should match params before catch-alls and bind the rest of the path to catch-alls", func() {
+			component, params := match("/files/readme")
+			So(component, ShouldEqual, "readme")
+
+			component, params = match("/files/docs/index")
+			So(component, ShouldEqual, "index")
+			So(params.Get("dir"), ShouldEqual, "docs")
+
+			component, params = match("/files/docs/guide/intro.md")
+			So(component, ShouldEqual, "*path")
+			So(params.Get("path"), ShouldEqual, "docs/guide/intro.md")
+			So(params, ShouldNotContainKey, "dir")
+		})
+
+		Convey("Should not match part of a path", func() {
+			component, _ := match("/users/42/comments")
+			So(component, ShouldBeEmpty)
+		})
+	})
+
+	Convey("addRoute", t, func() {
+		Convey("Should panic on conflicting or duplicate routes", func() {
+			So(func() { tree.addNode("GET", "/users/:user", testHandler) }, ShouldPanic)
+			So(func() { tree.addNode("GET", "/users/:num{[0-9]+}", testHandler) }, ShouldPanic)
+			So(func() { tree.addNode("GET", "/files/*rest", testHandler) }, ShouldPanic)
+			So(func() { tree.addNode("GET", "/users/me", testHandler) }, ShouldPanic)
+		})
+
+		Convey("Should panic on invalid paths", func() {
+			So(func() { tree.addNode("GET", "/assets/*path/more", testHandler) }, ShouldPanic)
+			So(func() { tree.addNode("GET", "/files/*path/more", testHandler) }, ShouldPanic)
+			So(func() { tree.addNode("GET", "/orders/:id{[0-9}", testHandler) }, ShouldPanic)
+			So(func() { tree.addNode("GET", "/orders/:id{[0-9]+", testHandler) }, ShouldPanic)
+			So(func() { tree.addNode("GET", "/orders/:", testHandler) }, ShouldPanic)
+		})
+
+		Convey("Should allow other methods for the same path", func() {
+			So(func() { tree.addNode("POST", "/users/me", testHandler) }, ShouldNotPanic)
+		})
+	})
+}
@@ -0,0 +1,185 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	// WebSocketConnectRoute is the route key used when a client connects
+	WebSocketConnectRoute = "$connect"
+	// WebSocketDisconnectRoute is the route key used when a client disconnects
+	WebSocketDisconnectRoute = "$disconnect"
+	// WebSocketDefaultRoute is the route key used when no other route matches a message
+	WebSocketDefaultRoute = "$default"
+)
+
+// WebSocketRouter struct provides an interface to handle API Gateway WebSocket API events by route key
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/websocket-api-develop-routes.html
+type WebSocketRouter struct {
+	handlers    map[string]WebSocketHandler
+	rootHandler WebSocketHandler
+	Tracer      TraceStrategy
+}
+
+// WebSocketHandler handles routed WebSocket events. Like RouteHandler, the response is manipulated directly.
+// For the $connect route, a status code other than 200 will reject the connection.
+type WebSocketHandler func(context.Context, *HandlerDependencies, *APIGatewayWebsocketProxyRequest, *APIGatewayProxyResponse) error
+
+func init() {
+	// WebSocket API events have a route key and connection ID in the request context.
+	// They can look like API Gateway proxy requests, so they must be detected first.
+	RegisterEventType(EventType{
+		Name:     "APIGatewayWebsocketProxyRequest",
+		Priority: 80,
+		Detect:   isWebSocketRequest,
+		Decode: func(evt map[string]interface{}) (interface{}, error) {
+			var e APIGatewayWebsocketProxyRequest
+			err := DecodeEventJSON(evt, &e)
+			return e, err
+		},
+		Handled: func(h *Handlers) bool {
+			return h.WebSocketRouter != nil
+		},
+		Dispatch: func(ctx context.Context, h *Handlers, d *HandlerDependencies, evt interface{}) (interface{}, error) {
+			return h.WebSocketRouter.LambdaHandler(ctx, d, evt.(APIGatewayWebsocketProxyRequest))
+		},
+	})
+}
+
+// isWebSocketRequest returns true if the event came from an API Gateway WebSocket API
+func isWebSocketRequest(evt map[string]interface{}) bool {
+	requestContext, ok := evt["requestContext"].(map[string]interface{})
+	return ok && keyInMap("routeKey", requestContext) && keyInMap("connectionId", requestContext)
+}
+
+// LambdaHandler handles WebSocket API events. The handler is chosen by the route key, falling back to the $default
+// route's handler and then the router's root handler.
+func (r *WebSocketRouter) LambdaHandler(ctx context.Context, d *HandlerDependencies, req APIGatewayWebsocketProxyRequest) (APIGatewayProxyResponse, error) {
+	// If an incoming event can be matched to this router, but the router has no registered handlers
+	// or if one hasn't been added to aegis.Handlers{}.
+	if r == nil {
+		return APIGatewayProxyResponse{}, errors.New("no handlers registered for WebSocketRouter")
+	}
+
+	// If this Router had a Tracer set for it, replace the default which came from the Aegis interface.
+	if r.Tracer != nil {
+		d.Tracer = r.Tracer
+	}
+
+	// Configure the connection manager service for the API that sent the event, if it wasn't already configured
+	if d.Services != nil && d.Services.WebSocket == nil && req.RequestContext.DomainName != "" {
+		svc, err := NewWebSocketConnectionManager(&WebSocketConnectionManagerConfig{
+			Endpoint: req.ManagementEndpoint(),
+		})
+		if err != nil {
+			log.Println("WebSocket connection manager could not be configured")
+			log.Println(err)
+		}
+		d.Services.WebSocket = svc
+	}
+
+	res := APIGatewayProxyResponse{StatusCode: 200}
+	routeKey := req.RequestContext.RouteKey
+
+	handler, ok := r.handlers[routeKey]
+	if !ok {
+		handler, ok = r.handlers[WebSocketDefaultRoute]
+	}
+	if !ok {
+		handler = r.rootHandler
+	}
+	if handler == nil {
+		return res, nil
+	}
+
+	d.Tracer.Record("annotation",
+		map[string]interface{}{
+			"WebSocketRouteKey":     routeKey,
+			"WebSocketConnectionID": req.RequestContext.ConnectionID,
+			"FallthroughHandler":    !ok,
+		},
+	)
+	err := d.Tracer.Capture(ctx, "WebSocketHandler", func(ctx1 context.Context) error {
+		return handler(ctx1, d, &req, &res)
+	})
+
+	// Like Router, errors are returned in the response rather than from the Lambda handler itself.
+	// For $connect, this rejects the connection.
+	if err != nil {
+		res.Error(500, err)
+	}
+	return res, nil
+}
+
+// Listen will start a WebSocket event listener that handles incoming WebSocket API events
+func (r *WebSocketRouter) Listen() {
+	lambda.Start(r.LambdaHandler)
+}
+
+// NewWebSocketRouter simply returns a new WebSocketRouter struct and behaves a bit like Router, it even takes an optional rootHandler or "fall through" catch all
+func NewWebSocketRouter(rootHandler ...WebSocketHandler) *WebSocketRouter {
+	r := &WebSocketRouter{
+		handlers: make(map[string]WebSocketHandler),
+	}
+	if len(rootHandler) > 0 {
+		r.rootHandler = rootHandler[0]
+	}
+	return r
+}
+
+// Handle will register a handler for a given route key
+func (r *WebSocketRouter) Handle(routeKey string, handler WebSocketHandler) {
+	if r.handlers == nil {
+		r.handlers = make(map[string]WebSocketHandler)
+	}
+	r.handlers[routeKey] = handler
+}
+
+// Connect is the same as Handle only the $connect route key is already implied.
+func (r *WebSocketRouter) Connect(handler WebSocketHandler) {
+	r.Handle(WebSocketConnectRoute, handler)
+}
+
+// Disconnect is the same as Handle only the $disconnect route key is already implied.
+func (r *WebSocketRouter) Disconnect(handler WebSocketHandler) {
+	r.Handle(WebSocketDisconnectRoute, handler)
+}
+
+// Default is the same as Handle only the $default route key is already implied.
+func (r *WebSocketRouter) Default(handler WebSocketHandler) {
+	r.Handle(WebSocketDefaultRoute, handler)
+}
+
+// ConnectionID returns the ID of the connection that sent the event
+func (req *APIGatewayWebsocketProxyRequest) ConnectionID() string {
+	return req.RequestContext.ConnectionID
+}
+
+// ManagementEndpoint returns the connection management API endpoint for the WebSocket API that sent the event
+func (req *APIGatewayWebsocketProxyRequest) ManagementEndpoint() string {
+	return "https://" + req.RequestContext.DomainName + "/" + req.RequestContext.Stage
+}
+
+// UnmarshalBody will decode the message body as JSON into v
+func (req *APIGatewayWebsocketProxyRequest) UnmarshalBody(v interface{}) error {
+	return json.Unmarshal([]byte(req.Body), v)
+}
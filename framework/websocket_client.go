@@ -0,0 +1,185 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// The AWS SDK (at the version used) has no client for the API Gateway Management API, so requests are signed and sent here.
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/apigateway-how-to-call-websocket-api-connections.html
+
+// ErrWebSocketConnectionGone is returned when a connection is no longer available (the client has disconnected)
+var ErrWebSocketConnectionGone = errors.New("websocket connection is gone")
+
+// WebSocketConnectionManager posts messages to, gets information about, and disconnects WebSocket API connections
+type WebSocketConnectionManager struct {
+	Endpoint    string
+	Region      string
+	HTTPClient  *http.Client
+	credentials *credentials.Credentials
+	signer      *v4.Signer
+}
+
+// WebSocketConnectionManagerConfig defines the configuration for a WebSocketConnectionManager.
+// Endpoint is the connection management URL, ie. https://{api-id}.execute-api.{region}.amazonaws.com/{stage}
+// If Region is not set, it will be taken from the endpoint or the AWS session. If Credentials are not set,
+// they will be taken from the AWS session (the Lambda's execution role).
+type WebSocketConnectionManagerConfig struct {
+	Endpoint    string                   `json:"endpoint"`
+	Region      string                   `json:"region"`
+	HTTPClient  *http.Client             `json:"-"`
+	Credentials *credentials.Credentials `json:"-"`
+}
+
+// WebSocketConnection contains information about a connection
+type WebSocketConnection struct {
+	ConnectedAt  time.Time `json:"connectedAt"`
+	LastActiveAt time.Time `json:"lastActiveAt"`
+	Identity     struct {
+		SourceIP  string `json:"sourceIp"`
+		UserAgent string `json:"userAgent"`
+	} `json:"identity"`
+}
+
+// NewWebSocketConnectionManager returns a new WebSocketConnectionManager for the given WebSocket API endpoint
+func NewWebSocketConnectionManager(cfg *WebSocketConnectionManagerConfig) (*WebSocketConnectionManager, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("a websocket connection management endpoint is required")
+	}
+	m := &WebSocketConnectionManager{
+		Endpoint:    strings.TrimRight(cfg.Endpoint, "/"),
+		Region:      cfg.Region,
+		HTTPClient:  cfg.HTTPClient,
+		credentials: cfg.Credentials,
+	}
+	if m.HTTPClient == nil {
+		m.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if m.Region == "" {
+		m.Region = getRegionFromExecuteAPIEndpoint(m.Endpoint)
+	}
+
+	if m.credentials == nil || m.Region == "" {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		if m.credentials == nil {
+			m.credentials = sess.Config.Credentials
+		}
+		if m.Region == "" {
+			m.Region = aws.StringValue(sess.Config.Region)
+		}
+	}
+	if m.Region == "" {
+		m.Region = os.Getenv("AWS_REGION")
+	}
+
+	m.signer = v4.NewSigner(m.credentials)
+	return m, nil
+}
+
+// getRegionFromExecuteAPIEndpoint returns the region from an execute-api endpoint or an empty string for custom domains
+func getRegionFromExecuteAPIEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	p := strings.Split(u.Hostname(), ".")
+	if len(p) > 3 && p[1] == "execute-api" {
+		return p[2]
+	}
+	return ""
+}
+
+// PostToConnection sends data to a connected client
+func (m *WebSocketConnectionManager) PostToConnection(ctx context.Context, connectionID string, data []byte) error {
+	_, err := m.do(ctx, http.MethodPost, connectionID, data)
+	return err
+}
+
+// PostJSONToConnection sends a value, marshaled as JSON, to a connected client
+func (m *WebSocketConnectionManager) PostJSONToConnection(ctx context.Context, connectionID string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return m.PostToConnection(ctx, connectionID, b)
+}
+
+// GetConnection returns information about a connection
+func (m *WebSocketConnectionManager) GetConnection(ctx context.Context, connectionID string) (WebSocketConnection, error) {
+	var conn WebSocketConnection
+	b, err := m.do(ctx, http.MethodGet, connectionID, nil)
+	if err == nil {
+		err = json.Unmarshal(b, &conn)
+	}
+	return conn, err
+}
+
+// DeleteConnection disconnects a client
+func (m *WebSocketConnectionManager) DeleteConnection(ctx context.Context, connectionID string) error {
+	_, err := m.do(ctx, http.MethodDelete, connectionID, nil)
+	return err
+}
+
+// do sends a signed request to the connection management API and returns the response body
+func (m *WebSocketConnectionManager) do(ctx context.Context, method string, connectionID string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, m.Endpoint+"/@connections/"+url.PathEscape(connectionID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	var bodyReader io.ReadSeeker
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	if _, err = m.signer.Sign(req, bodyReader, "execute-api", m.Region, time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := m.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return respBody, ErrWebSocketConnectionGone
+	case resp.StatusCode >= 300:
+		return respBody, fmt.Errorf("websocket connection management API returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
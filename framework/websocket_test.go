@@ -0,0 +1,210 @@
+// Copyright © 2016 Tom Maiaroto <tom@SerifAndSemaphore.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	events "github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWebSocketRouter(t *testing.T) {
+
+	newRequest := func(routeKey string, body string) APIGatewayWebsocketProxyRequest {
+		return APIGatewayWebsocketProxyRequest{
+			Body: body,
+			RequestContext: events.APIGatewayWebsocketProxyRequestContext{
+				RouteKey:     routeKey,
+				ConnectionID: "abc123=",
+				DomainName:   "a1b2c3.execute-api.us-east-1.amazonaws.com",
+				Stage:        "dev",
+			},
+		}
+	}
+	// Services already configured so the router doesn't try to configure the connection manager
+	d := &HandlerDependencies{Services: &Services{WebSocket: &WebSocketConnectionManager{}}}
+
+	router := NewWebSocketRouter()
+	router.Tracer = NoTraceStrategy{}
+	var handled string
+	router.Connect(func(ctx context.Context, d *HandlerDependencies, req *APIGatewayWebsocketProxyRequest, res *APIGatewayProxyResponse) error {
+		handled = req.RequestContext.RouteKey
+		if req.Body == "reject" {
+			res.SetStatus(403)
+		}
+		return nil
+	})
+	router.Handle("sendMessage", func(ctx context.Context, d *HandlerDependencies, req *APIGatewayWebsocketProxyRequest, res *APIGatewayProxyResponse) error {
+		var msg struct {
+			Text string `json:"text"`
+		}
+		if err := req.UnmarshalBody(&msg); err != nil {
+			return err
+		}
+		handled = msg.Text
+		return nil
+	})
+
+	Convey("WebSocketRouter", t, func() {
+		Convey("Should route by route key", func() {
+			res, err := router.LambdaHandler(context.Background(), d, newRequest("$connect", ""))
+			So(err, ShouldBeNil)
+			So(res.StatusCode, ShouldEqual, 200)
+			So(handled, ShouldEqual, "$connect")
+
+			router.LambdaHandler(context.Background(), d, newRequest("sendMessage", `{"text":"hello"}`))
+			So(handled, ShouldEqual, "hello")
+		})
+
+		Convey("Should allow handlers to set the response", func() {
+			res, _ := router.LambdaHandler(context.Background(), d, newRequest("$connect", "reject"))
+			So(res.StatusCode, ShouldEqual, 403)
+		})
+
+		Convey("Should return errors in the response", func() {
+			router.Tracer = &errorTraceStrategy{}
+			res, err := router.LambdaHandler(context.Background(), d, newRequest("sendMessage", "not json"))
+			router.Tracer = NoTraceStrategy{}
+			So(err, ShouldBeNil)
+			So(res.StatusCode, ShouldEqual, 500)
+		})
+
+		Convey("Should use the $default handler and then the root handler", func() {
+			rootHandled := false
+			r := NewWebSocketRouter(func(ctx context.Context, d *HandlerDependencies, req *APIGatewayWebsocketProxyRequest, res *APIGatewayProxyResponse) error {
+				rootHandled = true
+				return nil
+			})
+			r.Tracer = NoTraceStrategy{}
+			r.LambdaHandler(context.Background(), d, newRequest("unknown", ""))
+			So(rootHandled, ShouldBeTrue)
+
+			defaultHandled := false
+			r.Default(func(ctx context.Context, d *HandlerDependencies, req *APIGatewayWebsocketProxyRequest, res *APIGatewayProxyResponse) error {
+				defaultHandled = true
+				return nil
+			})
+			rootHandled = false
+			r.LambdaHandler(context.Background(), d, newRequest("unknown", ""))
+			So(defaultHandled, ShouldBeTrue)
+			So(rootHandled, ShouldBeFalse)
+		})
+
+		Convey("Should provide the connection management endpoint", func() {
+			req := newRequest("$connect", "")
+			So(req.ConnectionID(), ShouldEqual, "abc123=")
+			So(req.ManagementEndpoint(), ShouldEqual, "https://a1b2c3.execute-api.us-east-1.amazonaws.com/dev")
+		})
+	})
+
+	Convey("Handlers should detect and decode WebSocket events", t, func() {
+		evt := map[string]interface{}{
+			"requestContext": map[string]interface{}{
+				"routeKey":     "sendMessage",
+				"eventType":    "MESSAGE",
+				"connectionId": "abc123=",
+				"domainName":   "a1b2c3.execute-api.us-east-1.amazonaws.com",
+				"stage":        "dev",
+				"messageId":    "def456=",
+			},
+			"body":            `{"text":"detected"}`,
+			"isBase64Encoded": false,
+		}
+		So(getType(evt), ShouldEqual, "APIGatewayWebsocketProxyRequest")
+		// Even if it looked like an API Gateway proxy request
+		So(getType(map[string]interface{}{
+			"httpMethod":     "GET",
+			"path":           "/",
+			"requestContext": evt["requestContext"],
+		}), ShouldEqual, "APIGatewayWebsocketProxyRequest")
+
+		h := Handlers{WebSocketRouter: router}
+		res, err := h.eventHandler(context.Background(), d, evt)
+		So(err, ShouldBeNil)
+		So(res.(APIGatewayProxyResponse).StatusCode, ShouldEqual, 200)
+		So(handled, ShouldEqual, "detected")
+	})
+}
+
+func TestWebSocketConnectionManager(t *testing.T) {
+	var lastRequest *http.Request
+	var lastBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastRequest = r
+		b, _ := ioutil.ReadAll(r.Body)
+		lastBody = string(b)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/gone"):
+			w.WriteHeader(http.StatusGone)
+		case r.Method == http.MethodGet:
+			w.Write([]byte(`{"connectedAt":"2019-01-01T00:00:00Z","identity":{"sourceIp":"192.0.2.1"}}`))
+		}
+	}))
+	defer server.Close()
+
+	m, err := NewWebSocketConnectionManager(&WebSocketConnectionManagerConfig{
+		Endpoint:    server.URL + "/dev/",
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	})
+
+	Convey("NewWebSocketConnectionManager()", t, func() {
+		So(err, ShouldBeNil)
+		So(m.Endpoint, ShouldEqual, server.URL+"/dev")
+
+		Convey("Should require an endpoint", func() {
+			_, err := NewWebSocketConnectionManager(&WebSocketConnectionManagerConfig{})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should get the region from execute-api endpoints", func() {
+			So(getRegionFromExecuteAPIEndpoint("https://a1b2c3.execute-api.eu-west-1.amazonaws.com/dev"), ShouldEqual, "eu-west-1")
+			So(getRegionFromExecuteAPIEndpoint("https://ws.example.com"), ShouldEqual, "")
+		})
+	})
+
+	Convey("PostJSONToConnection()", t, func() {
+		err := m.PostJSONToConnection(context.Background(), "abc123=", map[string]string{"text": "hello"})
+		So(err, ShouldBeNil)
+		So(lastRequest.Method, ShouldEqual, http.MethodPost)
+		So(lastRequest.URL.Path, ShouldEqual, "/dev/@connections/abc123=")
+		So(lastRequest.Header.Get("Authorization"), ShouldStartWith, "AWS4-HMAC-SHA256")
+		So(lastBody, ShouldEqual, `{"text":"hello"}`)
+	})
+
+	Convey("GetConnection()", t, func() {
+		conn, err := m.GetConnection(context.Background(), "abc123=")
+		So(err, ShouldBeNil)
+		So(conn.Identity.SourceIP, ShouldEqual, "192.0.2.1")
+	})
+
+	Convey("DeleteConnection()", t, func() {
+		So(m.DeleteConnection(context.Background(), "abc123="), ShouldBeNil)
+		So(lastRequest.Method, ShouldEqual, http.MethodDelete)
+
+		Convey("Should return ErrWebSocketConnectionGone for disconnected clients", func() {
+			err := m.DeleteConnection(context.Background(), "gone")
+			So(errors.Is(err, ErrWebSocketConnectionGone), ShouldBeTrue)
+		})
+	})
+}